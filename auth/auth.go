@@ -0,0 +1,234 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authentication schemes accepted in the Authorization header.
+const (
+	SchemeBearer = "Bearer"
+	SchemeHMAC   = "HMAC-SHA256"
+)
+
+// MaxClockSkew bounds how far an HMAC timestamp may be from the verifier's
+// clock. Within it, each signature is accepted only once.
+const MaxClockSkew = 5 * time.Minute
+
+var (
+	ErrMissingCredentials = errors.New("missing credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrReplayed           = errors.New("replayed request")
+)
+
+// Credentials maps service types to the shared secret their instances must
+// present to register.
+type Credentials map[string]string
+
+// LoadCredentials reads credentials from a JSON file of the form
+//
+//	{"Logging": "secret", "Business": "another-secret"}
+func LoadCredentials(path string) (Credentials, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var creds Credentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("invalid credentials file %s: %w", path, err)
+	}
+	return creds, nil
+}
+
+// Signer authenticates outgoing requests with a shared secret, either by
+// sending it as a bearer token or by signing the request with it.
+type Signer struct {
+	Secret string
+
+	// HMAC signs requests instead of sending the secret itself.
+	HMAC bool
+}
+
+// Sign sets the Authorization header of req, whose body is body.
+func (s Signer) Sign(req *http.Request, body []byte) {
+	if s.Secret == "" {
+		return
+	}
+	if !s.HMAC {
+		req.Header.Set("Authorization", SchemeBearer+" "+s.Secret)
+		return
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := newNonce()
+	sig := signature(s.Secret, req.Method, req.URL.RequestURI(), ts, nonce, body)
+	req.Header.Set("Authorization", fmt.Sprintf("%s ts=%s,nonce=%s,sig=%s", SchemeHMAC, ts, nonce, sig))
+}
+
+// Verify checks that r, whose body is body, was authenticated with secret.
+// An HMAC signature that was already verified is rejected with ErrReplayed.
+func Verify(r *http.Request, body []byte, secret string) error {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return ErrMissingCredentials
+	}
+	if secret == "" {
+		return ErrInvalidCredentials
+	}
+
+	scheme, params, _ := strings.Cut(header, " ")
+	switch scheme {
+	case SchemeBearer:
+		if subtle.ConstantTimeCompare([]byte(params), []byte(secret)) != 1 {
+			return ErrInvalidCredentials
+		}
+		return nil
+
+	case SchemeHMAC:
+		var ts, nonce, sig string
+		for _, param := range strings.Split(params, ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			switch key {
+			case "ts":
+				ts = value
+			case "nonce":
+				nonce = value
+			case "sig":
+				sig = value
+			}
+		}
+
+		unix, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil || nonce == "" {
+			return ErrInvalidCredentials
+		}
+		signed := time.Unix(unix, 0)
+		if skew := time.Since(signed); skew > MaxClockSkew || skew < -MaxClockSkew {
+			return fmt.Errorf("%w: timestamp outside allowed clock skew", ErrInvalidCredentials)
+		}
+
+		expected := signature(secret, r.Method, r.URL.RequestURI(), ts, nonce, body)
+		if !hmac.Equal([]byte(sig), []byte(expected)) {
+			return ErrInvalidCredentials
+		}
+
+		// Past the skew window the timestamp check rejects the signature, so
+		// it only needs remembering until then.
+		if !verified.remember(sig, signed.Add(MaxClockSkew), time.Now()) {
+			return fmt.Errorf("%w: %w", ErrInvalidCredentials, ErrReplayed)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("%w: unsupported scheme %q", ErrInvalidCredentials, scheme)
+	}
+}
+
+// signature is the hex HMAC-SHA256 over the method, the path with its query,
+// the timestamp, the nonce and the body hash.
+func signature(secret, method, uri, ts, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%x", method, uri, ts, nonce, bodyHash)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// verified holds the HMAC signatures Verify accepted that are still within
+// the clock skew window.
+var verified replayCache
+
+// replayCache remembers signatures until they expire.
+type replayCache struct {
+	mu        sync.Mutex
+	expires   map[string]time.Time
+	lastSweep time.Time
+}
+
+// remember records sig until expires and reports whether it was not already
+// recorded.
+func (rc *replayCache) remember(sig string, expires, now time.Time) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if now.Sub(rc.lastSweep) >= time.Minute {
+		rc.lastSweep = now
+		for s, e := range rc.expires {
+			if now.After(e) {
+				delete(rc.expires, s)
+			}
+		}
+	}
+
+	if e, ok := rc.expires[sig]; ok && !now.After(e) {
+		return false
+	}
+	if rc.expires == nil {
+		rc.expires = make(map[string]time.Time)
+	}
+	rc.expires[sig] = expires
+	return true
+}
+
+// NewToken returns a random token suitable as a per-instance secret.
+func NewToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// InstanceTokens remembers the secret issued to each registered instance.
+type InstanceTokens struct {
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+// Issue creates and stores a new token for the instance id.
+func (it *InstanceTokens) Issue(id string) string {
+	token := NewToken()
+
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	if it.tokens == nil {
+		it.tokens = make(map[string]string)
+	}
+	it.tokens[id] = token
+	return token
+}
+
+// Get returns the token issued to the instance id.
+func (it *InstanceTokens) Get(id string) (string, bool) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	token, ok := it.tokens[id]
+	return token, ok
+}
+
+// Revoke forgets the token issued to the instance id.
+func (it *InstanceTokens) Revoke(id string) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	delete(it.tokens, id)
+}
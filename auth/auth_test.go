@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"state": "draining"}`)
+
+	tests := []struct {
+		name   string
+		signer Signer
+		// change alters the request after it was signed.
+		change func(r *http.Request)
+		err    error
+	}{
+		{"bearer token", Signer{Secret: "secret"}, nil, nil},
+		{"HMAC signature", Signer{Secret: "secret", HMAC: true}, nil, nil},
+		{"wrong secret", Signer{Secret: "guess", HMAC: true}, nil, ErrInvalidCredentials},
+		{"no credentials", Signer{}, nil, ErrMissingCredentials},
+		{"another query", Signer{Secret: "secret", HMAC: true}, func(r *http.Request) {
+			r.URL.RawQuery = "type=Business"
+		}, ErrInvalidCredentials},
+		{"query removed", Signer{Secret: "secret", HMAC: true}, func(r *http.Request) {
+			r.URL.RawQuery = ""
+		}, ErrInvalidCredentials},
+		{"another path", Signer{Secret: "secret", HMAC: true}, func(r *http.Request) {
+			r.URL.Path = "/services/2"
+		}, ErrInvalidCredentials},
+		{"nonce removed", Signer{Secret: "secret", HMAC: true}, func(r *http.Request) {
+			header := r.Header.Get("Authorization")
+			start := strings.Index(header, "nonce=")
+			end := start + strings.Index(header[start:], ",") + 1
+			r.Header.Set("Authorization", header[:start]+header[end:])
+		}, ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/services/1?type=Logging", nil)
+			tt.signer.Sign(req, body)
+			if tt.change != nil {
+				tt.change(req)
+			}
+			if err := Verify(req, body, "secret"); !errors.Is(err, tt.err) {
+				t.Errorf("Verify() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsReplays(t *testing.T) {
+	signer := Signer{Secret: "secret", HMAC: true}
+
+	req := httptest.NewRequest(http.MethodDelete, "/deregister/1", nil)
+	signer.Sign(req, nil)
+	if err := Verify(req, nil, "secret"); err != nil {
+		t.Fatalf("first Verify() = %v", err)
+	}
+	if err := Verify(req, nil, "secret"); !errors.Is(err, ErrReplayed) {
+		t.Errorf("replayed Verify() = %v, want %v", err, ErrReplayed)
+	}
+
+	// The same request signed again, within the same second, is not a replay.
+	again := httptest.NewRequest(http.MethodDelete, "/deregister/1", nil)
+	signer.Sign(again, nil)
+	if err := Verify(again, nil, "secret"); err != nil {
+		t.Errorf("Verify() of a new signature = %v", err)
+	}
+
+	// Bearer tokens carry no signature to remember.
+	bearer := httptest.NewRequest(http.MethodDelete, "/deregister/1", nil)
+	Signer{Secret: "secret"}.Sign(bearer, nil)
+	for i := 0; i < 2; i++ {
+		if err := Verify(bearer, nil, "secret"); err != nil {
+			t.Errorf("bearer Verify() #%d = %v", i+1, err)
+		}
+	}
+}
+
+func TestReplayCacheExpires(t *testing.T) {
+	var rc replayCache
+	now := time.Now()
+
+	if !rc.remember("sig", now.Add(MaxClockSkew), now) {
+		t.Fatal("new signature reported as seen")
+	}
+	if rc.remember("sig", now.Add(MaxClockSkew), now.Add(time.Minute)) {
+		t.Error("signature accepted twice within the window")
+	}
+
+	later := now.Add(MaxClockSkew + time.Second)
+	if !rc.remember("other", later.Add(MaxClockSkew), later) {
+		t.Fatal("new signature reported as seen")
+	}
+	if _, ok := rc.expires["sig"]; ok {
+		t.Error("expired signature not swept")
+	}
+}
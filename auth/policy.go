@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+)
+
+// Permission names an operation guarded by a Policy.
+type Permission string
+
+// Permissions understood by the registrar.
+const (
+	// PermListServices allows listing every registered service.
+	PermListServices Permission = "services:list"
+
+	// PermDiscoverServices allows looking up the service types the caller
+	// declared in its RequiredServices.
+	PermDiscoverServices Permission = "services:discover"
+
+	// PermDeregisterServices allows forcibly deregistering any instance.
+	PermDeregisterServices Permission = "services:deregister"
+
+	// PermSetServiceState allows setting the state of any instance, for
+	// example to drain it or put it in maintenance.
+	PermSetServiceState Permission = "services:state"
+
+	// PermReadHealth allows reading the health of all registered services.
+	PermReadHealth Permission = "healthchecks:read"
+
+	// PermReadEvents allows reading the history and stream of registry events.
+	PermReadEvents Permission = "events:read"
+
+	// PermWritePolicies allows setting and removing traffic policies.
+	PermWritePolicies Permission = "policies:write"
+)
+
+// Policy grants permissions to identities through roles. An identity is the
+// name of a key presented in the Authorization header or the common name of a
+// verified TLS client certificate.
+//
+//	{
+//	  "roles": {
+//	    "service": ["services:discover"],
+//	    "admin": ["services:list", "services:deregister", "services:state", "healthchecks:read", "events:read"]
+//	  },
+//	  "bindings": {"Business": ["service"], "ops": ["admin"]},
+//	  "keys": {"ops": "ops-secret"}
+//	}
+type Policy struct {
+	// Roles maps role names to the permissions they grant.
+	Roles map[string][]Permission `json:"roles"`
+
+	// Bindings maps identities to their roles.
+	Bindings map[string][]string `json:"bindings"`
+
+	// Keys maps identities to secrets they authenticate with, as a bearer
+	// token or HMAC signature.
+	Keys map[string]string `json:"keys"`
+}
+
+// LoadPolicy reads a policy from a JSON file and checks that every binding
+// refers to a defined role.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+	for identity, roles := range p.Bindings {
+		for _, role := range roles {
+			if _, ok := p.Roles[role]; !ok {
+				return nil, fmt.Errorf("invalid policy file %s: %s is bound to undefined role %q", path, identity, role)
+			}
+		}
+	}
+	return &p, nil
+}
+
+// Identify returns the identity r was made by; body is the request body an
+// HMAC signature covers. A key in the Authorization header takes precedence
+// over the client certificate, so an operator can act under their own
+// identity from any host.
+func (p *Policy) Identify(r *http.Request, body []byte) (string, error) {
+	if r.Header.Get("Authorization") == "" {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			if cn := r.TLS.PeerCertificates[0].Subject.CommonName; cn != "" {
+				return cn, nil
+			}
+		}
+		return "", ErrMissingCredentials
+	}
+
+	// Sorted so a request matching several keys always resolves the same way.
+	identities := make([]string, 0, len(p.Keys))
+	for identity := range p.Keys {
+		identities = append(identities, identity)
+	}
+	sort.Strings(identities)
+
+	for _, identity := range identities {
+		if Verify(r, body, p.Keys[identity]) == nil {
+			return identity, nil
+		}
+	}
+	return "", ErrInvalidCredentials
+}
+
+// Allowed reports whether identity holds perm through any of its roles.
+func (p *Policy) Allowed(identity string, perm Permission) bool {
+	for _, role := range p.Bindings[identity] {
+		for _, granted := range p.Roles[role] {
+			if granted == perm {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type identityKey struct{}
+
+// Identity returns the identity stored in ctx by Require.
+func Identity(ctx context.Context) string {
+	identity, _ := ctx.Value(identityKey{}).(string)
+	return identity
+}
+
+// MaxPolicyBodyBytes is the largest request body Require reads to verify an
+// HMAC signature over it.
+const MaxPolicyBodyBytes = 1 << 20
+
+// Require returns middleware that admits requests whose identity holds any of
+// perms, answering 401 to unidentified and 403 to unauthorized callers. The
+// identity is stored in the request context, and the body, read to verify
+// its signature, is restored for the handler. A nil Policy admits everyone.
+func (p *Policy) Require(perms ...Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if p == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body []byte
+			if r.Body != nil && r.Body != http.NoBody {
+				var err error
+				body, err = io.ReadAll(io.LimitReader(r.Body, MaxPolicyBodyBytes+1))
+				r.Body.Close()
+				if err != nil {
+					http.Error(w, "failed to read request body", http.StatusBadRequest)
+					return
+				}
+				if len(body) > MaxPolicyBodyBytes {
+					http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+			}
+
+			identity, err := p.Identify(r, body)
+			if err != nil {
+				log.Printf("Rejected %s %s: %v", r.Method, r.URL.Path, err)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			for _, perm := range perms {
+				if p.Allowed(identity, perm) {
+					next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, identity)))
+					return
+				}
+			}
+
+			log.Printf("Denied %s %s to %s", r.Method, r.URL.Path, identity)
+			http.Error(w, "forbidden", http.StatusForbidden)
+		})
+	}
+}
+
+// Restrict is like Require, except that a nil Policy admits no one and answers
+// 403. It guards routes that act on other instances or the whole registry,
+// which must not open up just because no policy was loaded.
+func (p *Policy) Restrict(perms ...Permission) func(http.Handler) http.Handler {
+	if p != nil {
+		return p.Require(perms...)
+	}
+	return func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log.Printf("Denied %s %s: no policy loaded", r.Method, r.URL.Path)
+			http.Error(w, "forbidden: this route requires a policy file", http.StatusForbidden)
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func testPolicy() *Policy {
+	return &Policy{
+		Roles:    map[string][]Permission{"admin": {PermSetServiceState}, "reader": {PermListServices}},
+		Bindings: map[string][]string{"ops": {"admin"}, "viewer": {"reader"}},
+		Keys:     map[string]string{"ops": "ops-secret", "viewer": "viewer-secret"},
+	}
+}
+
+func TestRequire(t *testing.T) {
+	body := `{"state": "draining"}`
+
+	tests := []struct {
+		name   string
+		signer *Signer
+		// tamper replaces the body after signing.
+		tamper string
+		status int
+	}{
+		{"bearer token with body", &Signer{Secret: "ops-secret"}, "", http.StatusOK},
+		{"HMAC signature with body", &Signer{Secret: "ops-secret", HMAC: true}, "", http.StatusOK},
+		{"HMAC signature over another body", &Signer{Secret: "ops-secret", HMAC: true}, `{"state": "active"}`, http.StatusUnauthorized},
+		{"unknown key", &Signer{Secret: "guess", HMAC: true}, "", http.StatusUnauthorized},
+		{"identity without the permission", &Signer{Secret: "viewer-secret", HMAC: true}, "", http.StatusForbidden},
+		{"no credentials", nil, "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := testPolicy().Require(PermSetServiceState)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+				got = string(data)
+			}))
+
+			req := httptest.NewRequest(http.MethodPut, "/admin/services/1/state", strings.NewReader(body))
+			if tt.signer != nil {
+				tt.signer.Sign(req, []byte(body))
+			}
+			if tt.tamper != "" {
+				req.Body = io.NopCloser(strings.NewReader(tt.tamper))
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusOK && got != body {
+				t.Errorf("handler read body %q, want %q", got, body)
+			}
+		})
+	}
+}
+
+func TestRequireRejectsOversizedBody(t *testing.T) {
+	handler := testPolicy().Require(PermSetServiceState)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	body := strings.Repeat("x", MaxPolicyBodyBytes+1)
+	req := httptest.NewRequest(http.MethodPut, "/admin/services/1/state", strings.NewReader(body))
+	Signer{Secret: "ops-secret", HMAC: true}.Sign(req, []byte(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestRestrict(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *Policy
+		secret string
+		status int
+	}{
+		{"no policy refuses everyone", nil, "ops-secret", http.StatusForbidden},
+		{"policy admits a permitted identity", testPolicy(), "ops-secret", http.StatusOK},
+		{"policy refuses other identities", testPolicy(), "viewer-secret", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := tt.policy.Restrict(PermSetServiceState)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+			req := httptest.NewRequest(http.MethodDelete, "/admin/services/1", nil)
+			Signer{Secret: tt.secret}.Sign(req, nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
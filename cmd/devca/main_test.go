@@ -0,0 +1,111 @@
+package main
+
+import (
+	"demo/server"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// mint creates a CA in a temporary directory and certificates for names
+// signed by it, and returns the directory.
+func mint(t *testing.T, names ...string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	caCert, caKey, err := loadOrCreateCA(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := issue(dir, name, []string{"localhost", "127.0.0.1"}, time.Hour, caCert, caKey); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func tlsConfig(dir, name string, requireClientCert bool) *server.TLSConfig {
+	c := &server.TLSConfig{CAFile: filepath.Join(dir, "ca.pem"), RequireClientCert: requireClientCert}
+	if name != "" {
+		c.CertFile = filepath.Join(dir, name+".pem")
+		c.KeyFile = filepath.Join(dir, name+"-key.pem")
+	}
+	return c
+}
+
+func TestTLSWithMintedCertificates(t *testing.T) {
+	dir := mint(t, "registry", "business")
+
+	tests := []struct {
+		name              string
+		requireClientCert bool
+		client            *server.TLSConfig
+		ok                bool
+	}{
+		{"HTTPS verified against the CA", false, tlsConfig(dir, "", false), true},
+		{"HTTPS without trusting the CA", false, &server.TLSConfig{}, false},
+		{"mutual TLS with a client certificate", true, tlsConfig(dir, "business", false), true},
+		{"mutual TLS without a client certificate", true, tlsConfig(dir, "", false), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverConfig, err := tlsConfig(dir, "registry", tt.requireClientCert).ServerConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			ts.TLS = serverConfig
+			ts.StartTLS()
+			defer ts.Close()
+
+			clientConfig, err := tt.client.ClientConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+
+			resp, err := client.Get(ts.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err == nil) != tt.ok {
+				t.Errorf("GET over TLS: error = %v, want success %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestLoadOrCreateCAReusesCA(t *testing.T) {
+	dir := t.TempDir()
+	first, _, err := loadOrCreateCA(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := loadOrCreateCA(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.Equal(second) {
+		t.Error("second call created a new CA")
+	}
+}
+
+func TestServerConfigNeedsCAForClientCerts(t *testing.T) {
+	dir := mint(t, "registry")
+	c := tlsConfig(dir, "registry", true)
+	c.CAFile = ""
+	if _, err := c.ServerConfig(); err == nil {
+		t.Error("ServerConfig() requiring client certificates without a CA succeeded")
+	}
+}
@@ -0,0 +1,407 @@
+// Command registryctl inspects and administers the service registry.
+//
+//	registryctl [flags] list
+//	registryctl [flags] get <id>
+//	registryctl [flags] deregister <id>
+//	registryctl [flags] state <id> active|draining|maintenance
+//	registryctl [flags] health
+//	registryctl [flags] watch
+//	registryctl [flags] graph
+//	registryctl [flags] policy [<type> [<version>=<percent>...]]
+//
+// Flags may also follow the command. Exit codes:
+//
+//	0  success
+//	1  the request failed
+//	2  invalid usage
+//	3  nothing matched, or the service does not exist
+//	4  not authenticated or not authorized
+//	5  the registrar is unreachable or unavailable
+//	6  health found an instance that is not healthy
+package main
+
+import (
+	"context"
+	"demo/auth"
+	"demo/discovery"
+	"demo/registry"
+	"demo/server"
+	"demo/tracing"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	exitOK          = 0
+	exitError       = 1
+	exitUsage       = 2
+	exitNotFound    = 3
+	exitDenied      = 4
+	exitUnavailable = 5
+	exitUnhealthy   = 6
+)
+
+var (
+	registryAddr = flag.String("addr", envOr("REGISTRY_ADDR", "http://localhost:8080"), "Registrar base URL (or $REGISTRY_ADDR)")
+	key          = flag.String("key", os.Getenv("REGISTRY_KEY"), "Policy key to authenticate with (or $REGISTRY_KEY)")
+	keyHMAC      = flag.Bool("hmac", false, "Sign requests with -key instead of sending it as a bearer token")
+	tlsCert      = flag.String("tls-cert", "", "Client certificate file presented to a registrar that requires mutual TLS")
+	tlsKey       = flag.String("tls-key", "", "Private key file for -tls-cert")
+	tlsCA        = flag.String("tls-ca", "", "CA file used to verify the registrar")
+	output       = flag.String("o", "table", "Output format: table, json or yaml; graph also accepts dot")
+	serviceType  = flag.String("type", "", "Only show services of this type")
+	tag          = flag.String("tag", "", "Only show services labeled with this tag")
+	timeout      = flag.Duration("timeout", 10*time.Second, "Timeout of each request to the registrar")
+	interval     = flag.Duration("interval", 2*time.Second, "How long watch waits before reconnecting to the registrar")
+)
+
+var commands = map[string]func(ctx context.Context, c *discovery.Client, args []string) (int, error){
+	"list":       list,
+	"get":        get,
+	"deregister": deregister,
+	"state":      setState,
+	"health":     health,
+	"watch":      watch,
+	"graph":      graph,
+	"policy":     policy,
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: registryctl [flags] list | get <id> | deregister <id> | state <id> <state> | health | watch | graph | policy [<type> [<version>=<percent>...]]")
+		flag.PrintDefaults()
+	}
+	args := parseArgs()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "registryctl: unknown command %q\n", args[0])
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+	if !validOutput(args[0], *output) {
+		fmt.Fprintf(os.Stderr, "registryctl: unsupported output format %q\n", *output)
+		os.Exit(exitUsage)
+	}
+
+	client, err := newClient()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "registryctl:", err)
+		os.Exit(exitUsage)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	code, err := command(ctx, client, args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "registryctl:", err)
+	}
+	os.Exit(code)
+}
+
+// parseArgs parses flags anywhere on the command line and returns the
+// remaining arguments.
+func parseArgs() []string {
+	var args []string
+	rest := os.Args[1:]
+	for {
+		flag.CommandLine.Parse(rest)
+		rest = flag.Args()
+		if len(rest) == 0 {
+			return args
+		}
+		args = append(args, rest[0])
+		rest = rest[1:]
+	}
+}
+
+func newClient() (*discovery.Client, error) {
+	var tlsConfig *server.TLSConfig
+	if *tlsCert != "" || *tlsCA != "" {
+		tlsConfig = &server.TLSConfig{CertFile: *tlsCert, KeyFile: *tlsKey, CAFile: *tlsCA}
+	}
+	httpClient, err := server.NewClient(&tracing.Tracer{Service: "registryctl"}, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	httpClient.Timeout = *timeout
+
+	return &discovery.Client{
+		RegistryAddr: *registryAddr,
+		HTTPClient:   httpClient,
+		Signer:       auth.Signer{Secret: *key, HMAC: *keyHMAC},
+	}, nil
+}
+
+func list(ctx context.Context, c *discovery.Client, args []string) (int, error) {
+	if len(args) != 0 {
+		return exitUsage, errors.New("list takes no arguments")
+	}
+
+	services, err := c.Services(ctx, *serviceType, *tag)
+	if err != nil {
+		return exitCode(err), err
+	}
+	if err := printServices(services); err != nil {
+		return exitError, err
+	}
+	if len(services) == 0 {
+		return exitNotFound, nil
+	}
+	return exitOK, nil
+}
+
+func get(ctx context.Context, c *discovery.Client, args []string) (int, error) {
+	if len(args) != 1 {
+		return exitUsage, errors.New("get takes a service ID")
+	}
+
+	service, err := c.Service(ctx, args[0])
+	if err != nil {
+		return exitCode(err), err
+	}
+	if err := printService(service); err != nil {
+		return exitError, err
+	}
+	return exitOK, nil
+}
+
+func deregister(ctx context.Context, c *discovery.Client, args []string) (int, error) {
+	if len(args) != 1 {
+		return exitUsage, errors.New("deregister takes a service ID")
+	}
+
+	if err := c.Deregister(ctx, args[0]); err != nil {
+		return exitCode(err), err
+	}
+	fmt.Fprintf(os.Stderr, "Deregistered %s\n", args[0])
+	return exitOK, nil
+}
+
+func setState(ctx context.Context, c *discovery.Client, args []string) (int, error) {
+	if len(args) != 2 {
+		return exitUsage, errors.New("state takes a service ID and a state")
+	}
+	if !registry.ValidState(args[1]) {
+		return exitUsage, fmt.Errorf("invalid state %q: must be active, draining or maintenance", args[1])
+	}
+
+	service, err := c.SetState(ctx, args[0], args[1])
+	if err != nil {
+		return exitCode(err), err
+	}
+	if err := printService(service); err != nil {
+		return exitError, err
+	}
+	return exitOK, nil
+}
+
+func health(ctx context.Context, c *discovery.Client, args []string) (int, error) {
+	if len(args) != 0 {
+		return exitUsage, errors.New("health takes no arguments")
+	}
+
+	results, err := c.HealthChecks(ctx)
+	if err != nil {
+		return exitCode(err), err
+	}
+
+	// Health results carry no tags, so filter through the matching services.
+	if *serviceType != "" || *tag != "" {
+		services, err := c.Services(ctx, *serviceType, *tag)
+		if err != nil {
+			return exitCode(err), err
+		}
+		matched := make(map[string]bool, len(services))
+		for _, s := range services {
+			matched[s.ID] = true
+		}
+		filtered := []registry.HealthCheckResult{}
+		for _, r := range results {
+			if matched[r.ServiceID] {
+				filtered = append(filtered, r)
+			}
+		}
+		results = filtered
+	}
+
+	if err := printHealth(results); err != nil {
+		return exitError, err
+	}
+	if len(results) == 0 {
+		return exitNotFound, nil
+	}
+	for _, r := range results {
+		if !r.Healthy {
+			return exitUnhealthy, nil
+		}
+	}
+	return exitOK, nil
+}
+
+// watch prints registry events from the registrar's event stream, starting
+// with the recent ones, until interrupted. It reconnects when the stream
+// ends, so events published while it was disconnected that are no longer
+// among the recent ones are missed.
+func watch(ctx context.Context, c *discovery.Client, args []string) (int, error) {
+	if len(args) != 0 {
+		return exitUsage, errors.New("watch takes no arguments")
+	}
+
+	var last registry.Event
+	var printErr error
+	for {
+		err := c.StreamEvents(ctx, func(e registry.Event) error {
+			// Every connection replays the recent events; skip the ones already
+			// printed, unless the registrar restarted and numbers events anew.
+			if e.ID <= last.ID && !e.Time.After(last.Time) {
+				return nil
+			}
+			last = e
+			if !matchEvent(e) {
+				return nil
+			}
+			printErr = printEvent(e)
+			return printErr
+		})
+		switch {
+		case ctx.Err() != nil:
+			return exitOK, nil
+		case printErr != nil:
+			return exitError, printErr
+		case err != nil && last.ID == 0:
+			return exitCode(err), err
+		case err != nil:
+			// Keep watching through registrar restarts.
+			fmt.Fprintln(os.Stderr, "registryctl:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return exitOK, nil
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// matchEvent reports whether e concerns a service selected by -type and
+// -tag. Only events carrying a registration have tags to match.
+func matchEvent(e registry.Event) bool {
+	if *serviceType != "" && e.ServiceType != *serviceType {
+		return false
+	}
+	if *tag == "" {
+		return true
+	}
+	for _, r := range []*registry.Registration{e.Before, e.After} {
+		if r != nil && slices.Contains(r.Tags, *tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func graph(ctx context.Context, c *discovery.Client, args []string) (int, error) {
+	if len(args) != 0 {
+		return exitUsage, errors.New("graph takes no arguments")
+	}
+
+	g, err := c.Graph(ctx)
+	if err != nil {
+		return exitCode(err), err
+	}
+	if err := printGraph(g); err != nil {
+		return exitError, err
+	}
+	return exitOK, nil
+}
+
+// policy lists the traffic policies, sets the policy of a service type to
+// version=percent splits, or removes it when given no splits.
+func policy(ctx context.Context, c *discovery.Client, args []string) (int, error) {
+	if len(args) == 0 {
+		policies, err := c.TrafficPolicies(ctx)
+		if err != nil {
+			return exitCode(err), err
+		}
+		if err := printPolicies(policies); err != nil {
+			return exitError, err
+		}
+		if len(policies) == 0 {
+			return exitNotFound, nil
+		}
+		return exitOK, nil
+	}
+
+	p := registry.TrafficPolicy{ServiceType: args[0]}
+	for _, arg := range args[1:] {
+		version, percent, ok := strings.Cut(arg, "=")
+		n, err := strconv.Atoi(percent)
+		if !ok || err != nil {
+			return exitUsage, fmt.Errorf("invalid split %q: must be <version>=<percent>", arg)
+		}
+		if p.Splits == nil {
+			p.Splits = make(map[string]int)
+		}
+		p.Splits[version] = n
+	}
+	if len(p.Splits) > 0 {
+		if err := p.Validate(); err != nil {
+			return exitUsage, err
+		}
+	}
+
+	if err := c.SetTrafficPolicy(ctx, p); err != nil {
+		return exitCode(err), err
+	}
+	if len(p.Splits) == 0 {
+		fmt.Fprintf(os.Stderr, "Removed traffic policy of %s\n", p.ServiceType)
+		return exitOK, nil
+	}
+	if err := printPolicies([]registry.TrafficPolicy{p}); err != nil {
+		return exitError, err
+	}
+	return exitOK, nil
+}
+
+// exitCode maps a failed request to the exit code scripts can act on.
+func exitCode(err error) int {
+	var statusErr *discovery.StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusNotFound:
+			return exitNotFound
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return exitDenied
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return exitUnavailable
+		}
+		return exitError
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return exitUnavailable
+	}
+	return exitError
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"demo/registry"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func validOutput(command, format string) bool {
+	switch format {
+	case "table", "json", "yaml":
+		return true
+	case "dot":
+		return command == "graph"
+	}
+	return false
+}
+
+// printValue prints v as JSON or YAML; table output is up to the caller.
+func printValue(v any) error {
+	if *output == "yaml" {
+		return writeYAML(os.Stdout, v)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func printServices(services []registry.Registration) error {
+	if *output != "table" {
+		if services == nil {
+			services = []registry.Registration{}
+		}
+		return printValue(services)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTYPE\tADDRESS\tSTATE\tVERSION\tWEIGHT\tTAGS\tREQUIRES")
+	for _, s := range services {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", s.ID, s.ServiceType, address(s), state(s), orDash(s.Version), weight(s), joinOrDash(s.Tags), joinOrDash(s.RequiredServices))
+	}
+	return tw.Flush()
+}
+
+func printService(s *registry.Registration) error {
+	if *output != "table" {
+		return printValue(s)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID:\t%s\n", s.ID)
+	fmt.Fprintf(tw, "Type:\t%s\n", s.ServiceType)
+	fmt.Fprintf(tw, "Address:\t%s\n", address(*s))
+	fmt.Fprintf(tw, "State:\t%s\n", state(*s))
+	fmt.Fprintf(tw, "Version:\t%s\n", orDash(s.Version))
+	fmt.Fprintf(tw, "Weight:\t%d\n", weight(*s))
+	fmt.Fprintf(tw, "Tags:\t%s\n", joinOrDash(s.Tags))
+	fmt.Fprintf(tw, "Requires:\t%s\n", joinOrDash(s.RequiredServices))
+	fmt.Fprintf(tw, "Health check:\t%s\n", s.HealthCheckEndpoint)
+	fmt.Fprintf(tw, "Notifications:\t%s\n", s.NotificationEndpoint)
+	return tw.Flush()
+}
+
+func printHealth(results []registry.HealthCheckResult) error {
+	if *output != "table" {
+		if results == nil {
+			results = []registry.HealthCheckResult{}
+		}
+		return printValue(results)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTYPE\tSTATUS\tMESSAGE")
+	for _, r := range results {
+		status := r.Status
+		if status == "" {
+			status = "ok"
+			if !r.Healthy {
+				status = "unhealthy"
+			}
+		}
+		message := r.Message
+		for _, c := range r.Components {
+			if c.Status != "ok" {
+				message = strings.TrimPrefix(message+"; "+c.Name+": "+c.Message, "; ")
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.ServiceID, r.ServiceType, status, message)
+	}
+	return tw.Flush()
+}
+
+// printEvent prints one line per event in table mode, one JSON object per
+// line in JSON mode and one document per event in YAML mode.
+func printEvent(e registry.Event) error {
+	switch *output {
+	case "json":
+		return json.NewEncoder(os.Stdout).Encode(e)
+	case "yaml":
+		fmt.Println("---")
+		return writeYAML(os.Stdout, e)
+	}
+	_, err := fmt.Printf("%s  %-10s  %-12s  %-12s  %s\n", e.Time.Format(time.TimeOnly), e.Type, orDash(e.ServiceID), e.ServiceType, eventDetail(e))
+	return err
+}
+
+// eventDetail summarizes what an event changed.
+func eventDetail(e registry.Event) string {
+	switch {
+	case e.Type == registry.EventHealthChanged:
+		return orDash(e.PreviousHealth) + " -> " + e.Health
+	case e.Type == registry.EventPolicyChanged:
+		if e.Policy == nil {
+			return "removed"
+		}
+		return formatSplits(*e.Policy)
+	case e.Before != nil && e.After != nil && state(*e.Before) != state(*e.After):
+		return state(*e.Before) + " -> " + state(*e.After)
+	case e.After != nil:
+		return address(*e.After)
+	case e.Before != nil:
+		return address(*e.Before)
+	}
+	return ""
+}
+
+func printGraph(g *registry.Graph) error {
+	switch *output {
+	case "dot":
+		_, err := fmt.Print(g.DOT())
+		return err
+	case "json", "yaml":
+		return printValue(g)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tINSTANCES\tREQUIRES\tUNSATISFIED")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", n.ServiceType, n.Instances, joinOrDash(n.Requires), joinOrDash(n.Unsatisfied))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, cycle := range g.Cycles {
+		fmt.Printf("\nWarning: dependency cycle between %s\n", strings.Join(cycle, ", "))
+	}
+	return nil
+}
+
+func printPolicies(policies []registry.TrafficPolicy) error {
+	if *output != "table" {
+		if policies == nil {
+			policies = []registry.TrafficPolicy{}
+		}
+		return printValue(policies)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tSPLITS")
+	for _, p := range policies {
+		fmt.Fprintf(tw, "%s\t%s\n", p.ServiceType, formatSplits(p))
+	}
+	return tw.Flush()
+}
+
+// formatSplits lists p's splits by version, e.g. "v1=90% v2=10%".
+func formatSplits(p registry.TrafficPolicy) string {
+	versions := make([]string, 0, len(p.Splits))
+	for version := range p.Splits {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	splits := make([]string, len(versions))
+	for i, version := range versions {
+		splits[i] = fmt.Sprintf("%s=%d%%", version, p.Splits[version])
+	}
+	return strings.Join(splits, " ")
+}
+
+func address(s registry.Registration) string {
+	return registry.ConnectedInstance{IP: s.IP, Port: s.Port, Scheme: s.Scheme}.URL("")
+}
+
+func state(s registry.Registration) string {
+	if s.State == "" {
+		return registry.StateActive
+	}
+	return s.State
+}
+
+func weight(s registry.Registration) int {
+	if s.Weight <= 0 {
+		return 1
+	}
+	return s.Weight
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func joinOrDash(items []string) string {
+	if len(items) == 0 {
+		return "-"
+	}
+	return strings.Join(items, ",")
+}
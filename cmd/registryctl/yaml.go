@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// writeYAML writes v as YAML. v is encoded through its JSON form, so field
+// names and order match the JSON output.
+func writeYAML(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	root, err := decodeYAMLNode(dec)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	if s, ok := root.inline(); ok {
+		b.WriteString(s + "\n")
+	} else {
+		root.write(&b, 0)
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// yamlNode is a decoded JSON value: a mapping ('{'), a sequence ('[') or a
+// scalar already rendered as YAML.
+type yamlNode struct {
+	kind   byte
+	keys   []string
+	items  []*yamlNode
+	scalar string
+}
+
+func decodeYAMLNode(dec *json.Decoder) (*yamlNode, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		n := &yamlNode{kind: byte(t)}
+		for dec.More() {
+			if n.kind == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				n.keys = append(n.keys, key.(string))
+			}
+			item, err := decodeYAMLNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, item)
+		}
+		// Consume the closing delimiter.
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case string:
+		return &yamlNode{scalar: yamlString(t)}, nil
+	case json.Number:
+		return &yamlNode{scalar: t.String()}, nil
+	case bool:
+		return &yamlNode{scalar: strconv.FormatBool(t)}, nil
+	default:
+		return &yamlNode{scalar: "null"}, nil
+	}
+}
+
+// inline returns the node on a single line, which works for scalars and
+// empty collections.
+func (n *yamlNode) inline() (string, bool) {
+	switch {
+	case n.kind == 0:
+		return n.scalar, true
+	case len(n.items) > 0:
+		return "", false
+	case n.kind == '{':
+		return "{}", true
+	default:
+		return "[]", true
+	}
+}
+
+func (n *yamlNode) write(b *strings.Builder, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for i, item := range n.items {
+		s, inline := item.inline()
+
+		if n.kind == '{' {
+			key := yamlString(n.keys[i])
+			if inline {
+				fmt.Fprintf(b, "%s%s: %s\n", indent, key, s)
+			} else {
+				fmt.Fprintf(b, "%s%s:\n", indent, key)
+				item.write(b, depth+1)
+			}
+			continue
+		}
+
+		if inline {
+			fmt.Fprintf(b, "%s- %s\n", indent, s)
+			continue
+		}
+		// Write the item one level deeper and start its first line with the dash.
+		var nested strings.Builder
+		item.write(&nested, depth+1)
+		b.WriteString(indent + "- " + nested.String()[len(indent)+2:])
+	}
+}
+
+// yamlString returns s as a YAML scalar, quoted when it would otherwise be
+// read as another type or break the syntax. YAML 1.1 readers are assumed, so
+// "y", "0x1F", "1_000" and dates are quoted too.
+func yamlString(s string) string {
+	quote := s == "" ||
+		strings.TrimSpace(s) != s ||
+		strings.ContainsAny(s, ":#{}[],&*?|<>=!%@`\"'\\\n\t") ||
+		strings.HasPrefix(s, "-") ||
+		strings.HasPrefix(s, ".") ||
+		numberLike(s) ||
+		strings.IndexFunc(s, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0
+
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "y", "n", "on", "off", "null", "~":
+		quote = true
+	}
+
+	if !quote {
+		return s
+	}
+	// JSON string escapes are valid in YAML double-quoted scalars.
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// numberLike reports whether s could be read as a number or date: it starts
+// like one and only uses digits, signs, separators and the letters of hex,
+// octal, binary and exponent notation.
+func numberLike(s string) bool {
+	if s == "" || !strings.ContainsRune("0123456789+", rune(s[0])) {
+		return false
+	}
+	return strings.Trim(s, "0123456789abcdefABCDEFoOxX_.:+-") == ""
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestYAMLString(t *testing.T) {
+	tests := []struct {
+		in     string
+		quoted bool
+	}{
+		{"Logging", false},
+		{"logging-8081", false},
+		{"eu-west", false},
+		{"v2 canary", false},
+		{"", true},
+		{" padded", true},
+		{"yes", true},
+		{"No", true},
+		{"y", true},
+		{"off", true},
+		{"null", true},
+		{"~", true},
+		{"1.0", true},
+		{"42", true},
+		{"1e3", true},
+		{"+1", true},
+		{"0x1F", true},
+		{"0o17", true},
+		{"1_000", true},
+		{"2026-10-19", true},
+		{".inf", true},
+		{".nan", true},
+		{"...", true},
+		{": ", true},
+		{"key: value", true},
+		{"-", true},
+		{"- item", true},
+		{"---", true},
+		{"#comment", true},
+		{"a # b", true},
+		{"line one\nline two", true},
+		{"tab\there", true},
+		{"bell\a", true},
+		{`say "hi"`, true},
+		{"it's", true},
+		{"*alias", true},
+		{"&anchor", true},
+		{"!tag", true},
+		{"[1, 2]", true},
+		{"{a: b}", true},
+		{"|", true},
+		{">", true},
+		{"@at", true},
+		{"%TAG", true},
+		{"<b>", true},
+	}
+
+	for _, tt := range tests {
+		got := yamlString(tt.in)
+		if quoted := strings.HasPrefix(got, `"`); quoted != tt.quoted {
+			t.Errorf("yamlString(%q) = %s, quoted %v, want %v", tt.in, got, quoted, tt.quoted)
+			continue
+		}
+		if back := unquoteYAML(t, got); back != tt.in {
+			t.Errorf("yamlString(%q) = %s, reads back as %q", tt.in, got, back)
+		}
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	v := map[string]any{
+		"id":    "logging-8081",
+		"port":  8081,
+		"ready": true,
+		"owner": nil,
+		"tags":  []string{"yes", "1.0", "- dash", "#hash"},
+		"meta": map[string]string{
+			"note":    "first\nsecond",
+			"version": "1.0",
+			"on":      "off",
+		},
+		"routes": []map[string]any{
+			{"path": "/log", "weight": 90},
+			{"path": "/log: canary", "weight": 10},
+		},
+		"empty": []string{},
+		"none":  map[string]string{},
+	}
+
+	var b strings.Builder
+	if err := writeYAML(&b, v); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `empty: []
+id: logging-8081
+meta:
+  note: "first\nsecond"
+  "on": "off"
+  version: "1.0"
+none: {}
+owner: null
+port: 8081
+ready: true
+routes:
+  - path: /log
+    weight: 90
+  - path: "/log: canary"
+    weight: 10
+tags:
+  - "yes"
+  - "1.0"
+  - "- dash"
+  - "#hash"
+`
+	if b.String() != want {
+		t.Errorf("writeYAML:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestWriteYAMLScalarRoot(t *testing.T) {
+	tests := []struct {
+		in   any
+		want string
+	}{
+		{"plain", "plain\n"},
+		{"true", "\"true\"\n"},
+		{7, "7\n"},
+		{[]string{}, "[]\n"},
+		{[][]string{{"a", "b"}, {"c"}}, "- - a\n  - b\n- - c\n"},
+	}
+
+	for _, tt := range tests {
+		var b strings.Builder
+		if err := writeYAML(&b, tt.in); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != tt.want {
+			t.Errorf("writeYAML(%#v) = %q, want %q", tt.in, b.String(), tt.want)
+		}
+	}
+}
+
+// unquoteYAML reads a scalar written by yamlString. Double-quoted scalars use
+// JSON escapes, which YAML shares; plain scalars are read as they are.
+func unquoteYAML(t *testing.T, s string) string {
+	t.Helper()
+	if !strings.HasPrefix(s, `"`) {
+		return s
+	}
+	var out string
+	if err := json.Unmarshal([]byte(s), &out); err != nil {
+		t.Fatalf("unquote %s: %v", s, err)
+	}
+	return out
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
@@ -9,13 +10,28 @@ import (
 // HTTPSender is an implementation of the Sender interface using HTTP.
 type HTTPLogger struct {
 	Endpoint string
+
+	// Client sends the requests. Nil uses http.DefaultClient. A client from
+	// resilience.Policy.Client fails fast while the logging instance is down.
+	Client *http.Client
 }
 
 // Send sends the given message to the specified endpoint using an HTTP POST request.
-func (hs *HTTPLogger) Log(message string) error {
-	resp, err := http.Post(hs.Endpoint, "application/text", strings.NewReader(message))
+func (hs *HTTPLogger) Log(ctx context.Context, message string) error {
+	client := hs.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hs.Endpoint, strings.NewReader(message))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/text")
+
+	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to make HTTP request: %v", err)
+		return fmt.Errorf("failed to make HTTP request: %w", err)
 	}
 	defer resp.Body.Close()
 
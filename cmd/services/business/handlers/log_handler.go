@@ -1,17 +1,22 @@
 package handlers
 
 import (
+	"demo/resilience"
+	"demo/server"
+	"errors"
 	"io"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 )
 
+// LogHandler forwards messages to the connected Logging instance. Its routes
+// must be wrapped with server.RequireDependency("Logging").
 type LogHandler struct {
 	Logger HTTPLogger
 }
 
-func (bh *LogHandler) RegisterRoutes(r *chi.Mux) {
+func (bh *LogHandler) RegisterRoutes(r chi.Router) {
 	r.Post("/log", bh.HandleLog)
 }
 
@@ -23,7 +28,20 @@ func (bh *LogHandler) HandleLog(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := bh.Logger.Log(string(msg)); err != nil {
+	instance, ok := server.Dependency(r.Context(), "Logging")
+	if !ok {
+		http.Error(w, "Logging service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	logger := bh.Logger
+	logger.Endpoint = instance.URL("/log")
+
+	if err := logger.Log(r.Context(), string(msg)); err != nil {
+		if errors.Is(err, resilience.ErrOpen) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Logging service unavailable", http.StatusServiceUnavailable)
+			return
+		}
 		http.Error(w, "Error handling log", http.StatusInternalServerError)
 		return
 	}
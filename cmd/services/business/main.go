@@ -1,12 +1,20 @@
 package main
 
 import (
+	"demo/auth"
 	"demo/cmd/services/business/handlers"
+	"demo/discovery"
+	"demo/logr"
 	"demo/registry"
+	"demo/resilience"
 	"demo/server"
+	"demo/tracing"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
+	"os"
 	"sync"
 	"time"
 
@@ -14,12 +22,121 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 )
 
+// setupLogging ships logs to the connected Logging instance, falling back to
+// stdout. Sampling keeps a noisy message from flooding the logging service.
+// Records are shipped untraced, over TLS when the server uses it.
+func setupLogging(s *server.Server, level slog.Leveler) error {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if s.TLS != nil {
+		cfg, err := s.TLS.ClientConfig()
+		if err != nil {
+			return err
+		}
+		transport.TLSClientConfig = cfg
+	}
+	client := &http.Client{Timeout: 2 * time.Second, Transport: transport}
+
+	remote := logr.NewRemoteHandler(func() (string, bool) {
+		return s.InstanceEndpoint("Logging", "/log")
+	}, client, &slog.HandlerOptions{Level: level})
+	sampled := logr.NewSamplingHandler(remote, logr.Sampling{First: 100, Thereafter: 100, Tick: time.Second})
+	logger := slog.New(server.NewRequestIDHandler(sampled))
+	slog.SetDefault(logger.With("service", s.ServiceType))
+	// SetDefault routes the log package through the remote handler, which
+	// only queues records; log.Fatal would exit before they ship. Keep it
+	// writing to stderr directly.
+	log.SetOutput(os.Stderr)
+	return nil
+}
+
 func main() {
 	port := flag.Int("port", 8082, "Port for the HTTP server")
 	registrationAddr := flag.String("registration-addr", "http://localhost:8080/register", "Registration service endpoint")
 	deregistrationAddr := flag.String("deregistration-addr", "http://localhost:8080/deregister", "Deregistration service endpoint")
+	stateAddr := flag.String("state-addr", "http://localhost:8080/services", "Endpoint this instance sets its state at; drains on shutdown unless empty")
+	drainPeriod := flag.Duration("drain-period", 2*time.Second, "How long to drain on shutdown before deregistering")
+	logLevel := flag.String("log-level", "INFO", "Minimum level of records shipped to the logging service")
+	authSecret := flag.String("auth-secret", "", "Secret this service authenticates its registration with")
+	authHMAC := flag.Bool("auth-hmac", false, "Sign registration requests with the secret instead of sending it as a bearer token")
+	traceExport := flag.String("trace-export", "", `Export spans as JSON lines to "stdout" or a file path (empty to disable)`)
+	tlsCert := flag.String("tls-cert", "", "Certificate file; enables HTTPS and is presented as client certificate on outgoing calls")
+	tlsKey := flag.String("tls-key", "", "Private key file for -tls-cert")
+	tlsCA := flag.String("tls-ca", "", "CA file used to verify other services and, with -tls-client-auth, their client certificates")
+	tlsClientAuth := flag.Bool("tls-client-auth", false, "Require client certificates signed by -tls-ca (mutual TLS)")
+	rateLimit := flag.Float64("rate-limit", 0, "Requests per second each client IP may make (0 disables rate limiting)")
+	rateBurst := flag.Int("rate-burst", 20, "Requests a client IP may make at once before -rate-limit applies")
+	maxBodyBytes := flag.Int64("max-body-bytes", 1<<20, "Largest request body accepted (0 disables the limit)")
+	maxConcurrent := flag.Int("max-concurrent", 0, "Requests handled at once across all clients (0 disables the limit)")
+	registryAddr := flag.String("registry-addr", "http://localhost:8080", "Registrar base URL used to discover dependencies")
+	discoveryCache := flag.String("discovery-cache", "", "Directory caching discovered instances across restarts (empty to disable)")
+	depTimeout := flag.Duration("dependency-timeout", 2*time.Second, "Timeout of each attempt to call a dependency")
+	depAttempts := flag.Int("dependency-attempts", 3, "Attempts per call to a dependency, including the first")
+	depHedge := flag.Duration("dependency-hedge", 0, "Send a second idempotent request to a dependency if the first is slower than this (0 disables hedging)")
+	tags := flag.String("tags", "", "Comma-separated tags this instance registers with, e.g. eu-west,canary")
+	version := flag.String("version", "", "Version this instance registers with, which traffic policies split requests by")
+	weight := flag.Int("weight", 1, "Share of the requests to its version this instance receives, relative to the others")
+	describe := flag.Bool("describe", false, "Print the service type, required services and health check endpoint as JSON and exit")
 	flag.Parse()
 
+	var tlsConfig *server.TLSConfig
+	if *tlsCert != "" {
+		tlsConfig = &server.TLSConfig{CertFile: *tlsCert, KeyFile: *tlsKey, CAFile: *tlsCA, RequireClientCert: *tlsClientAuth}
+	}
+	scheme := tlsConfig.Scheme()
+
+	serviceType, requiredServices := "Business", []string{"Logging"}
+	healthCheckEndpoint := fmt.Sprintf("%s://localhost:%d/healthcheck", scheme, *port)
+	if *describe {
+		if err := server.Describe(os.Stdout, server.Description{
+			ServiceType:         serviceType,
+			RequiredServices:    requiredServices,
+			HealthCheckEndpoint: healthCheckEndpoint,
+		}); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	exporter, err := tracing.NewExporter(*traceExport)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	level := new(slog.LevelVar)
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		log.Fatal(err)
+	}
+
+	tracer := &tracing.Tracer{Service: "Business", Exporter: exporter}
+	client, err := server.NewClient(tracer, tlsConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	deps := &resilience.Policy{
+		Timeout:     *depTimeout,
+		MaxAttempts: *depAttempts,
+		Backoff:     100 * time.Millisecond,
+		Budget:      &resilience.RetryBudget{},
+		HedgeDelay:  *depHedge,
+		Breakers: &resilience.Breakers{New: func(instance string) *resilience.Breaker {
+			return &resilience.Breaker{OnStateChange: func(from, to resilience.State) {
+				log.Printf("Circuit breaker for %s changed from %s to %s", instance, from, to)
+			}}
+		}},
+		// A duplicated log line beats a lost one.
+		RetryNonIdempotent: true,
+	}
+	resolver := &discovery.Client{
+		RegistryAddr: *registryAddr,
+		HTTPClient:   client,
+		TTL:          time.Second,
+		CacheDir:     *discoveryCache,
+		// Under a registrar -policy-file, discovery is authorized by the
+		// key named after this service type.
+		Signer: auth.Signer{Secret: *authSecret, HMAC: *authHMAC},
+	}
+
 	router := chi.NewRouter()
 	router.Use(middleware.Logger)
 
@@ -27,48 +144,43 @@ func main() {
 		Router:               router,
 		RegistrationAddr:     *registrationAddr,
 		DeregistrationAddr:   *deregistrationAddr,
+		StateAddr:            *stateAddr,
+		DrainPeriod:          *drainPeriod,
 		Port:                 *port,
-		ServiceType:          "Business",
-		RequiredServices:     []string{"Logging"},
-		ConnectedInstances:   make(registry.ConnectedInstances),
-		NotificationEndpoint: fmt.Sprintf("http://localhost:%d/notify", *port),
-		HealthCheckEndpoint: fmt.Sprintf("http://localhost:%d/healthcheck", *port),
-
+		ServiceType:          serviceType,
+		RequiredServices:     requiredServices,
+		Tags:                 registry.ParseTags(*tags),
+		Version:              *version,
+		Weight:               *weight,
+		NotificationEndpoint: fmt.Sprintf("%s://localhost:%d/notify", scheme, *port),
+		HealthCheckEndpoint:  healthCheckEndpoint,
+		Signer:               auth.Signer{Secret: *authSecret, HMAC: *authHMAC},
+		LogLevel:             level,
+		Tracer:               tracer,
+		Client:               client,
+		Dependencies:         deps,
+		Discovery:            resolver,
+		TLS:                  tlsConfig,
+		Limits: &server.Limits{
+			Rate:          *rateLimit,
+			Burst:         *rateBurst,
+			MaxBodyBytes:  *maxBodyBytes,
+			MaxConcurrent: *maxConcurrent,
+		},
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-
-	// Start a goroutine to dynamically update the loggingServiceURL
-	go func() {
-		defer wg.Done()
-
-		// Create an HTTPLogger with an empty endpoint initially
-		logger := handlers.HTTPLogger{}
-
-		// Assume we are waiting for the Logging service to connect
-		for {
-			// Access the ConnectedInstances to get the URL of the Logging service
-			if loggingInstance, exists := server.ConnectedInstances["Logging"]; exists {
-				// Update the HTTPLogger with the correct endpoint
-				logger.Endpoint = fmt.Sprintf("http://%s:%d/log", loggingInstance.IP, loggingInstance.Port)
-
-				handler := handlers.LogHandler{
-					Logger: logger,
-				}
-
-				handler.RegisterRoutes(router)
-
-				break
-			}
-
-			log.Println("Waiting for the Logging service to connect...")
+	if err := setupLogging(server, level); err != nil {
+		log.Fatal(err)
+	}
 
-			// Sleep for a short duration before retrying
-			time.Sleep(1 * time.Second)
-		}
-	}()
+	// /log answers 503 until a Logging instance is connected and always
+	// forwards to the instance connected at the time of the request.
+	logHandler := &handlers.LogHandler{
+		Logger: handlers.HTTPLogger{Client: server.DependencyClient()},
+	}
+	logHandler.RegisterRoutes(router.With(server.RequireDependency("Logging")))
 
+	var wg sync.WaitGroup
 	wg.Add(1)
 
 	go func() {
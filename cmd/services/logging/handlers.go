@@ -2,31 +2,43 @@ package main
 
 import (
 	"demo/logr"
+	"demo/metrics"
+	"demo/server"
+	"encoding/json"
 	"io"
+	"log/slog"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 )
 
 type LogHandler struct {
 	Logger *logr.Logger
+
+	// Recent, when set, is served on GET /log/recent.
+	Recent *logr.RingBuffer
+
+	// Quota, when set, rejects new records once the log storage quota is exhausted.
+	Quota *logr.Janitor
+
+	// Ingested, when set, counts records received on /log.
+	Ingested *metrics.CounterVec
 }
 
 func (rh *LogHandler) RegisterRoutes(r *chi.Mux) {
 	r.Post("/log", rh.HandleLog)
-}
-
-func DefaultLogToFileHandler(path string) (*LogHandler, error) {
-	l, err := logr.DefaultFileLogger(path)
-	if err != nil {
-		return nil, err
+	if rh.Recent != nil {
+		r.Get("/log/recent", rh.HandleRecent)
 	}
-	return &LogHandler{
-		Logger: l,
-	}, nil
 }
 
 func (h *LogHandler) HandleLog(w http.ResponseWriter, r *http.Request) {
+	if h.Quota != nil && h.Quota.OverQuota() {
+		http.Error(w, "log storage quota exceeded", http.StatusInsufficientStorage)
+		return
+	}
+
 	msg, err := io.ReadAll(r.Body)
 
 	if err != nil || len(msg) == 0 {
@@ -34,8 +46,37 @@ func (h *LogHandler) HandleLog(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.Logger.Info(string(msg))
+	entry := logr.ParseEntry(msg)
+	if id := middleware.GetReqID(r.Context()); id != "" && !hasAttr(entry, server.RequestIDKey) {
+		entry.Attrs = append(entry.Attrs, slog.String(server.RequestIDKey, id))
+	}
+
+	if err := h.Logger.Write(r.Context(), entry); err != nil {
+		http.Error(w, "Error handling log", http.StatusInternalServerError)
+		return
+	}
+	if h.Ingested != nil {
+		h.Ingested.With("http").Inc()
+	}
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"message": "Log received successfully"}`))
 }
+
+// HandleRecent returns the records kept in the in-memory ring buffer.
+func (h *LogHandler) HandleRecent(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.Recent.Entries()); err != nil {
+		http.Error(w, "failed to encode recent logs", http.StatusInternalServerError)
+		return
+	}
+}
+
+func hasAttr(e logr.Entry, key string) bool {
+	for _, a := range e.Attrs {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"demo/logr"
+	"demo/metrics"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strconv"
+)
+
+// parseFunc decodes one framed message into a log entry.
+type parseFunc func([]byte) (logr.Entry, error)
+
+// Ingester feeds records received over syslog and GELF listeners into the
+// logging service's logger.
+type Ingester struct {
+	Logger *logr.Logger
+
+	// Quota, when set, drops new records once the log storage quota is exhausted.
+	Quota *logr.Janitor
+
+	// Ingested, when set, counts ingested records by source protocol.
+	Ingested *metrics.CounterVec
+
+	closers []io.Closer
+}
+
+// ListenSyslogUDP accepts RFC 5424 messages, one per datagram.
+func (in *Ingester) ListenSyslogUDP(addr string) error {
+	return in.listenUDP(addr, "syslog", nil, logr.ParseSyslog)
+}
+
+// ListenSyslogTCP accepts RFC 5424 messages framed by octet counting or
+// newlines (RFC 6587).
+func (in *Ingester) ListenSyslogTCP(addr string) error {
+	return in.listenTCP(addr, "syslog", splitSyslog, logr.ParseSyslog)
+}
+
+// ListenGELFUDP accepts GELF messages, optionally compressed and chunked.
+func (in *Ingester) ListenGELFUDP(addr string) error {
+	return in.listenUDP(addr, "gelf", &logr.GELFAssembler{}, logr.ParseGELF)
+}
+
+// ListenGELFTCP accepts null-byte delimited GELF messages.
+func (in *Ingester) ListenGELFTCP(addr string) error {
+	return in.listenTCP(addr, "gelf", splitNull, logr.ParseGELF)
+}
+
+// Close stops all listeners.
+func (in *Ingester) Close() error {
+	var errs []error
+	for _, c := range in.closers {
+		errs = append(errs, c.Close())
+	}
+	in.closers = nil
+	return errors.Join(errs...)
+}
+
+func (in *Ingester) listenUDP(addr, source string, assembler *logr.GELFAssembler, parse parseFunc) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	in.closers = append(in.closers, conn)
+	log.Printf("Ingesting UDP messages on %s", conn.LocalAddr())
+
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				log.Println("Failed to read UDP message:", err)
+				continue
+			}
+
+			msg := buf[:n]
+			if assembler != nil {
+				var complete bool
+				if msg, complete = assembler.Add(msg); !complete {
+					continue
+				}
+			}
+			in.ingest(source, msg, parse)
+		}
+	}()
+
+	return nil
+}
+
+func (in *Ingester) listenTCP(addr, source string, split bufio.SplitFunc, parse parseFunc) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	in.closers = append(in.closers, ln)
+	log.Printf("Ingesting TCP messages on %s", ln.Addr())
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				log.Println("Failed to accept TCP connection:", err)
+				continue
+			}
+
+			go func() {
+				defer conn.Close()
+
+				scanner := bufio.NewScanner(conn)
+				scanner.Buffer(make([]byte, 4096), logr.MaxIngestMessage)
+				scanner.Split(split)
+				for scanner.Scan() {
+					in.ingest(source, scanner.Bytes(), parse)
+				}
+				if err := scanner.Err(); err != nil {
+					log.Println("Failed to read TCP message:", err)
+				}
+			}()
+		}
+	}()
+
+	return nil
+}
+
+func (in *Ingester) ingest(source string, msg []byte, parse parseFunc) {
+	if len(bytes.TrimSpace(msg)) == 0 {
+		return
+	}
+	if in.Quota != nil && in.Quota.OverQuota() {
+		return
+	}
+
+	entry, err := parse(msg)
+	if err != nil {
+		log.Println("Failed to parse ingested message:", err)
+		return
+	}
+
+	if err := in.Logger.Write(context.Background(), entry); err != nil {
+		log.Println("Failed to write ingested message:", err)
+		return
+	}
+	if in.Ingested != nil {
+		in.Ingested.With(source).Inc()
+	}
+}
+
+// splitSyslog splits a syslog TCP stream using octet-counting framing when a
+// frame starts with a digit and newline framing otherwise.
+func splitSyslog(data []byte, atEOF bool) (int, []byte, error) {
+	if len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if data[0] >= '0' && data[0] <= '9' {
+		sp := bytes.IndexByte(data, ' ')
+		if sp < 0 {
+			if atEOF {
+				return 0, nil, errors.New("truncated syslog frame length")
+			}
+			return 0, nil, nil
+		}
+		n, err := strconv.Atoi(string(data[:sp]))
+		if err != nil || n <= 0 || n > logr.MaxIngestMessage {
+			return 0, nil, errors.New("invalid syslog frame length")
+		}
+		if len(data) < sp+1+n {
+			if atEOF {
+				return 0, nil, errors.New("truncated syslog frame")
+			}
+			return 0, nil, nil
+		}
+		return sp + 1 + n, data[sp+1 : sp+1+n], nil
+	}
+
+	return bufio.ScanLines(data, atEOF)
+}
+
+// splitNull splits a stream on null bytes, as used by GELF over TCP.
+func splitNull(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"demo/logr"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestIngestListeners(t *testing.T) {
+	gelfChunk := func(seq, count byte, data string) string {
+		packet := binary.BigEndian.AppendUint64([]byte{0x1e, 0x0f}, 42)
+		return string(append(append(packet, seq, count), data...))
+	}
+
+	tests := []struct {
+		name    string
+		listen  func(in *Ingester) error
+		network string
+		writes  []string // one datagram or stream write each
+		want    []string // messages expected in the log
+	}{
+		{
+			name:    "syslog over UDP",
+			listen:  func(in *Ingester) error { return in.ListenSyslogUDP("127.0.0.1:0") },
+			network: "udp",
+			writes:  []string{`<14>1 - - Business - - [attrs@32473 user="ann"] first`, "<14>1 - - Business - - - second"},
+			want:    []string{"first", "second"},
+		},
+		{
+			name:    "syslog over TCP with octet counting and newlines",
+			listen:  func(in *Ingester) error { return in.ListenSyslogTCP("127.0.0.1:0") },
+			network: "tcp",
+			writes:  []string{"30 <14>1 - - Business - - - first", "<14>1 - - Business - - - second\n<14>1 - - Business - - - third\n"},
+			want:    []string{"first", "second", "third"},
+		},
+		{
+			name:    "GELF over UDP, chunked",
+			listen:  func(in *Ingester) error { return in.ListenGELFUDP("127.0.0.1:0") },
+			network: "udp",
+			writes:  []string{gelfChunk(0, 2, `{"short_message":`), gelfChunk(1, 2, `"first","_service":"Business"}`), `{"short_message":"second"}`},
+			want:    []string{"first", "second"},
+		},
+		{
+			name:    "GELF over TCP",
+			listen:  func(in *Ingester) error { return in.ListenGELFTCP("127.0.0.1:0") },
+			network: "tcp",
+			writes:  []string{"{\"short_message\":\"first\"}\x00{\"short_message\":", "\"second\"}\x00"},
+			want:    []string{"first", "second"},
+		},
+		{
+			name:    "invalid messages are skipped",
+			listen:  func(in *Ingester) error { return in.ListenSyslogUDP("127.0.0.1:0") },
+			network: "udp",
+			writes:  []string{"not syslog", "<14>1 - - Business - - - valid"},
+			want:    []string{"valid"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rb := logr.NewRingBuffer(10)
+			logger, err := logr.NewLogWriter(logr.WithRingBuffer(rb))
+			if err != nil {
+				t.Fatal(err)
+			}
+			in := &Ingester{Logger: logger}
+			if err := tt.listen(in); err != nil {
+				t.Fatal(err)
+			}
+			defer in.Close()
+
+			conn, err := net.Dial(tt.network, listenAddr(in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			for _, w := range tt.writes {
+				if _, err := conn.Write([]byte(w)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got := waitForMessages(rb, len(tt.want))
+			if len(got) != len(tt.want) {
+				t.Fatalf("logged %q, want %q", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("message %d = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// listenAddr returns the address of the listener in started last.
+func listenAddr(in *Ingester) string {
+	switch l := in.closers[len(in.closers)-1].(type) {
+	case net.PacketConn:
+		return l.LocalAddr().String()
+	case net.Listener:
+		return l.Addr().String()
+	}
+	return ""
+}
+
+// waitForMessages returns the messages in rb once it holds n records, or
+// whatever it holds after two seconds.
+func waitForMessages(rb *logr.RingBuffer, n int) []string {
+	deadline := time.Now().Add(2 * time.Second)
+	for len(rb.Entries()) < n && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Give stray records a moment to show up.
+	time.Sleep(50 * time.Millisecond)
+
+	var messages []string
+	for _, entry := range rb.Entries() {
+		var record struct {
+			Msg string `json:"msg"`
+		}
+		json.Unmarshal(entry, &record)
+		messages = append(messages, record.Msg)
+	}
+	return messages
+}
@@ -1,25 +1,29 @@
 package main
 
 import (
+	"context"
+	"demo/auth"
+	"demo/logr"
+	"demo/metrics"
 	"demo/registry"
 	"demo/server"
+	"demo/tracing"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-func setupRouter() *chi.Mux {
+func setupRouter(handler *LogHandler) *chi.Mux {
 	router := chi.NewRouter()
 	router.Use(middleware.Logger)
 
-	handler, err := DefaultLogToFileHandler("app.log")
-	if err != nil {
-		log.Fatal(err)
-	}
 	handler.RegisterRoutes(router)
 	return router
 }
@@ -28,18 +32,190 @@ func main() {
 	port := flag.Int("port", 8081, "Port for the HTTP server")
 	registrationAddr := flag.String("registration-addr", "http://localhost:8080/register", "Registration service endpoint")
 	deregistrationAddr := flag.String("deregistration-addr", "http://localhost:8080/deregister", "Deregistration service endpoint")
+	stateAddr := flag.String("state-addr", "http://localhost:8080/services", "Endpoint this instance sets its state at; drains on shutdown unless empty")
+	drainPeriod := flag.Duration("drain-period", 2*time.Second, "How long to drain on shutdown before deregistering")
+	logFile := flag.String("log-file", "app.log", "File receiving all records (empty to disable)")
+	logDir := flag.String("log-dir", "", "Directory for per-service log files (empty to disable)")
+	stdout := flag.Bool("stdout", false, "Also write all records to stdout")
+	syslogAddr := flag.String("syslog-addr", "", "Forward all records to a syslog collector, e.g. udp://localhost:514")
+	ringSize := flag.Int("ring-size", 1000, "Number of recent records served on /log/recent (0 to disable)")
+	syslogUDP := flag.String("ingest-syslog-udp", "", "Address to accept RFC 5424 syslog over UDP, e.g. :5514")
+	syslogTCP := flag.String("ingest-syslog-tcp", "", "Address to accept RFC 5424 syslog over TCP")
+	gelfUDP := flag.String("ingest-gelf-udp", "", "Address to accept GELF over UDP, e.g. :12201")
+	gelfTCP := flag.String("ingest-gelf-tcp", "", "Address to accept GELF over TCP")
+	logLevel := flag.String("log-level", "INFO", "Minimum level of records written to sinks")
+	sampleFirst := flag.Int("sample-first", 0, "Records per service and message logged each -sample-tick before sampling (0 disables sampling)")
+	sampleThereafter := flag.Int("sample-thereafter", 100, "Once sampling, log every Nth record per service and message")
+	sampleTick := flag.Duration("sample-tick", time.Second, "Interval after which sampling counters reset")
+	rotateBytes := flag.Int64("rotate-bytes", 0, "Rotate log files once they grow past this many bytes (0 disables rotation)")
+	maxAge := flag.Duration("retention-max-age", 0, "Delete rotated log segments older than this (0 keeps them)")
+	maxBytes := flag.Int64("retention-max-bytes", 0, "Hard limit on the total size of log files; new records are rejected once reached (0 disables, requires -rotate-bytes)")
+	warnRatio := flag.Float64("retention-warn-ratio", 0.9, "Fraction of -retention-max-bytes at which health reports degraded")
+	sweepInterval := flag.Duration("retention-interval", time.Minute, "Interval between retention sweeps")
+	var routes routeFlags
+	flag.Var(&routes, "route", "Routing rule service=<type>,level=<level>,sink=<sink> (repeatable)")
+	authSecret := flag.String("auth-secret", "", "Secret this service authenticates its registration with")
+	authHMAC := flag.Bool("auth-hmac", false, "Sign registration requests with the secret instead of sending it as a bearer token")
+	traceExport := flag.String("trace-export", "", `Export spans as JSON lines to "stdout" or a file path (empty to disable)`)
+	tlsCert := flag.String("tls-cert", "", "Certificate file; enables HTTPS and is presented as client certificate on outgoing calls")
+	tlsKey := flag.String("tls-key", "", "Private key file for -tls-cert")
+	tlsCA := flag.String("tls-ca", "", "CA file used to verify other services and, with -tls-client-auth, their client certificates")
+	tlsClientAuth := flag.Bool("tls-client-auth", false, "Require client certificates signed by -tls-ca (mutual TLS)")
+	rateLimit := flag.Float64("rate-limit", 0, "Requests per second each client IP may make (0 disables rate limiting)")
+	rateBurst := flag.Int("rate-burst", 20, "Requests a client IP may make at once before -rate-limit applies")
+	maxBodyBytes := flag.Int64("max-body-bytes", 1<<20, "Largest request body accepted (0 disables the limit)")
+	maxConcurrent := flag.Int("max-concurrent", 0, "Requests handled at once across all clients (0 disables the limit)")
+	tags := flag.String("tags", "", "Comma-separated tags this instance registers with, e.g. eu-west,canary")
+	version := flag.String("version", "", "Version this instance registers with, which traffic policies split requests by")
+	weight := flag.Int("weight", 1, "Share of the requests to its version this instance receives, relative to the others")
+	describe := flag.Bool("describe", false, "Print the service type, required services and health check endpoint as JSON and exit")
 	flag.Parse()
 
+	var tlsConfig *server.TLSConfig
+	if *tlsCert != "" {
+		tlsConfig = &server.TLSConfig{CertFile: *tlsCert, KeyFile: *tlsKey, CAFile: *tlsCA, RequireClientCert: *tlsClientAuth}
+	}
+	scheme := tlsConfig.Scheme()
+
+	serviceType, requiredServices := "Logging", []string{}
+	healthCheckEndpoint := fmt.Sprintf("%s://localhost:%d/healthcheck", scheme, *port)
+	if *describe {
+		if err := server.Describe(os.Stdout, server.Description{
+			ServiceType:         serviceType,
+			RequiredServices:    requiredServices,
+			HealthCheckEndpoint: healthCheckEndpoint,
+		}); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	exporter, err := tracing.NewExporter(*traceExport)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	level := new(slog.LevelVar)
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		log.Fatal(err)
+	}
+
+	// Retention only deletes rotated segments. Without rotation, or with live
+	// files allowed to grow past the quota, usage could never drop below it
+	// and every record would be rejected from then on.
+	if *maxBytes > 0 && (*rotateBytes <= 0 || *rotateBytes >= *maxBytes) {
+		log.Fatal("-retention-max-bytes requires -rotate-bytes between 1 and -retention-max-bytes")
+	}
+
+	options := []logr.Option{logr.WithLevel(level), logr.WithRotation(*rotateBytes)}
+	if *sampleFirst > 0 {
+		options = append(options, logr.WithSampling(logr.Sampling{
+			First:      *sampleFirst,
+			Thereafter: *sampleThereafter,
+			Tick:       *sampleTick,
+		}))
+	}
+	if *logFile != "" {
+		options = append(options, logr.WithFile(*logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600))
+	}
+	if *logDir != "" {
+		options = append(options, logr.WithServiceFiles(*logDir))
+	}
+	if *stdout {
+		options = append(options, logr.WithStdout())
+	}
+	if *syslogAddr != "" {
+		sink, err := parseSink("syslog:" + *syslogAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		options = append(options, sink)
+	}
+	var recent *logr.RingBuffer
+	if *ringSize > 0 {
+		recent = logr.NewRingBuffer(*ringSize)
+		options = append(options, logr.WithRingBuffer(recent))
+	}
+	options = append(options, routes...)
+
+	logger, err := logr.NewLogWriter(options...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer logger.Close()
+
+	// The patterns cover -log-file, -log-dir and the file sinks of every -route.
+	janitor := &logr.Janitor{
+		Patterns:  logger.FilePatterns(),
+		MaxAge:    *maxAge,
+		MaxBytes:  *maxBytes,
+		WarnRatio: *warnRatio,
+		Written:   logger.BytesWritten,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go janitor.Run(ctx, *sweepInterval)
+
+	reg := metrics.NewRegistry()
+	ingested := reg.NewCounterVec("logging_records_ingested_total", "Log records ingested, by source protocol.", "source")
+	reg.NewCounterFunc("logging_bytes_written_total", "Bytes written to log files.", nil, func(emit metrics.Emit) {
+		emit(float64(logger.BytesWritten()))
+	})
+
+	ingester := &Ingester{Logger: logger, Quota: janitor, Ingested: ingested}
+	defer ingester.Close()
+	for addr, listen := range map[*string]func(string) error{
+		syslogUDP: ingester.ListenSyslogUDP,
+		syslogTCP: ingester.ListenSyslogTCP,
+		gelfUDP:   ingester.ListenGELFUDP,
+		gelfTCP:   ingester.ListenGELFTCP,
+	} {
+		if *addr == "" {
+			continue
+		}
+		if err := listen(*addr); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	server := &server.Server{
-		Router:               setupRouter(),
+		Router:               setupRouter(&LogHandler{Logger: logger, Recent: recent, Quota: janitor, Ingested: ingested}),
 		RegistrationAddr:     *registrationAddr,
 		DeregistrationAddr:   *deregistrationAddr,
+		StateAddr:            *stateAddr,
+		DrainPeriod:          *drainPeriod,
 		Port:                 *port,
-		ServiceType:          "Logging",
-		RequiredServices:     []string{},
-		ConnectedInstances:   make(registry.ConnectedInstances),
-		NotificationEndpoint: fmt.Sprintf("http://localhost:%d/notify", *port),
-		HealthCheckEndpoint:  fmt.Sprintf("http://localhost:%d/healthcheck", *port),
+		ServiceType:          serviceType,
+		RequiredServices:     requiredServices,
+		Tags:                 registry.ParseTags(*tags),
+		Version:              *version,
+		Weight:               *weight,
+		NotificationEndpoint: fmt.Sprintf("%s://localhost:%d/notify", scheme, *port),
+		HealthCheckEndpoint:  healthCheckEndpoint,
+		Signer:               auth.Signer{Secret: *authSecret, HMAC: *authHMAC},
+		LogLevel:             level,
+		Metrics:              reg,
+		Tracer:               &tracing.Tracer{Service: "Logging", Exporter: exporter},
+		TLS:                  tlsConfig,
+		Limits: &server.Limits{
+			Rate:          *rateLimit,
+			Burst:         *rateBurst,
+			MaxBodyBytes:  *maxBodyBytes,
+			MaxConcurrent: *maxConcurrent,
+		},
+		HealthComponents: map[string]server.HealthComponent{
+			"log-storage": func() (string, string) {
+				usage := fmt.Sprintf("%d of %d bytes used", janitor.Usage(), janitor.MaxBytes)
+				switch {
+				case janitor.OverQuota():
+					return server.StatusDegraded, "quota exhausted, rejecting new records: " + usage
+				case janitor.NearQuota():
+					return server.StatusDegraded, "quota nearly exhausted: " + usage
+				default:
+					return server.StatusOK, usage
+				}
+			},
+		},
 	}
 
 	var wg sync.WaitGroup
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"demo/logr"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// routeFlags collects repeated -route flags of the form
+//
+//	service=Business,level=WARN,sink=stdout
+//
+// where service and level are optional and sink is one of stdout,
+// file:<path>, dir:<dir> or syslog:<network>://<addr>. Without level the
+// route accepts records of every level.
+type routeFlags []logr.Option
+
+func (rf *routeFlags) String() string {
+	return fmt.Sprintf("%d routes", len(*rf))
+}
+
+func (rf *routeFlags) Set(spec string) error {
+	var (
+		match = logr.Match{MinLevel: logr.AllLevels}
+		sink  logr.Option
+		err   error
+	)
+
+	for _, part := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return fmt.Errorf("invalid route element %q", part)
+		}
+
+		switch key {
+		case "service":
+			match.Service = value
+		case "level":
+			if err := match.MinLevel.UnmarshalText([]byte(value)); err != nil {
+				return err
+			}
+		case "sink":
+			if sink, err = parseSink(value); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown route key %q", key)
+		}
+	}
+
+	if sink == nil {
+		return fmt.Errorf("route %q has no sink", spec)
+	}
+
+	*rf = append(*rf, logr.WithRoute(match, sink))
+	return nil
+}
+
+// parseSink turns a sink spec into the logr option adding it.
+func parseSink(spec string) (logr.Option, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+
+	switch kind {
+	case "stdout":
+		return logr.WithStdout(), nil
+	case "file":
+		return logr.WithFile(arg, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600), nil
+	case "dir":
+		return logr.WithServiceFiles(arg), nil
+	case "syslog":
+		network, addr, ok := strings.Cut(arg, "://")
+		if !ok {
+			return nil, fmt.Errorf("invalid syslog address %q", arg)
+		}
+		return logr.WithSyslog(network, addr), nil
+	default:
+		return nil, fmt.Errorf("unknown sink %q", kind)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"demo/logr"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRouteFlags(t *testing.T) {
+	tests := []struct {
+		name  string
+		level string
+		want  []string
+	}{
+		{"every level without level", "", []string{"debug", "info", "error"}},
+		{"from the given level", "level=INFO,", []string{"info", "error"}},
+		{"from error", "level=ERROR,", []string{"error"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "routed.log")
+			var routes routeFlags
+			if err := routes.Set("service=Business," + tt.level + "sink=file:" + path); err != nil {
+				t.Fatal(err)
+			}
+			logger, err := logr.NewLogWriter(append(routes, logr.WithLevel(slog.LevelDebug))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			business := logger.With("service", "Business")
+			business.Debug("debug")
+			business.Info("info")
+			business.Error("error")
+			logger.Error("other service")
+			logger.Close()
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, msg := range []string{"debug", "info", "error", "other service"} {
+				if strings.Contains(string(data), `"msg":"`+msg+`"`) {
+					got = append(got, msg)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("routed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteFlagsErrors(t *testing.T) {
+	tests := []string{
+		"service=Business",
+		"level=LOUD,sink=stdout",
+		"sink=tape",
+		"sink=syslog:localhost",
+		"color=red,sink=stdout",
+		"stdout",
+	}
+	for _, spec := range tests {
+		t.Run(spec, func(t *testing.T) {
+			var routes routeFlags
+			if err := routes.Set(spec); err == nil {
+				t.Errorf("Set(%q) succeeded", spec)
+			}
+		})
+	}
+}
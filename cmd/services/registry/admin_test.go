@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"demo/auth"
+	"demo/discovery"
+	"demo/metrics"
+	"demo/registry"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testPolicy grants "ops" every admin permission and "viewer" only listing.
+func testPolicy() *auth.Policy {
+	return &auth.Policy{
+		Roles: map[string][]auth.Permission{
+			"admin":  {auth.PermListServices, auth.PermDeregisterServices, auth.PermSetServiceState, auth.PermWritePolicies, auth.PermReadEvents},
+			"reader": {auth.PermListServices},
+		},
+		Bindings: map[string][]string{"ops": {"admin"}, "viewer": {"reader"}},
+		Keys:     map[string]string{"ops": "ops-secret", "viewer": "viewer-secret"},
+	}
+}
+
+// newTestRegistrar serves the registrar's routes under policy with a
+// registered Logging instance.
+func newTestRegistrar(t *testing.T, policy *auth.Policy) (*httptest.Server, *registry.InMemoryServiceRegistry, *registry.Registration) {
+	t.Helper()
+
+	reg := &registry.InMemoryServiceRegistry{}
+	logging, err := reg.PostService(&registry.Registration{
+		ID:          "logging-1",
+		ServiceType: "Logging",
+		IP:          "127.0.0.1",
+		Port:        8081,
+		State:       registry.StateActive,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checker := &HealthChecker{Registry: reg}
+	router := setupRouter(reg, checker, metrics.NewRegistry(), http.DefaultClient, nil, policy, &registry.EventStream{})
+	ts := httptest.NewServer(router)
+	t.Cleanup(ts.Close)
+	return ts, reg, logging
+}
+
+func adminClient(ts *httptest.Server, signer auth.Signer) *discovery.Client {
+	return &discovery.Client{RegistryAddr: ts.URL, HTTPClient: ts.Client(), Signer: signer}
+}
+
+// statusCode returns the status code of a registrar error, or 200 for nil.
+func statusCode(t *testing.T, err error) int {
+	t.Helper()
+	if err == nil {
+		return http.StatusOK
+	}
+	var statusErr *discovery.StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return statusErr.StatusCode
+}
+
+func TestSetStateThroughClient(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *auth.Policy
+		signer auth.Signer
+		status int
+	}{
+		{"HMAC signature", testPolicy(), auth.Signer{Secret: "ops-secret", HMAC: true}, http.StatusOK},
+		{"bearer token", testPolicy(), auth.Signer{Secret: "ops-secret"}, http.StatusOK},
+		{"HMAC without the permission", testPolicy(), auth.Signer{Secret: "viewer-secret", HMAC: true}, http.StatusForbidden},
+		{"wrong secret", testPolicy(), auth.Signer{Secret: "guess", HMAC: true}, http.StatusUnauthorized},
+		{"no policy loaded", nil, auth.Signer{Secret: "ops-secret", HMAC: true}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, reg, logging := newTestRegistrar(t, tt.policy)
+
+			updated, err := adminClient(ts, tt.signer).SetState(context.Background(), logging.ID, registry.StateDraining)
+			if got := statusCode(t, err); got != tt.status {
+				t.Fatalf("SetState() status = %d, want %d (%v)", got, tt.status, err)
+			}
+
+			want := registry.StateActive
+			if tt.status == http.StatusOK {
+				want = registry.StateDraining
+				if updated.State != want {
+					t.Errorf("returned state = %q, want %q", updated.State, want)
+				}
+			}
+			stored, err := reg.GetServiceByID(logging.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.State != want {
+				t.Errorf("stored state = %q, want %q", stored.State, want)
+			}
+		})
+	}
+}
+
+func TestSetTrafficPolicyThroughClient(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *auth.Policy
+		signer auth.Signer
+		status int
+	}{
+		{"HMAC signature", testPolicy(), auth.Signer{Secret: "ops-secret", HMAC: true}, http.StatusOK},
+		{"bearer token", testPolicy(), auth.Signer{Secret: "ops-secret"}, http.StatusOK},
+		{"HMAC without the permission", testPolicy(), auth.Signer{Secret: "viewer-secret", HMAC: true}, http.StatusForbidden},
+		{"no policy loaded", nil, auth.Signer{Secret: "ops-secret", HMAC: true}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, _, _ := newTestRegistrar(t, tt.policy)
+			client := adminClient(ts, tt.signer)
+			ops := adminClient(ts, auth.Signer{Secret: "ops-secret", HMAC: true})
+
+			policy := registry.TrafficPolicy{ServiceType: "Logging", Splits: map[string]int{"v1": 90, "v2": 10}}
+			err := client.SetTrafficPolicy(context.Background(), policy)
+			if got := statusCode(t, err); got != tt.status {
+				t.Fatalf("SetTrafficPolicy() status = %d, want %d (%v)", got, tt.status, err)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			policies, err := ops.TrafficPolicies(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(policies) != 1 || policies[0].Splits["v2"] != 10 {
+				t.Fatalf("TrafficPolicies() = %+v, want the policy just set", policies)
+			}
+
+			// Removing the policy is a signed DELETE without a body.
+			if err := client.SetTrafficPolicy(context.Background(), registry.TrafficPolicy{ServiceType: "Logging"}); err != nil {
+				t.Fatal(err)
+			}
+			if policies, err := ops.TrafficPolicies(context.Background()); err != nil || len(policies) != 0 {
+				t.Errorf("TrafficPolicies() after removal = %+v, %v; want none", policies, err)
+			}
+		})
+	}
+}
+
+func TestStreamEventsThroughClient(t *testing.T) {
+	ts, _, logging := newTestRegistrar(t, testPolicy())
+	ops := adminClient(ts, auth.Signer{Secret: "ops-secret", HMAC: true})
+
+	err := adminClient(ts, auth.Signer{Secret: "viewer-secret", HMAC: true}).StreamEvents(context.Background(), func(registry.Event) error { return nil })
+	if got := statusCode(t, err); got != http.StatusForbidden {
+		t.Fatalf("StreamEvents() without the permission: status = %d, want %d", got, http.StatusForbidden)
+	}
+
+	// An event from before connecting is replayed first.
+	if _, err := ops.SetState(context.Background(), logging.ID, registry.StateDraining); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan registry.Event)
+	done := make(chan error, 1)
+	go func() {
+		done <- ops.StreamEvents(ctx, func(e registry.Event) error {
+			events <- e
+			return nil
+		})
+	}()
+
+	next := func() registry.Event {
+		t.Helper()
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event received")
+			return registry.Event{}
+		}
+	}
+
+	if e := next(); e.ID != 1 || e.Type != registry.EventUpdated || e.After.State != registry.StateDraining {
+		t.Errorf("first event = %d %s %+v, want the replayed update to draining", e.ID, e.Type, e.After)
+	}
+	if _, err := ops.SetState(context.Background(), logging.ID, registry.StateActive); err != nil {
+		t.Fatal(err)
+	}
+	if e := next(); e.ID != 2 || e.Before.State != registry.StateDraining || e.After.State != registry.StateActive {
+		t.Errorf("second event = %d %+v -> %+v, want the update back to active", e.ID, e.Before, e.After)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("StreamEvents() after cancel = %v, want nil", err)
+	}
+}
@@ -0,0 +1,374 @@
+// The dashboard renders the registrar's REST API and refreshes it whenever
+// the event stream reports a change. Every request carries the policy key
+// entered on the page, when there is one.
+"use strict";
+
+const state = {
+  services: [],
+  health: {},
+  graph: { nodes: [], cycles: [] },
+  policies: {},
+  events: [],
+};
+
+// Admin actions offered for an instance when it is in one of the given states.
+const actions = [
+  setStateAction("Drain", "draining", ["active"]),
+  setStateAction("Maintenance", "maintenance", ["active", "draining"]),
+  setStateAction("Activate", "active", ["draining", "maintenance"]),
+  {
+    label: "Deregister",
+    confirm: (s) => `Deregister ${s.serviceType} ${s.id}?`,
+    run: (s) => api("DELETE", `/admin/services/${encodeURIComponent(s.id)}`),
+  },
+];
+
+function setStateAction(label, state, from) {
+  return {
+    label,
+    when: (s) => from.includes(s.state || "active"),
+    confirm: (s) => `Set ${s.serviceType} ${s.id} to ${state}?`,
+    run: (s) => api("PUT", `/admin/services/${encodeURIComponent(s.id)}/state`, { state }),
+  };
+}
+
+const maxEvents = 50;
+
+function key() {
+  return sessionStorage.getItem("registryKey") || "";
+}
+
+async function api(method, path, body) {
+  const headers = {};
+  if (key()) {
+    headers.Authorization = `Bearer ${key()}`;
+  }
+  if (body !== undefined) {
+    headers["Content-Type"] = "application/json";
+    body = JSON.stringify(body);
+  }
+  const resp = await fetch(path, { method, headers, body });
+  if (!resp.ok) {
+    throw new Error(`${method} ${path}: ${resp.status} ${(await resp.text()).trim()}`);
+  }
+  return resp;
+}
+
+function showError(err) {
+  const box = document.getElementById("error");
+  box.textContent = err ? err.message : "";
+  box.hidden = !err;
+}
+
+// el builds an element; strings become text nodes, so registry data is never
+// interpreted as HTML.
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  for (const [name, value] of Object.entries(attrs || {})) {
+    if (name.startsWith("on")) {
+      node.addEventListener(name.slice(2), value);
+    } else {
+      node.setAttribute(name, value);
+    }
+  }
+  for (const child of children.flat()) {
+    if (child != null) {
+      node.append(child);
+    }
+  }
+  return node;
+}
+
+function svg(tag, attrs, ...children) {
+  const node = document.createElementNS("http://www.w3.org/2000/svg", tag);
+  for (const [name, value] of Object.entries(attrs || {})) {
+    node.setAttribute(name, value);
+  }
+  node.append(...children);
+  return node;
+}
+
+async function load() {
+  try {
+    const [services, graph, policies] = await Promise.all([
+      api("GET", "/services").then((r) => r.json()),
+      api("GET", "/graph").then((r) => r.json()),
+      api("GET", "/policies").then((r) => r.json()),
+    ]);
+    state.services = services || [];
+    state.graph = graph;
+    state.policies = Object.fromEntries((policies || []).map((p) => [p.serviceType, p]));
+    showError(null);
+  } catch (err) {
+    showError(err);
+  }
+
+  // Health needs its own permission; show the services without it.
+  try {
+    const results = (await api("GET", "/healthchecks").then((r) => r.json())) || [];
+    state.health = {};
+    for (const result of results) {
+      state.health[result.service_id] = result.status || (result.healthy ? "ok" : "unhealthy");
+    }
+  } catch (err) {
+    state.health = {};
+  }
+
+  render();
+}
+
+let reloadTimer;
+function scheduleLoad() {
+  clearTimeout(reloadTimer);
+  reloadTimer = setTimeout(load, 300);
+}
+
+function render() {
+  renderServices();
+  renderGraph();
+  renderEvents();
+}
+
+function renderServices() {
+  const container = document.getElementById("services");
+  container.replaceChildren();
+  if (state.services.length === 0) {
+    container.append(el("p", { class: "empty" }, "No services registered."));
+    return;
+  }
+
+  const byType = {};
+  for (const s of state.services) {
+    (byType[s.serviceType] = byType[s.serviceType] || []).push(s);
+  }
+
+  for (const type of Object.keys(byType).sort()) {
+    const rows = byType[type].map((s) => {
+      const health = state.health[s.id] || "unknown";
+      const instanceState = s.state || "active";
+      return el("tr", null,
+        el("td", null, el("code", null, s.id)),
+        el("td", null, `${s.scheme || "http"}://${s.ip}:${s.port}`),
+        el("td", null, s.version ? `${s.version} (weight ${s.weight || 1})` : "-"),
+        el("td", null, (s.tags || []).join(", ") || "-"),
+        el("td", null, el("span", { class: `badge ${instanceState}` }, instanceState)),
+        el("td", null, el("span", { class: `badge ${health}` }, health)),
+        el("td", null, actions.filter((action) => !action.when || action.when(s)).map((action) =>
+          el("button", {
+            onclick: async () => {
+              if (!confirm(action.confirm(s))) {
+                return;
+              }
+              try {
+                await action.run(s);
+                showError(null);
+              } catch (err) {
+                showError(err);
+              }
+              scheduleLoad();
+            },
+          }, action.label))));
+    });
+
+    container.append(
+      el("h3", null, `${type} (${rows.length})`),
+      state.policies[type] ? el("p", { class: "policy" }, `Traffic policy: ${splits(state.policies[type])}`) : null,
+      el("table", null,
+        el("thead", null, el("tr", null,
+          ["ID", "Address", "Version", "Tags", "State", "Health", ""].map((h) => el("th", null, h)))),
+        el("tbody", null, rows)));
+  }
+}
+
+// renderGraph lays service types out in columns by dependency depth, with
+// types that require nothing on the left.
+function renderGraph() {
+  const container = document.getElementById("graph");
+  const cycles = document.getElementById("cycles");
+  container.replaceChildren();
+  cycles.replaceChildren();
+
+  const nodes = state.graph.nodes || [];
+  if (nodes.length === 0) {
+    container.append(el("p", { class: "empty" }, "No dependencies."));
+    return;
+  }
+
+  const byType = Object.fromEntries(nodes.map((n) => [n.serviceType, n]));
+  const inCycle = new Set((state.graph.cycles || []).flat());
+  const depth = {};
+  const depthOf = (type, seen = new Set()) => {
+    if (depth[type] !== undefined) {
+      return depth[type];
+    }
+    if (seen.has(type)) {
+      return 0;
+    }
+    seen.add(type);
+    const required = (byType[type] && byType[type].requires) || [];
+    depth[type] = required.length === 0 ? 0 : 1 + Math.max(...required.map((r) => depthOf(r, seen)));
+    return depth[type];
+  };
+
+  const columns = [];
+  for (const n of nodes) {
+    const d = depthOf(n.serviceType);
+    (columns[d] = columns[d] || []).push(n.serviceType);
+  }
+
+  const w = 130, h = 40, dx = 190, dy = 60, pad = 10;
+  const pos = {};
+  columns.forEach((types, col) => (types || []).forEach((type, row) => {
+    pos[type] = { x: pad + col * dx, y: pad + row * dy };
+  }));
+  const rows = Math.max(...Array.from(columns, (c) => (c ? c.length : 0)));
+
+  const root = svg("svg", {
+    width: pad * 2 + (columns.length - 1) * dx + w,
+    height: pad * 2 + (rows - 1) * dy + h,
+  });
+  root.append(svg("defs", null,
+    svg("marker", { id: "arrow", viewBox: "0 0 10 10", refX: 10, refY: 5, markerWidth: 8, markerHeight: 8, orient: "auto" },
+      svg("path", { d: "M0,0 L10,5 L0,10 z", fill: "#57606a" }))));
+
+  for (const n of nodes) {
+    for (const required of n.requires || []) {
+      const from = pos[n.serviceType], to = pos[required];
+      if (!from || !to) {
+        continue;
+      }
+      root.append(svg("line", {
+        class: "edge",
+        x1: from.x, y1: from.y + h / 2,
+        x2: to.x + w, y2: to.y + h / 2,
+        "marker-end": "url(#arrow)",
+      }));
+    }
+  }
+
+  for (const n of nodes) {
+    const { x, y } = pos[n.serviceType];
+    let cls = "node";
+    if (n.instances === 0) cls += " missing";
+    if (inCycle.has(n.serviceType)) cls += " cycle";
+    const label = svg("text", { x: x + w / 2, y: y + 17, "text-anchor": "middle" });
+    label.textContent = n.serviceType;
+    const count = svg("text", { x: x + w / 2, y: y + 32, "text-anchor": "middle", "font-size": 11 });
+    count.textContent = `${n.instances} instance(s)`;
+    root.append(svg("g", { class: cls }, svg("rect", { x, y, width: w, height: h, rx: 4 }), label, count));
+  }
+  container.append(root);
+
+  for (const cycle of state.graph.cycles || []) {
+    cycles.append(el("li", null, `Dependency cycle between ${cycle.join(", ")}`));
+  }
+}
+
+function splits(policy) {
+  return Object.keys(policy.splits).sort().map((v) => `${v} ${policy.splits[v]}%`).join(", ");
+}
+
+function describe(e) {
+  switch (e.type) {
+    case "register":
+      return `${e.serviceType} ${e.serviceId} registered`;
+    case "deregister":
+      return `${e.serviceType} ${e.serviceId} deregistered`;
+    case "update":
+      return `${e.serviceType} ${e.serviceId} is now ${(e.after && e.after.state) || "updated"}`;
+    case "health":
+      return `${e.serviceType} ${e.serviceId} is ${e.health}`;
+    case "policy":
+      return e.policy ? `${e.serviceType} traffic split ${splits(e.policy)}` : `${e.serviceType} traffic policy removed`;
+    default:
+      return `${e.type} ${e.serviceType} ${e.serviceId}`;
+  }
+}
+
+function renderEvents() {
+  const list = document.getElementById("events");
+  list.replaceChildren();
+  if (state.events.length === 0) {
+    list.append(el("li", { class: "empty" }, "No events yet."));
+    return;
+  }
+  for (const e of state.events) {
+    list.append(el("li", null,
+      el("time", { datetime: e.time }, new Date(e.time).toLocaleTimeString()),
+      describe(e),
+      e.actor && e.type !== "health" ? el("span", { class: "actor" }, ` by ${e.actor}`) : null));
+  }
+}
+
+function setConnection(status) {
+  const badge = document.getElementById("connection");
+  badge.className = `badge ${status}`;
+  badge.textContent = status;
+}
+
+function onEvent(e) {
+  state.events.unshift(e);
+  state.events.length = Math.min(state.events.length, maxEvents);
+
+  if (e.type === "health") {
+    state.health[e.serviceId] = e.health;
+    render();
+  } else {
+    renderEvents();
+    scheduleLoad();
+  }
+}
+
+// follow reads the event stream with fetch rather than EventSource, which
+// cannot send the Authorization header, and reconnects when it ends.
+async function follow() {
+  const headers = {};
+  if (key()) {
+    headers.Authorization = `Bearer ${key()}`;
+  }
+
+  try {
+    const resp = await fetch("/events/stream", { headers });
+    if (!resp.ok) {
+      throw new Error(`event stream: ${resp.status} ${(await resp.text()).trim()}`);
+    }
+    setConnection("connected");
+    // The stream starts by replaying the recent events.
+    state.events = [];
+    load();
+
+    const reader = resp.body.pipeThrough(new TextDecoderStream()).getReader();
+    let buffer = "";
+    for (;;) {
+      const { value, done } = await reader.read();
+      if (done) {
+        break;
+      }
+      buffer += value;
+      let end;
+      while ((end = buffer.indexOf("\n\n")) >= 0) {
+        const frame = buffer.slice(0, end);
+        buffer = buffer.slice(end + 2);
+        const data = frame.split("\n").filter((l) => l.startsWith("data: ")).map((l) => l.slice(6)).join("\n");
+        if (data) {
+          onEvent(JSON.parse(data));
+        }
+      }
+    }
+  } catch (err) {
+    showError(err);
+  }
+
+  setConnection("disconnected");
+  setTimeout(follow, 3000);
+}
+
+document.getElementById("key").value = key();
+document.getElementById("auth").addEventListener("submit", (e) => {
+  e.preventDefault();
+  sessionStorage.setItem("registryKey", document.getElementById("key").value);
+  location.reload();
+});
+
+load();
+follow();
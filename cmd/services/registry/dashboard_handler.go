@@ -0,0 +1,28 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// DashboardHandler serves the web dashboard. The dashboard is static; it
+// reads the registrar's API with the key entered on the page and updates from
+// the event stream.
+type DashboardHandler struct{}
+
+func (dh *DashboardHandler) RegisterRoutes(r *chi.Mux) {
+	static, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r.Get("/dashboard", http.RedirectHandler("/dashboard/", http.StatusMovedPermanently).ServeHTTP)
+	r.Handle("/dashboard/*", http.StripPrefix("/dashboard/", http.FileServer(http.FS(static))))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"demo/auth"
+	"demo/registry"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// EventsHandler serves the history and live stream of registry events.
+type EventsHandler struct {
+	Events *registry.EventStream
+
+	// Policy, when set, restricts who may read events.
+	Policy *auth.Policy
+}
+
+func (eh *EventsHandler) RegisterRoutes(r *chi.Mux) {
+	r.With(eh.Policy.Require(auth.PermReadEvents)).Get("/events", eh.GetEvents)
+	r.With(eh.Policy.Require(auth.PermReadEvents)).Get("/events/stream", eh.StreamEvents)
+}
+
+// GetEvents returns recorded events, oldest first. The since query parameter
+// is an event ID to return the events after, or an RFC 3339 time to return
+// the events from; type selects one event type and limit caps the number of
+// events returned.
+func (eh *EventsHandler) GetEvents(w http.ResponseWriter, r *http.Request) {
+	filter := registry.EventFilter{Type: r.URL.Query().Get("type")}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	if since := r.URL.Query().Get("since"); since != "" {
+		if id, err := strconv.ParseInt(since, 10, 64); err == nil {
+			filter.SinceID = id
+		} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+			filter.Since = t
+		} else {
+			http.Error(w, "since must be an event ID or an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	events, err := eh.Events.Events(filter)
+	if err != nil {
+		log.Println("Failed to read events:", err)
+		http.Error(w, "failed to read events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// StreamEvents sends registry events as server-sent events, starting with the
+// recent ones, until the client disconnects or the registrar shuts down.
+func (eh *EventsHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	events, unsubscribe := eh.Events.Subscribe()
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	// Events published since subscribing may also be among the recent ones.
+	var lastID int64
+	send := func(e registry.Event) error {
+		if e.ID <= lastID {
+			return nil
+		}
+		lastID = e.ID
+
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	for _, e := range eh.Events.Recent() {
+		if err := send(e); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	// Comments keep proxies from closing an idle stream.
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := send(e); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"demo/registry"
+	"demo/server"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthChecker checks registered services and keeps the latest result per instance.
+type HealthChecker struct {
+	Registry registry.ServiceRegistry
+	Client   *http.Client
+
+	// Events, when set, receives an event whenever an instance's health
+	// status changes.
+	Events *registry.EventStream
+
+	// checking serializes CheckAll, so each run compares against the
+	// results of the one before it.
+	checking sync.Mutex
+
+	mu      sync.Mutex
+	results map[string]server.HealthCheckResult
+}
+
+// Run checks all services every interval until ctx is done.
+func (hc *HealthChecker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := hc.CheckAll(); err != nil {
+				log.Println("Failed to run health checks:", err)
+			}
+		}
+	}
+}
+
+// CheckAll checks every registered service and records the results. Runs
+// are serialized.
+func (hc *HealthChecker) CheckAll() ([]server.HealthCheckResult, error) {
+	hc.checking.Lock()
+	defer hc.checking.Unlock()
+
+	services, err := hc.Registry.GetServices()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]server.HealthCheckResult, len(services))
+	var wg sync.WaitGroup
+	for i, service := range services {
+		wg.Add(1)
+		go func(i int, service registry.Registration) {
+			defer wg.Done()
+			results[i] = hc.check(service)
+		}(i, service)
+	}
+	wg.Wait()
+
+	latest := make(map[string]server.HealthCheckResult, len(results))
+	for _, result := range results {
+		latest[result.ServiceID] = result
+	}
+
+	hc.mu.Lock()
+	previous := hc.results
+	hc.results = latest
+	hc.mu.Unlock()
+
+	if hc.Events != nil {
+		for _, result := range results {
+			// A first result is only news when the instance starts out unhealthy.
+			before, seen := previous[result.ServiceID]
+			if (seen && before.Status != result.Status) || (!seen && result.Status != server.StatusOK) {
+				hc.Events.Publish(registry.Event{
+					Type:           registry.EventHealthChanged,
+					ServiceID:      result.ServiceID,
+					ServiceType:    result.ServiceType,
+					Actor:          "health-checker",
+					PreviousHealth: before.Status,
+					Health:         result.Status,
+				})
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// Results returns the latest recorded result of every registered service,
+// without checking them again. Services are only checked here when some have
+// not been checked yet, such as right after they registered.
+func (hc *HealthChecker) Results() ([]server.HealthCheckResult, error) {
+	results, complete, err := hc.recorded()
+	if err != nil || complete {
+		return results, err
+	}
+
+	hc.checking.Lock()
+	// A run that finished while waiting may have checked them already.
+	results, complete, err = hc.recorded()
+	hc.checking.Unlock()
+	if err != nil || complete {
+		return results, err
+	}
+	return hc.CheckAll()
+}
+
+// recorded returns the recorded results of the registered services and
+// whether every one of them has a result.
+func (hc *HealthChecker) recorded() ([]server.HealthCheckResult, bool, error) {
+	services, err := hc.Registry.GetServices()
+	if err != nil {
+		return nil, false, err
+	}
+
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	results := make([]server.HealthCheckResult, 0, len(services))
+	for _, service := range services {
+		result, ok := hc.results[service.ID]
+		if !ok {
+			return nil, false, nil
+		}
+		results = append(results, result)
+	}
+	return results, true, nil
+}
+
+// Result returns the latest recorded result for a service instance.
+func (hc *HealthChecker) Result(id string) (server.HealthCheckResult, bool) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	result, ok := hc.results[id]
+	return result, ok
+}
+
+func (hc *HealthChecker) check(service registry.Registration) server.HealthCheckResult {
+	client := hc.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	result := server.HealthCheckResult{
+		ServiceID:   service.ID,
+		ServiceType: service.ServiceType,
+	}
+
+	resp, err := client.Get(service.HealthCheckEndpoint)
+	if err != nil {
+		result.Status = server.StatusUnhealthy
+		result.Message = fmt.Sprintf("Health check failed: %v", err)
+		return result
+	}
+	defer resp.Body.Close()
+
+	// Keep the service's own status and components when it reports them.
+	var reported server.HealthCheckResult
+	if err := json.NewDecoder(resp.Body).Decode(&reported); err == nil {
+		result.Status = reported.Status
+		result.Components = reported.Components
+	}
+
+	result.Healthy = resp.StatusCode == http.StatusOK
+	result.Message = fmt.Sprintf("Health check %s", http.StatusText(resp.StatusCode))
+	if !result.Healthy {
+		result.Status = server.StatusUnhealthy
+	} else if result.Status == "" {
+		result.Status = server.StatusOK
+	}
+
+	return result
+}
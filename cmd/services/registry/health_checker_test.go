@@ -0,0 +1,122 @@
+package main
+
+import (
+	"demo/registry"
+	"demo/server"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// healthEndpoint serves a health check answering status and counts the
+// checks it receives.
+func healthEndpoint(t *testing.T, status int) (string, *atomic.Int32) {
+	t.Helper()
+	var checks atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checks.Add(1)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL + "/healthcheck", &checks
+}
+
+func TestResultsServesLastRun(t *testing.T) {
+	reg := &registry.InMemoryServiceRegistry{}
+	endpoint, checks := healthEndpoint(t, http.StatusOK)
+	if _, err := reg.PostService(&registry.Registration{ID: "logging-1", ServiceType: "Logging", HealthCheckEndpoint: endpoint}); err != nil {
+		t.Fatal(err)
+	}
+	checker := &HealthChecker{Registry: reg}
+
+	tests := []struct {
+		name     string
+		register string
+		want     int
+		checks   int32
+	}{
+		{"checks services never checked", "", 1, 1},
+		{"serves the recorded results", "", 1, 1},
+		{"checks again once a service registers", "business-1", 2, 3},
+		{"serves the recorded results again", "", 2, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.register != "" {
+				if _, err := reg.PostService(&registry.Registration{ID: tt.register, ServiceType: "Business", HealthCheckEndpoint: endpoint}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			results, err := checker.Results()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != tt.want {
+				t.Errorf("Results() returned %d results, want %d", len(results), tt.want)
+			}
+			for _, r := range results {
+				if r.Status != server.StatusOK {
+					t.Errorf("%s status = %q, want %q", r.ServiceID, r.Status, server.StatusOK)
+				}
+			}
+			if got := checks.Load(); got != tt.checks {
+				t.Errorf("health endpoint checked %d times, want %d", got, tt.checks)
+			}
+		})
+	}
+}
+
+func TestCheckAllKeepsTheLatestCheck(t *testing.T) {
+	// The first check is slow and finds the instance unhealthy; the second,
+	// started while the first is running, finds it healthy.
+	var calls atomic.Int32
+	first := make(chan struct{})
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			close(first)
+			<-release
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	reg := &registry.InMemoryServiceRegistry{}
+	if _, err := reg.PostService(&registry.Registration{ID: "logging-1", ServiceType: "Logging", HealthCheckEndpoint: ts.URL}); err != nil {
+		t.Fatal(err)
+	}
+	events := &registry.EventStream{}
+	checker := &HealthChecker{Registry: reg, Events: events}
+
+	var wg sync.WaitGroup
+	run := func() {
+		defer wg.Done()
+		if _, err := checker.CheckAll(); err != nil {
+			t.Error(err)
+		}
+	}
+	wg.Add(2)
+	go run()
+	<-first
+	go run()
+	// Give the second run time to overtake the first if it could.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if result, _ := checker.Result("logging-1"); result.Status != server.StatusOK {
+		t.Errorf("recorded status = %q, want the latest check's %q", result.Status, server.StatusOK)
+	}
+	var transitions []string
+	for _, e := range events.Recent() {
+		transitions = append(transitions, e.PreviousHealth+"->"+e.Health)
+	}
+	if want := []string{"->unhealthy", "unhealthy->ok"}; !slices.Equal(transitions, want) {
+		t.Errorf("health events = %q, want %q", transitions, want)
+	}
+}
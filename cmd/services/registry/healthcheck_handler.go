@@ -1,10 +1,8 @@
 package main
 
 import (
-	"demo/registry"
-	"demo/server"
+	"demo/auth"
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
 
@@ -12,52 +10,26 @@ import (
 )
 
 type HealthCheckHandler struct {
-	Registry registry.ServiceRegistry
+	Checker *HealthChecker
+
+	// Policy, when set, restricts who may read the health of all services.
+	Policy *auth.Policy
 }
 
 func (rh *HealthCheckHandler) RegisterRoutes(r *chi.Mux) {
-	r.Get("/healthchecks", rh.HandleHealthCheck)
+	r.With(rh.Policy.Require(auth.PermReadHealth)).Get("/healthchecks", rh.HandleHealthCheck)
 }
 
-// HandleHealthCheck pings all registered services to ensure they are up and running
+// HandleHealthCheck returns the health of all registered services as of the
+// background checker's last run
 func (rh *HealthCheckHandler) HandleHealthCheck(w http.ResponseWriter, r *http.Request) {
-	services, err := rh.Registry.GetServices()
+	healthCheckResults, err := rh.Checker.Results()
 	if err != nil {
 		log.Println("Failed to get services for health check:", err)
 		http.Error(w, "failed to get services for health check", http.StatusInternalServerError)
 		return
 	}
 
-	var healthCheckResults []server.HealthCheckResult
-
-	for _, service := range services {
-		healthCheckURL := service.HealthCheckEndpoint
-
-		resp, err := http.Get(healthCheckURL)
-		if err != nil {
-			result := server.HealthCheckResult{
-				ServiceID:   service.ID,
-				ServiceType: service.ServiceType,
-				Healthy:     false,
-				Message:     fmt.Sprintf("Health check failed: %v", err),
-			}
-			healthCheckResults = append(healthCheckResults, result)
-			continue
-		}
-		defer resp.Body.Close()
-
-		healthy := resp.StatusCode == http.StatusOK
-		message := fmt.Sprintf("Health check %s", http.StatusText(resp.StatusCode))
-
-		result := server.HealthCheckResult{
-			ServiceID:   service.ID,
-			ServiceType: service.ServiceType,
-			Healthy:     healthy,
-			Message:     message,
-		}
-		healthCheckResults = append(healthCheckResults, result)
-	}
-
 	// Encode results as JSON
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(healthCheckResults); err != nil {
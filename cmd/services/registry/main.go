@@ -1,32 +1,54 @@
 package main
 
 import (
+	"context"
+	"demo/auth"
+	"demo/metrics"
 	"demo/registry"
 	"demo/server"
+	"demo/tracing"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-func setupRouter() *chi.Mux {
+func setupRouter(registry registry.ServiceRegistry, checker *HealthChecker, m *metrics.Registry, client *http.Client, creds auth.Credentials, policy *auth.Policy, events *registry.EventStream) *chi.Mux {
 	router := chi.NewRouter()
 	router.Use(middleware.Logger)
 
-	registry := &registry.InMemoryServiceRegistry{}
 	registrationHandler := &RegistrationHandler{
-		Registry: registry,
+		Registry:    registry,
+		Metrics:     newRegistrarMetrics(m, registry, checker),
+		Client:      client,
+		Credentials: creds,
+		Tokens:      &auth.InstanceTokens{},
+		Policy:      policy,
+		Events:      events,
 	}
 
 	healthCheckHandler := &HealthCheckHandler{
-		Registry: registry,
+		Checker: checker,
+		Policy:  policy,
 	}
 
+	eventsHandler := &EventsHandler{
+		Events: events,
+		Policy: policy,
+	}
+
+	dashboardHandler := &DashboardHandler{}
+
 	registrationHandler.RegisterRoutes(router)
 	healthCheckHandler.RegisterRoutes(router)
+	eventsHandler.RegisterRoutes(router)
+	dashboardHandler.RegisterRoutes(router)
 
 	return router
 }
@@ -35,18 +57,109 @@ func main() {
 	port := flag.Int("port", 8080, "Port for the HTTP server")
 	registrationAddr := flag.String("registration-addr", "http://localhost:8080/register", "Registration service endpoint")
 	deregistrationAddr := flag.String("deregistration-addr", "http://localhost:8080/deregister", "Deregistration service endpoint")
+	healthInterval := flag.Duration("health-interval", 10*time.Second, "Interval between background health checks of registered services")
+	traceExport := flag.String("trace-export", "", `Export spans as JSON lines to "stdout" or a file path (empty to disable)`)
+	authFile := flag.String("auth-file", "", "JSON file mapping service types to registration secrets (empty allows anyone to register)")
+	authSecret := flag.String("auth-secret", "", "Secret this service authenticates its own registration with")
+	authHMAC := flag.Bool("auth-hmac", false, "Sign registration requests with the secret instead of sending it as a bearer token")
+	policyFile := flag.String("policy-file", "", "JSON role-based access policy for listing, discovery, health checks and admin operations (empty allows anyone to read and no one to administer)")
+	tlsCert := flag.String("tls-cert", "", "Certificate file; enables HTTPS and is presented as client certificate on outgoing calls")
+	tlsKey := flag.String("tls-key", "", "Private key file for -tls-cert")
+	tlsCA := flag.String("tls-ca", "", "CA file used to verify other services and, with -tls-client-auth, their client certificates")
+	tlsClientAuth := flag.Bool("tls-client-auth", false, "Require client certificates signed by -tls-ca (mutual TLS)")
+	rateLimit := flag.Float64("rate-limit", 0, "Requests per second each client IP may make (0 disables rate limiting)")
+	rateBurst := flag.Int("rate-burst", 20, "Requests a client IP may make at once before -rate-limit applies")
+	maxBodyBytes := flag.Int64("max-body-bytes", 1<<20, "Largest request body accepted (0 disables the limit)")
+	maxConcurrent := flag.Int("max-concurrent", 0, "Requests handled at once across all clients (0 disables the limit)")
+	tags := flag.String("tags", "", "Comma-separated tags this instance registers with, e.g. eu-west,canary")
+	version := flag.String("version", "", "Version this instance registers with, which traffic policies split requests by")
+	weight := flag.Int("weight", 1, "Share of the requests to its version this instance receives, relative to the others")
+	eventLog := flag.String("event-log", "", "JSON lines file the history of registry events is appended to and loaded from (empty keeps recent events in memory only)")
+	describe := flag.Bool("describe", false, "Print the service type, required services and health check endpoint as JSON and exit")
 	flag.Parse()
 
+	var tlsConfig *server.TLSConfig
+	if *tlsCert != "" {
+		tlsConfig = &server.TLSConfig{CertFile: *tlsCert, KeyFile: *tlsKey, CAFile: *tlsCA, RequireClientCert: *tlsClientAuth}
+	}
+	scheme := tlsConfig.Scheme()
+
+	serviceType, requiredServices := "Registrar", []string{}
+	healthCheckEndpoint := fmt.Sprintf("%s://localhost:%d/healthcheck", scheme, *port)
+	if *describe {
+		if err := server.Describe(os.Stdout, server.Description{
+			ServiceType:         serviceType,
+			RequiredServices:    requiredServices,
+			HealthCheckEndpoint: healthCheckEndpoint,
+		}); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	exporter, err := tracing.NewExporter(*traceExport)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tracer := &tracing.Tracer{Service: "Registrar", Exporter: exporter}
+	client, err := server.NewClient(tracer, tlsConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var creds auth.Credentials
+	if *authFile != "" {
+		if creds, err = auth.LoadCredentials(*authFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var policy *auth.Policy
+	if *policyFile != "" {
+		if policy, err = auth.LoadPolicy(*policyFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	reg := &registry.InMemoryServiceRegistry{}
+	events := &registry.EventStream{Path: *eventLog}
+	if err := events.Open(); err != nil {
+		log.Fatal(err)
+	}
+	checker := &HealthChecker{Registry: reg, Client: client, Events: events}
+	m := metrics.NewRegistry()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go checker.Run(ctx, *healthInterval)
+
 	server := &server.Server{
-		Router:               setupRouter(),
+		Router:               setupRouter(reg, checker, m, client, creds, policy, events),
 		RegistrationAddr:     *registrationAddr,
 		DeregistrationAddr:   *deregistrationAddr,
 		Port:                 *port,
-		ServiceType:          "Registrar",
-		RequiredServices:     []string{},
-		ConnectedInstances:   make(registry.ConnectedInstances),
-		NotificationEndpoint: fmt.Sprintf("http://localhost:%d/notify", *port),
-		HealthCheckEndpoint:  fmt.Sprintf("http://localhost:%d/healthcheck", *port),
+		ServiceType:          serviceType,
+		RequiredServices:     requiredServices,
+		Tags:                 registry.ParseTags(*tags),
+		Version:              *version,
+		Weight:               *weight,
+		NotificationEndpoint: fmt.Sprintf("%s://localhost:%d/notify", scheme, *port),
+		HealthCheckEndpoint:  healthCheckEndpoint,
+		Metrics:              m,
+		Tracer:               tracer,
+		Client:               client,
+		Signer:               auth.Signer{Secret: *authSecret, HMAC: *authHMAC},
+		TLS:                  tlsConfig,
+		OnShutdown:           events.Close,
+		Limits: &server.Limits{
+			Rate:          *rateLimit,
+			Burst:         *rateBurst,
+			MaxBodyBytes:  *maxBodyBytes,
+			MaxConcurrent: *maxConcurrent,
+			// Registrations are small; refuse anything larger early.
+			RouteMaxBodyBytes: map[string]int64{"/register": 64 << 10},
+		},
 	}
 
 	var wg sync.WaitGroup
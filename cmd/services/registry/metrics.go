@@ -0,0 +1,61 @@
+package main
+
+import (
+	"demo/metrics"
+	"demo/registry"
+)
+
+// registrarMetrics are the registrar-specific metrics beyond the HTTP ones
+// every server.Server exposes.
+type registrarMetrics struct {
+	// notificationQueue is the number of notifications waiting to be delivered.
+	notificationQueue *metrics.Value
+
+	// notificationFailures counts failed deliveries by the receiving service type.
+	notificationFailures *metrics.CounterVec
+}
+
+func newRegistrarMetrics(m *metrics.Registry, reg registry.ServiceRegistry, checker *HealthChecker) *registrarMetrics {
+	m.NewGaugeFunc("registry_instances", "Registered instances, by service type.", []string{"service_type"}, func(emit metrics.Emit) {
+		services, err := reg.GetServices()
+		if err != nil {
+			return
+		}
+		counts := make(map[string]int)
+		for _, service := range services {
+			counts[service.ServiceType]++
+		}
+		for serviceType, n := range counts {
+			emit(float64(n), serviceType)
+		}
+	})
+
+	m.NewGaugeFunc("registry_instances_health", "Registered instances by service type and last health check result.", []string{"service_type", "health"}, func(emit metrics.Emit) {
+		services, err := reg.GetServices()
+		if err != nil {
+			return
+		}
+		type key struct{ serviceType, health string }
+		counts := make(map[key]int)
+		for _, service := range services {
+			health := "unknown"
+			if result, ok := checker.Result(service.ID); ok {
+				health = "unhealthy"
+				if result.Healthy {
+					health = "healthy"
+				}
+			}
+			counts[key{service.ServiceType, health}]++
+		}
+		for k, n := range counts {
+			emit(float64(n), k.serviceType, k.health)
+		}
+	})
+
+	return &registrarMetrics{
+		notificationQueue: m.NewGaugeVec("registry_notification_queue_depth",
+			"Notifications to dependent services waiting to be delivered.").With(),
+		notificationFailures: m.NewCounterVec("registry_notification_failures_total",
+			"Failed notification deliveries, by receiving service type.", "service_type"),
+	}
+}
@@ -2,62 +2,186 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"demo/auth"
 	"demo/registry"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
+// NotificationAttempts is how many times a notification rejected with 401 is
+// sent, NotificationRetryDelay apart.
+const (
+	NotificationAttempts   = 3
+	NotificationRetryDelay = 200 * time.Millisecond
+)
+
 type RegistrationHandler struct {
 	Registry registry.ServiceRegistry
+	Metrics  *registrarMetrics
+
+	// Client delivers notifications to dependent services.
+	Client *http.Client
+
+	// Credentials, when set, require instances to authenticate with their
+	// service type's secret to register.
+	Credentials auth.Credentials
+
+	// Tokens holds the secret issued to each registered instance, which only
+	// that instance can present to deregister itself.
+	Tokens *auth.InstanceTokens
+
+	// Policy, when set, restricts who may list and discover services. Forced
+	// deregistration, admin state changes and traffic policy changes need
+	// it: without a policy they are refused.
+	Policy *auth.Policy
+
+	// Events, when set, receives an event for every registration and
+	// deregistration.
+	Events *registry.EventStream
+
+	// TrafficPolicies holds the traffic policies set through /policies,
+	// which are pushed to the dependents of each policy's service type.
+	TrafficPolicies registry.TrafficPolicies
 }
 
 func (rh *RegistrationHandler) RegisterRoutes(r *chi.Mux) {
 	r.Post("/register", rh.RegisterService)
-	r.Get("/services", rh.GetServices)
+	r.With(rh.Policy.Require(auth.PermListServices, auth.PermDiscoverServices)).Get("/services", rh.GetServices)
+	r.With(rh.Policy.Require(auth.PermListServices)).Get("/services/{id}", rh.GetService)
+	r.With(rh.Policy.Require(auth.PermListServices)).Get("/graph", rh.GetGraph)
+	r.Put("/services/{id}/state", rh.SetServiceState)
 	r.Delete("/deregister/{id}", rh.DeregisterService)
+	r.With(rh.Policy.Restrict(auth.PermDeregisterServices)).Delete("/admin/services/{id}", rh.ForceDeregisterService)
+	r.With(rh.Policy.Restrict(auth.PermSetServiceState)).Put("/admin/services/{id}/state", rh.ForceServiceState)
+	r.With(rh.Policy.Require(auth.PermListServices)).Get("/policies", rh.GetTrafficPolicies)
+	r.With(rh.Policy.Require(auth.PermListServices, auth.PermDiscoverServices)).Get("/policies/{serviceType}", rh.GetTrafficPolicy)
+	r.With(rh.Policy.Restrict(auth.PermWritePolicies)).Put("/policies/{serviceType}", rh.SetTrafficPolicy)
+	r.With(rh.Policy.Restrict(auth.PermWritePolicies)).Delete("/policies/{serviceType}", rh.DeleteTrafficPolicy)
 }
 
 func (rh *RegistrationHandler) RegisterService(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Println("Failed to read registration request:", err)
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
 	var registration *registry.Registration
-	if err := json.NewDecoder(r.Body).Decode(&registration); err != nil {
+	if err := json.Unmarshal(body, &registration); err != nil || registration == nil {
 		log.Println("Failed to decode registration request:", err)
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
 
+	if rh.Credentials != nil {
+		if err := auth.Verify(r, body, rh.Credentials[registration.ServiceType]); err != nil {
+			log.Printf("Rejected registration of %s: %v", registration.ServiceType, err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
 	registeredService, err := rh.Registry.PostService(registration)
 	if err != nil {
 		log.Println("Failed to register service:", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		if errors.Is(err, registry.ErrAlreadyRegistered) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
 		return
 	}
+	token := rh.Tokens.Issue(registeredService.ID)
+	after := *registeredService
+	rh.publish(r, registry.Event{
+		Type:        registry.EventRegistered,
+		ServiceID:   after.ID,
+		ServiceType: after.ServiceType,
+		Actor:       after.ServiceType,
+		After:       &after,
+	})
+	warnings := rh.cycleWarnings(registeredService.ServiceType)
 
-	err = rh.findAndNotifyDependentServices("register", registration)
-	if err != nil {
+	// The instance is registered whether or not every dependent hears about
+	// it; failing here would withhold the token it needs to deregister.
+	if err := rh.findAndNotifyDependentServices(r.Context(), "register", registration); err != nil {
 		log.Println("Failed to notify dependent services:", err)
-		http.Error(w, "failed to notify dependent services", http.StatusInternalServerError)
-		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(registeredService)
+	json.NewEncoder(w).Encode(registry.RegistrationResponse{
+		Registration:  *registeredService,
+		InstanceToken: token,
+		Warnings:      warnings,
+		Policies:      rh.requiredPolicies(registeredService),
+	})
 }
 
+// GetServices lists all registered services, or only those of the type given
+// by the type query parameter and labeled with the tag query parameter.
+// Callers that may only discover are limited to the types their own service
+// requires.
 func (rh *RegistrationHandler) GetServices(w http.ResponseWriter, r *http.Request) {
-	services, err := rh.Registry.GetServices()
+	serviceType := r.URL.Query().Get("type")
+
+	if rh.Policy != nil && !rh.Policy.Allowed(auth.Identity(r.Context()), auth.PermListServices) {
+		if !rh.requires(auth.Identity(r.Context()), serviceType) {
+			log.Printf("Denied discovery of %q to %s", serviceType, auth.Identity(r.Context()))
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+	}
+
+	var services []registry.Registration
+	var err error
+	if serviceType != "" {
+		services, err = rh.Registry.GetServicesByType(serviceType)
+	} else {
+		services, err = rh.Registry.GetServices()
+	}
 	if err != nil {
 		log.Println("failed to get services")
 		http.Error(w, "failed to get services", http.StatusInternalServerError)
 		return
 	}
 
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		tagged := []registry.Registration{}
+		for _, service := range services {
+			if service.HasTag(tag) {
+				tagged = append(tagged, service)
+			}
+		}
+		services = tagged
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(services)
 }
 
+// GetService returns the registered service with the given ID.
+func (rh *RegistrationHandler) GetService(w http.ResponseWriter, r *http.Request) {
+	service, err := rh.Registry.GetServiceByID(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "service not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(service)
+}
+
 func (rh *RegistrationHandler) DeregisterService(w http.ResponseWriter, r *http.Request) {
 	serviceID := chi.URLParam(r, "id")
 
@@ -75,48 +199,295 @@ func (rh *RegistrationHandler) DeregisterService(w http.ResponseWriter, r *http.
 		return
 	}
 
-	err = rh.findAndNotifyDependentServices("deregister", service)
+	// Only the instance that registered may deregister itself.
+	token, _ := rh.Tokens.Get(serviceID)
+	if err := auth.Verify(r, nil, token); err != nil {
+		log.Printf("Rejected deregistration of %s: %v", serviceID, err)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
 
+	rh.deregister(w, r, service, service.ServiceType)
+}
+
+// ForceDeregisterService deregisters any instance on behalf of an administrator.
+func (rh *RegistrationHandler) ForceDeregisterService(w http.ResponseWriter, r *http.Request) {
+	serviceID := chi.URLParam(r, "id")
+
+	service, err := rh.Registry.GetServiceByID(serviceID)
 	if err != nil {
-		log.Println("Failed to notify dependent services:", err)
-		http.Error(w, "failed to notify dependent services", http.StatusInternalServerError)
+		log.Println("Failed to get service by ID:", err)
+		http.Error(w, "service not found", http.StatusNotFound)
 		return
 	}
 
-	err = rh.Registry.DeleteService(serviceID)
+	actor := auth.Identity(r.Context())
+	if actor == "" {
+		actor = "anonymous"
+	}
+	log.Printf("Forcibly deregistering %s (%s) on behalf of %s", serviceID, service.ServiceType, actor)
+	rh.deregister(w, r, service, actor)
+}
+
+// deregister removes service on behalf of actor, who is recorded in the event log.
+func (rh *RegistrationHandler) deregister(w http.ResponseWriter, r *http.Request, service *registry.Registration, actor string) {
+	serviceID := service.ID
+
+	// A dependent that cannot be reached must not keep the instance
+	// registered, so it is removed whether or not every dependent heard.
+	if err := rh.findAndNotifyDependentServices(r.Context(), "deregister", service); err != nil {
+		log.Println("Failed to notify dependent services:", err)
+	}
+
+	err := rh.Registry.DeleteService(serviceID)
 	if err != nil {
 		log.Println("Failed to delete service:", err)
 		http.Error(w, "failed to delete service", http.StatusInternalServerError)
 		return
 	}
+	rh.Tokens.Revoke(serviceID)
+	rh.publish(r, registry.Event{
+		Type:        registry.EventDeregistered,
+		ServiceID:   service.ID,
+		ServiceType: service.ServiceType,
+		Actor:       actor,
+		Before:      service,
+	})
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Service deregistered successfully"))
 }
 
-func (rh *RegistrationHandler) findAndNotifyDependentServices(action string, service *registry.Registration) error {
-	dependentServices, err := rh.Registry.GetDependentServices(service.ServiceType)
+// SetServiceState sets the state of the instance making the request, which
+// authenticates with its instance token like deregistration.
+func (rh *RegistrationHandler) SetServiceState(w http.ResponseWriter, r *http.Request) {
+	serviceID := chi.URLParam(r, "id")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	service, err := rh.Registry.GetServiceByID(serviceID)
+	if err != nil {
+		http.Error(w, "service not found", http.StatusNotFound)
+		return
+	}
+
+	token, _ := rh.Tokens.Get(serviceID)
+	if err := auth.Verify(r, body, token); err != nil {
+		log.Printf("Rejected state change of %s: %v", serviceID, err)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	rh.setState(w, r, service, body, service.ServiceType)
+}
+
+// ForceServiceState sets the state of any instance on behalf of an administrator.
+func (rh *RegistrationHandler) ForceServiceState(w http.ResponseWriter, r *http.Request) {
+	serviceID := chi.URLParam(r, "id")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	service, err := rh.Registry.GetServiceByID(serviceID)
+	if err != nil {
+		http.Error(w, "service not found", http.StatusNotFound)
+		return
+	}
+
+	actor := auth.Identity(r.Context())
+	if actor == "" {
+		actor = "anonymous"
+	}
+	rh.setState(w, r, service, body, actor)
+}
+
+// setState applies the state in body to service on behalf of actor and
+// notifies the dependent services, so they stop or resume sending it requests.
+func (rh *RegistrationHandler) setState(w http.ResponseWriter, r *http.Request, service *registry.Registration, body []byte, actor string) {
+	var update registry.StateUpdate
+	if err := json.Unmarshal(body, &update); err != nil || !registry.ValidState(update.State) {
+		http.Error(w, "state must be active, draining or maintenance", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := rh.Registry.SetServiceState(service.ID, update.State)
+	if err != nil {
+		log.Println("Failed to set service state:", err)
+		http.Error(w, "service not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("%s (%s) is now %s, set by %s", service.ID, service.ServiceType, updated.State, actor)
+
+	rh.publish(r, registry.Event{
+		Type:        registry.EventUpdated,
+		ServiceID:   updated.ID,
+		ServiceType: updated.ServiceType,
+		Actor:       actor,
+		Before:      service,
+		After:       updated,
+	})
+
+	// The state has been applied, so a dependent that cannot be reached is
+	// logged and counted rather than reported to the caller as a failure.
+	if err := rh.findAndNotifyDependentServices(r.Context(), "update", updated); err != nil {
+		log.Println("Failed to notify dependent services:", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// GetGraph returns the service-type dependency graph as JSON, or as Graphviz
+// DOT with ?format=dot.
+func (rh *RegistrationHandler) GetGraph(w http.ResponseWriter, r *http.Request) {
+	services, err := rh.Registry.GetServices()
+	if err != nil {
+		log.Println("failed to get services")
+		http.Error(w, "failed to get services", http.StatusInternalServerError)
+		return
+	}
+	graph := registry.BuildGraph(services)
+
+	if r.URL.Query().Get("format") == "dot" {
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		w.Write([]byte(graph.DOT()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(graph)
+}
+
+// publish records e as requested by r.
+func (rh *RegistrationHandler) publish(r *http.Request, e registry.Event) {
+	if rh.Events == nil {
+		return
+	}
+	e.SourceIP, _, _ = net.SplitHostPort(r.RemoteAddr)
+	rh.Events.Publish(e)
+}
+
+// cycleWarnings logs and returns the dependency cycles serviceType is part of.
+func (rh *RegistrationHandler) cycleWarnings(serviceType string) []string {
+	services, err := rh.Registry.GetServices()
+	if err != nil {
+		return nil
+	}
+
+	var warnings []string
+	for _, cycle := range registry.BuildGraph(services).CyclesWith(serviceType) {
+		warning := fmt.Sprintf("dependency cycle between %s", strings.Join(cycle, ", "))
+		log.Printf("Warning: registration of %s completes a %s", serviceType, warning)
+		warnings = append(warnings, warning)
+	}
+	return warnings
+}
+
+// requires reports whether a registered service of type identity declares
+// serviceType among its RequiredServices.
+func (rh *RegistrationHandler) requires(identity, serviceType string) bool {
+	if serviceType == "" {
+		return false
+	}
+
+	services, err := rh.Registry.GetServices()
+	if err != nil {
+		return false
+	}
+	for _, service := range services {
+		if !strings.EqualFold(service.ServiceType, identity) {
+			continue
+		}
+		for _, required := range service.RequiredServices {
+			if required == serviceType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (rh *RegistrationHandler) findAndNotifyDependentServices(ctx context.Context, action string, service *registry.Registration) error {
+	return rh.notifyDependents(ctx, service.ServiceType, registry.NotificationPayload{
+		Action:       action,
+		Registration: *service,
+	})
+}
+
+// notifyDependents sends payload to every instance that requires serviceType.
+// A dependent that cannot be reached does not stop the others from being
+// notified; the failures are counted per dependent and returned together.
+func (rh *RegistrationHandler) notifyDependents(ctx context.Context, serviceType string, payload registry.NotificationPayload) error {
+	dependentServices, err := rh.Registry.GetDependentServices(serviceType)
+	if err != nil {
+		return err
+	}
+
+	payloadJSON, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
 
+	// Notifications stay queued until delivered or given up on.
+	rh.Metrics.notificationQueue.Add(float64(len(dependentServices)))
+
+	var errs []error
 	for _, dependentService := range dependentServices {
 		notificationURL := dependentService.NotificationEndpoint
 
-		payload := registry.NotificationPayload{
-			Action:       action,
-			Registration: *service,
+		resp, err := rh.notify(ctx, dependentService, payloadJSON)
+		rh.Metrics.notificationQueue.Dec()
+		if err != nil {
+			log.Printf("Failed to notify %s (%s): %v", dependentService.ID, notificationURL, err)
+			rh.Metrics.notificationFailures.With(dependentService.ServiceType).Inc()
+			errs = append(errs, fmt.Errorf("notify %s: %w", dependentService.ID, err))
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			log.Printf("Notification to %s rejected with status code: %d", notificationURL, resp.StatusCode)
+			rh.Metrics.notificationFailures.With(dependentService.ServiceType).Inc()
 		}
-		payloadJSON, err := json.Marshal(payload)
+	}
+
+	return errors.Join(errs...)
+}
+
+// notify posts payloadJSON to the notification endpoint of dependent, signed
+// with its instance token. A dependent that has just registered may not have
+// read its token from the registration response yet and rejects the
+// notification with 401, so that is retried a few times before giving up.
+func (rh *RegistrationHandler) notify(ctx context.Context, dependent registry.Registration, payloadJSON []byte) (*http.Response, error) {
+	token, _ := rh.Tokens.Get(dependent.ID)
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, dependent.NotificationEndpoint, bytes.NewReader(payloadJSON))
 		if err != nil {
-			return err
+			return nil, err
 		}
+		req.Header.Set("Content-Type", "application/json")
+
+		// Sign with the receiver's instance token so it can trust the payload.
+		auth.Signer{Secret: token, HMAC: true}.Sign(req, payloadJSON)
 
-		_, err = http.Post(notificationURL, "application/json", bytes.NewBuffer(payloadJSON))
+		resp, err := rh.Client.Do(req)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized || attempt == NotificationAttempts {
+			return resp, nil
 		}
-	}
 
-	return nil
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(NotificationRetryDelay):
+		}
+	}
 }
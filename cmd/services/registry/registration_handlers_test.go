@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"demo/auth"
+	"demo/metrics"
+	"demo/registry"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestNotifyDependentsRetriesUntilTokenIsKnown(t *testing.T) {
+	tests := []struct {
+		name     string
+		rejected int32
+		want     int32
+	}{
+		{"accepted at once", 0, 1},
+		{"token read after one rejection", 1, 2},
+		{"gives up after the last attempt", NotificationAttempts + 1, NotificationAttempts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			var token atomic.Value
+			token.Store("")
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if calls.Add(1) <= tt.rejected || auth.Verify(r, body, token.Load().(string)) != nil {
+					http.Error(w, "invalid notification signature", http.StatusUnauthorized)
+					return
+				}
+			}))
+			defer ts.Close()
+
+			reg := &registry.InMemoryServiceRegistry{}
+			dependent, err := reg.PostService(&registry.Registration{
+				ID:                   "business-1",
+				ServiceType:          "Business",
+				IP:                   "127.0.0.1",
+				Port:                 8082,
+				RequiredServices:     []string{"Logging"},
+				NotificationEndpoint: ts.URL + "/notify",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			rh := &RegistrationHandler{
+				Registry: reg,
+				Metrics:  newRegistrarMetrics(metrics.NewRegistry(), reg, &HealthChecker{}),
+				Client:   ts.Client(),
+				Tokens:   &auth.InstanceTokens{},
+			}
+			token.Store(rh.Tokens.Issue(dependent.ID))
+
+			err = rh.notifyDependents(context.Background(), "Logging", registry.NotificationPayload{Action: "register"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := calls.Load(); got != tt.want {
+				t.Errorf("notification sent %d times, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// newNotifyingHandler returns a handler whose registry holds a Business
+// instance for every notification endpoint, each requiring Logging.
+func newNotifyingHandler(t *testing.T, endpoints ...string) *RegistrationHandler {
+	t.Helper()
+
+	reg := &registry.InMemoryServiceRegistry{}
+	rh := &RegistrationHandler{
+		Registry: reg,
+		Metrics:  newRegistrarMetrics(metrics.NewRegistry(), reg, &HealthChecker{}),
+		Client:   http.DefaultClient,
+		Tokens:   &auth.InstanceTokens{},
+	}
+	for i, endpoint := range endpoints {
+		dependent, err := reg.PostService(&registry.Registration{
+			ID:                   fmt.Sprintf("business-%d", i+1),
+			ServiceType:          "Business",
+			IP:                   "127.0.0.1",
+			Port:                 8082 + i,
+			RequiredServices:     []string{"Logging"},
+			NotificationEndpoint: endpoint,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rh.Tokens.Issue(dependent.ID)
+	}
+	return rh
+}
+
+// unreachableURL returns the address of a server that has been shut down.
+func unreachableURL() string {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+	return ts.URL + "/notify"
+}
+
+func TestNotifyDependentsContinuesPastFailures(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer ts.Close()
+
+	rh := newNotifyingHandler(t, unreachableURL(), ts.URL+"/notify")
+
+	err := rh.notifyDependents(context.Background(), "Logging", registry.NotificationPayload{Action: "register"})
+	if err == nil {
+		t.Fatal("expected the unreachable dependent's error")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("reachable dependent notified %d times, want 1", got)
+	}
+}
+
+func TestRegisterServiceReturnsTokenWhenNotificationFails(t *testing.T) {
+	rh := newNotifyingHandler(t, unreachableURL())
+
+	body := `{"id":"logging-1","serviceType":"Logging","ip":"127.0.0.1","port":8081}`
+	rec := httptest.NewRecorder()
+	rh.RegisterService(rec, httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body)))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var resp registry.RegistrationResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.InstanceToken == "" {
+		t.Error("registration response has no instance token")
+	}
+	if token, ok := rh.Tokens.Get("logging-1"); !ok || token != resp.InstanceToken {
+		t.Error("returned token is not the one the registrar holds")
+	}
+}
+
+// failingRegistry fails every registration as a broken store would.
+type failingRegistry struct {
+	*registry.InMemoryServiceRegistry
+}
+
+func (failingRegistry) PostService(*registry.Registration) (*registry.Registration, error) {
+	return nil, errors.New("store unavailable")
+}
+
+func TestRegisterServiceRejectsDuplicates(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		broken bool
+		status int
+	}{
+		{"new instance", `{"id":"logging-2","serviceType":"Logging","ip":"127.0.0.1","port":8083}`, false, http.StatusOK},
+		{"same ID", `{"id":"logging-1","serviceType":"Logging","ip":"127.0.0.1","port":8083}`, false, http.StatusConflict},
+		{"same type, IP and port", `{"id":"logging-2","serviceType":"Logging","ip":"127.0.0.1","port":8081}`, false, http.StatusConflict},
+		{"storage failure", `{"id":"logging-2","serviceType":"Logging","ip":"127.0.0.1","port":8083}`, true, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rh := newNotifyingHandler(t)
+			register := func(body string) *httptest.ResponseRecorder {
+				rec := httptest.NewRecorder()
+				rh.RegisterService(rec, httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body)))
+				return rec
+			}
+			if rec := register(`{"id":"logging-1","serviceType":"Logging","ip":"127.0.0.1","port":8081}`); rec.Code != http.StatusOK {
+				t.Fatalf("first registration: status %d: %s", rec.Code, rec.Body)
+			}
+			token, _ := rh.Tokens.Get("logging-1")
+			if tt.broken {
+				rh.Registry = failingRegistry{rh.Registry.(*registry.InMemoryServiceRegistry)}
+			}
+
+			if rec := register(tt.body); rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if got, _ := rh.Tokens.Get("logging-1"); got != token {
+				t.Error("registration replaced the token of the registered instance")
+			}
+		})
+	}
+}
+
+func TestChangesAreAppliedWhenNotificationFails(t *testing.T) {
+	tests := []struct {
+		name  string
+		apply func(rh *RegistrationHandler, w http.ResponseWriter, r *http.Request, service *registry.Registration)
+		check func(t *testing.T, rh *RegistrationHandler)
+	}{
+		{
+			"state change",
+			func(rh *RegistrationHandler, w http.ResponseWriter, r *http.Request, service *registry.Registration) {
+				rh.setState(w, r, service, []byte(`{"state":"draining"}`), "ops")
+			},
+			func(t *testing.T, rh *RegistrationHandler) {
+				stored, err := rh.Registry.GetServiceByID("logging-1")
+				if err != nil || stored.State != registry.StateDraining {
+					t.Errorf("stored = %+v, %v; want draining", stored, err)
+				}
+			},
+		},
+		{
+			"deregistration",
+			func(rh *RegistrationHandler, w http.ResponseWriter, r *http.Request, service *registry.Registration) {
+				rh.deregister(w, r, service, "ops")
+			},
+			func(t *testing.T, rh *RegistrationHandler) {
+				if _, err := rh.Registry.GetServiceByID("logging-1"); err == nil {
+					t.Error("instance still registered")
+				}
+				if _, ok := rh.Tokens.Get("logging-1"); ok {
+					t.Error("instance token not revoked")
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rh := newNotifyingHandler(t, unreachableURL())
+			service, err := rh.Registry.PostService(&registry.Registration{
+				ID:          "logging-1",
+				ServiceType: "Logging",
+				IP:          "127.0.0.1",
+				Port:        8081,
+				State:       registry.StateActive,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			rh.Tokens.Issue(service.ID)
+
+			rec := httptest.NewRecorder()
+			tt.apply(rh, rec, httptest.NewRequest(http.MethodPut, "/", nil), service)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+			}
+			tt.check(t, rh)
+		})
+	}
+}
+
+func TestTrafficPolicyIsAppliedWhenNotificationFails(t *testing.T) {
+	rh := newNotifyingHandler(t, unreachableURL())
+
+	policy := registry.TrafficPolicy{ServiceType: "Logging", Splits: map[string]int{"v1": 90, "v2": 10}}
+	rec := httptest.NewRecorder()
+	rh.applyTrafficPolicy(rec, httptest.NewRequest(http.MethodPut, "/policies/Logging", nil), policy)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if stored, ok := rh.TrafficPolicies.Get("Logging"); !ok || stored.Splits["v2"] != 10 {
+		t.Errorf("stored policy = %+v, %v; want the policy just set", stored, ok)
+	}
+}
+
+func TestRegisterServiceWarnsAboutCycles(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		warnings []string
+	}{
+		{
+			"completes a cycle",
+			`{"id":"logging-1","serviceType":"Logging","ip":"127.0.0.1","port":8081,"dependentServices":["Business"]}`,
+			[]string{"dependency cycle between Business, Logging"},
+		},
+		{
+			"requires itself",
+			`{"id":"logging-1","serviceType":"Logging","ip":"127.0.0.1","port":8081,"dependentServices":["Logging"]}`,
+			[]string{"dependency cycle between Logging"},
+		},
+		{
+			"no cycle",
+			`{"id":"logging-1","serviceType":"Logging","ip":"127.0.0.1","port":8081}`,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer ts.Close()
+			rh := newNotifyingHandler(t, ts.URL+"/notify")
+
+			rec := httptest.NewRecorder()
+			rh.RegisterService(rec, httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(tt.body)))
+
+			var resp registry.RegistrationResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(resp.Warnings, tt.warnings) {
+				t.Errorf("Warnings = %q, want %q", resp.Warnings, tt.warnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"demo/auth"
+	"demo/registry"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetTrafficPolicies lists the traffic policies of all service types.
+func (rh *RegistrationHandler) GetTrafficPolicies(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rh.TrafficPolicies.List())
+}
+
+// GetTrafficPolicy returns the traffic policy of a service type. Callers that
+// may only discover are limited to the types their own service requires.
+func (rh *RegistrationHandler) GetTrafficPolicy(w http.ResponseWriter, r *http.Request) {
+	serviceType := chi.URLParam(r, "serviceType")
+
+	if rh.Policy != nil && !rh.Policy.Allowed(auth.Identity(r.Context()), auth.PermListServices) {
+		if !rh.requires(auth.Identity(r.Context()), serviceType) {
+			log.Printf("Denied traffic policy of %q to %s", serviceType, auth.Identity(r.Context()))
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+	}
+
+	policy, ok := rh.TrafficPolicies.Get(serviceType)
+	if !ok {
+		http.Error(w, "traffic policy not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
+
+// SetTrafficPolicy sets the percentage of requests each version of a service
+// type receives and pushes the policy to the services that require the type.
+func (rh *RegistrationHandler) SetTrafficPolicy(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var policy registry.TrafficPolicy
+	if err := json.Unmarshal(body, &policy); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	policy.ServiceType = chi.URLParam(r, "serviceType")
+	if err := policy.Validate(); err != nil {
+		http.Error(w, "invalid traffic policy: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rh.applyTrafficPolicy(w, r, policy)
+}
+
+// DeleteTrafficPolicy removes the traffic policy of a service type, so its
+// dependents go back to sending requests to the instance they are connected to.
+func (rh *RegistrationHandler) DeleteTrafficPolicy(w http.ResponseWriter, r *http.Request) {
+	serviceType := chi.URLParam(r, "serviceType")
+	if _, ok := rh.TrafficPolicies.Get(serviceType); !ok {
+		http.Error(w, "traffic policy not found", http.StatusNotFound)
+		return
+	}
+
+	rh.applyTrafficPolicy(w, r, registry.TrafficPolicy{ServiceType: serviceType})
+}
+
+// applyTrafficPolicy stores policy, where a policy without splits removes
+// the current one, records the change and notifies the dependent services.
+func (rh *RegistrationHandler) applyTrafficPolicy(w http.ResponseWriter, r *http.Request, policy registry.TrafficPolicy) {
+	actor := auth.Identity(r.Context())
+	if actor == "" {
+		actor = "anonymous"
+	}
+
+	previous, replaced := rh.TrafficPolicies.Set(policy)
+	log.Printf("Traffic policy of %s set to %v by %s", policy.ServiceType, policy.Splits, actor)
+
+	event := registry.Event{
+		Type:        registry.EventPolicyChanged,
+		ServiceType: policy.ServiceType,
+		Actor:       actor,
+	}
+	if replaced {
+		event.PreviousPolicy = &previous
+	}
+	if len(policy.Splits) > 0 {
+		event.Policy = &policy
+	}
+	rh.publish(r, event)
+
+	payload := registry.NotificationPayload{
+		Action:       "policy",
+		Registration: registry.Registration{ServiceType: policy.ServiceType},
+		Policy:       &policy,
+	}
+	// The policy is in effect for new registrations either way, so a
+	// dependent that cannot be reached is logged rather than failing the call.
+	if err := rh.notifyDependents(r.Context(), policy.ServiceType, payload); err != nil {
+		log.Println("Failed to notify dependent services:", err)
+	}
+
+	if len(policy.Splits) == 0 {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Traffic policy removed"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
+
+// requiredPolicies returns the traffic policies of the service types service
+// requires.
+func (rh *RegistrationHandler) requiredPolicies(service *registry.Registration) []registry.TrafficPolicy {
+	var policies []registry.TrafficPolicy
+	for _, serviceType := range service.RequiredServices {
+		if policy, ok := rh.TrafficPolicies.Get(serviceType); ok {
+			policies = append(policies, policy)
+		}
+	}
+	return policies
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const (
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+
+	// stableAfter is how long a process must run before a crash resets the backoff.
+	stableAfter = time.Minute
+)
+
+var errExited = errors.New("process exited")
+
+// child runs one service, restarting it whenever it exits until stopped.
+type child struct {
+	Service
+	stopTimeout time.Duration
+
+	stop    chan struct{}
+	stopped chan struct{}
+
+	mu      sync.Mutex
+	running bool
+}
+
+func startChild(svc Service, stopTimeout time.Duration) *child {
+	c := &child{
+		Service:     svc,
+		stopTimeout: stopTimeout,
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	go c.supervise()
+	return c
+}
+
+func (c *child) supervise() {
+	defer close(c.stopped)
+
+	backoff := minBackoff
+	for {
+		cmd := exec.Command(c.Command[0], c.Command[1:]...)
+		cmd.Stdout = &prefixWriter{prefix: c.Name, out: os.Stdout}
+		cmd.Stderr = &prefixWriter{prefix: c.Name, out: os.Stderr}
+		setProcessGroup(cmd)
+
+		if err := cmd.Start(); err != nil {
+			log.Printf("Failed to start %s: %v", c.Name, err)
+		} else {
+			log.Printf("Started %s (pid %d)", c.Name, cmd.Process.Pid)
+			c.setRunning(true)
+			start := time.Now()
+
+			exited := make(chan error, 1)
+			go func() { exited <- cmd.Wait() }()
+
+			select {
+			case <-c.stop:
+				c.terminate(cmd, exited)
+				c.setRunning(false)
+				return
+			case err := <-exited:
+				c.setRunning(false)
+				log.Printf("%s exited unexpectedly: %v", c.Name, err)
+				if time.Since(start) > stableAfter {
+					backoff = minBackoff
+				}
+			}
+		}
+
+		log.Printf("Restarting %s in %s", c.Name, backoff)
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// terminate interrupts the process so it can deregister, killing it if it
+// does not exit within stopTimeout.
+func (c *child) terminate(cmd *exec.Cmd, exited <-chan error) {
+	log.Printf("Stopping %s...", c.Name)
+	cmd.Process.Signal(os.Interrupt)
+
+	select {
+	case <-exited:
+		log.Printf("Stopped %s", c.Name)
+	case <-time.After(c.stopTimeout):
+		log.Printf("%s did not stop within %s, killing it", c.Name, c.stopTimeout)
+		cmd.Process.Kill()
+		<-exited
+	}
+}
+
+// Stop stops the service and waits until it exited.
+func (c *child) Stop() {
+	close(c.stop)
+	<-c.stopped
+}
+
+// WaitReady waits until the service's Ready URL answers 200.
+func (c *child) WaitReady(ctx context.Context, timeout time.Duration) error {
+	if c.Ready == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client := &http.Client{Timeout: time.Second}
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if c.isRunning() {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Ready, nil)
+			if err != nil {
+				return err
+			}
+			if resp, err := client.Do(req); err == nil {
+				resp.Body.Close()
+				if resp.StatusCode == http.StatusOK {
+					return nil
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.stopped:
+			return errExited
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *child) setRunning(running bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running = running
+}
+
+func (c *child) isRunning() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.running
+}
+
+// prefixWriter writes each complete line of a child's output prefixed with
+// the service name.
+type prefixWriter struct {
+	prefix string
+	out    *os.File
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		fmt.Fprintf(w.out, "[%s] %s\n", w.prefix, w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
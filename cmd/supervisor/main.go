@@ -0,0 +1,205 @@
+// Command supervisor runs the registrar and the services in dependency order.
+// It starts a service only once everything it requires is ready, restarts
+// services that crash with exponential backoff and, on interrupt, stops them
+// in reverse order.
+//
+//	go run ./cmd/supervisor
+//	go run ./cmd/supervisor -config services.json
+package main
+
+import (
+	"context"
+	"demo/server"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// Service describes one supervised process.
+type Service struct {
+	Name string `json:"name"`
+
+	// Command is the program and its arguments.
+	Command []string `json:"command"`
+
+	// Requires names the services that must be ready before this one starts.
+	// For the default services, these are the service's RequiredServices,
+	// as reported by -describe, plus the Registrar it registers with.
+	Requires []string `json:"requires"`
+
+	// Ready is a URL that answers 200 once the service is ready. Empty
+	// considers the service ready as soon as it started.
+	Ready string `json:"ready"`
+}
+
+// defaultBinaries are the programs in cmd/services, registrar first.
+var defaultBinaries = []string{"registry", "logging", "business"}
+
+// defaultServices asks each of the default binaries in binDir to -describe
+// itself, so the start order follows the services' own RequiredServices.
+func defaultServices(binDir string) ([]Service, error) {
+	var services []Service
+	var registrar string
+	for _, binary := range defaultBinaries {
+		path := filepath.Join(binDir, binary)
+		out, err := exec.Command(path, "-describe").Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe %s: %w", path, err)
+		}
+		var d server.Description
+		if err := json.Unmarshal(out, &d); err != nil {
+			return nil, fmt.Errorf("invalid description of %s: %w", path, err)
+		}
+
+		svc := Service{
+			Name:     d.ServiceType,
+			Command:  []string{path},
+			Requires: d.RequiredServices,
+			Ready:    d.HealthCheckEndpoint,
+		}
+		// Every other service registers with the registrar.
+		if registrar == "" {
+			registrar = svc.Name
+		} else {
+			svc.Requires = append([]string{registrar}, svc.Requires...)
+		}
+		services = append(services, svc)
+	}
+	return services, nil
+}
+
+func main() {
+	configPath := flag.String("config", "", "JSON file listing the services to supervise (empty runs the services in cmd/services)")
+	binDir := flag.String("bin-dir", "bin", "Directory the default services are built into and run from")
+	build := flag.Bool("build", true, "Build the default services into -bin-dir before starting them")
+	readyTimeout := flag.Duration("ready-timeout", 30*time.Second, "How long to wait for a service to become ready")
+	stopTimeout := flag.Duration("stop-timeout", 15*time.Second, "How long to wait for a service to stop before killing it")
+	flag.Parse()
+
+	var services []Service
+	var err error
+	if *configPath != "" {
+		if services, err = loadServices(*configPath); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		if *build {
+			log.Printf("Building services into %s...", *binDir)
+			cmd := exec.Command("go", "build", "-o", *binDir+string(filepath.Separator), "./cmd/services/...")
+			cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+			if err := cmd.Run(); err != nil {
+				log.Fatalf("Failed to build services: %v", err)
+			}
+		}
+		if services, err = defaultServices(*binDir); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	order, err := startOrder(services)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var started []*child
+	teardown := func() {
+		for i := len(started) - 1; i >= 0; i-- {
+			started[i].Stop()
+		}
+	}
+
+	for _, svc := range order {
+		c := startChild(svc, *stopTimeout)
+		started = append(started, c)
+
+		if err := c.WaitReady(ctx, *readyTimeout); err != nil {
+			log.Printf("%s did not become ready: %v", svc.Name, err)
+			teardown()
+			os.Exit(1)
+		}
+		log.Printf("%s is ready", svc.Name)
+	}
+
+	<-ctx.Done()
+	log.Println("Stopping services...")
+	teardown()
+	log.Println("All services stopped.")
+}
+
+func loadServices(path string) ([]Service, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var services []Service
+	if err := json.Unmarshal(data, &services); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	for _, svc := range services {
+		if svc.Name == "" || len(svc.Command) == 0 {
+			return nil, fmt.Errorf("invalid config file %s: every service needs a name and a command", path)
+		}
+	}
+	return services, nil
+}
+
+// startOrder sorts services so each comes after everything it requires,
+// keeping the configured order otherwise.
+func startOrder(services []Service) ([]Service, error) {
+	byName := make(map[string]Service, len(services))
+	for _, svc := range services {
+		if _, dup := byName[svc.Name]; dup {
+			return nil, fmt.Errorf("service %s is defined twice", svc.Name)
+		}
+		byName[svc.Name] = svc
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(services))
+	var order []Service
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle: %v", append(path, name))
+		}
+
+		svc, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("%s requires unknown service %s", path[len(path)-1], name)
+		}
+		state[name] = visiting
+		for _, required := range svc.Requires {
+			if err := visit(required, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		order = append(order, svc)
+		return nil
+	}
+
+	for _, svc := range services {
+		if err := visit(svc.Name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
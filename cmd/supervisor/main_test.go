@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestStartOrder(t *testing.T) {
+	svc := func(name string, requires ...string) Service {
+		return Service{Name: name, Requires: requires}
+	}
+
+	tests := []struct {
+		name     string
+		services []Service
+		want     []string
+		err      string
+	}{
+		{
+			name:     "linear chain",
+			services: []Service{svc("Business", "Logging"), svc("Logging", "Registrar"), svc("Registrar")},
+			want:     []string{"Registrar", "Logging", "Business"},
+		},
+		{
+			name: "diamond",
+			services: []Service{
+				svc("Business", "Logging", "Billing"),
+				svc("Logging", "Registrar"),
+				svc("Billing", "Registrar"),
+				svc("Registrar"),
+			},
+			want: []string{"Registrar", "Logging", "Billing", "Business"},
+		},
+		{
+			name:     "independent services keep their order",
+			services: []Service{svc("Logging"), svc("Registrar"), svc("Business")},
+			want:     []string{"Logging", "Registrar", "Business"},
+		},
+		{
+			name:     "cycle",
+			services: []Service{svc("Registrar"), svc("Logging", "Business"), svc("Business", "Logging")},
+			err:      "dependency cycle: [Logging Business Logging]",
+		},
+		{
+			name:     "service requiring itself",
+			services: []Service{svc("Logging", "Logging")},
+			err:      "dependency cycle",
+		},
+		{
+			name:     "required type no service provides",
+			services: []Service{svc("Registrar"), svc("Business", "Registrar", "Billing")},
+			err:      "Business requires unknown service Billing",
+		},
+		{
+			name:     "service defined twice",
+			services: []Service{svc("Logging"), svc("Logging")},
+			err:      "service Logging is defined twice",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := startOrder(tt.services)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("startOrder() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, s := range order {
+				names = append(names, s.Name)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.want) {
+				t.Errorf("startOrder() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
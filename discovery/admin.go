@@ -0,0 +1,227 @@
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"demo/registry"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// StatusError is returned when the registrar answers with a status other
+// than 200.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("unexpected status code: %d: %s", e.StatusCode, e.Message)
+}
+
+// Services lists the registered services, filtered by serviceType and tag
+// unless empty.
+func (c *Client) Services(ctx context.Context, serviceType, tag string) ([]registry.Registration, error) {
+	query := url.Values{}
+	if serviceType != "" {
+		query.Set("type", serviceType)
+	}
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+	path := "/services"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var registrations []registry.Registration
+	if err := c.do(ctx, http.MethodGet, path, nil, &registrations); err != nil {
+		return nil, fmt.Errorf("failed to get services: %w", err)
+	}
+	return registrations, nil
+}
+
+// Service returns the registered service with the given ID.
+func (c *Client) Service(ctx context.Context, id string) (*registry.Registration, error) {
+	var registration registry.Registration
+	if err := c.do(ctx, http.MethodGet, "/services/"+url.PathEscape(id), nil, &registration); err != nil {
+		return nil, fmt.Errorf("failed to get service %s: %w", id, err)
+	}
+	return &registration, nil
+}
+
+// Deregister forcibly deregisters the instance with the given ID, which
+// requires the services:deregister permission.
+func (c *Client) Deregister(ctx context.Context, id string) error {
+	if err := c.do(ctx, http.MethodDelete, "/admin/services/"+url.PathEscape(id), nil, nil); err != nil {
+		return fmt.Errorf("failed to deregister %s: %w", id, err)
+	}
+	return nil
+}
+
+// HealthChecks checks the health of every registered service.
+func (c *Client) HealthChecks(ctx context.Context) ([]registry.HealthCheckResult, error) {
+	var results []registry.HealthCheckResult
+	if err := c.do(ctx, http.MethodGet, "/healthchecks", nil, &results); err != nil {
+		return nil, fmt.Errorf("failed to get health checks: %w", err)
+	}
+	return results, nil
+}
+
+// Graph returns the dependency graph of the registered service types.
+func (c *Client) Graph(ctx context.Context) (*registry.Graph, error) {
+	var graph registry.Graph
+	if err := c.do(ctx, http.MethodGet, "/graph", nil, &graph); err != nil {
+		return nil, fmt.Errorf("failed to get graph: %w", err)
+	}
+	return &graph, nil
+}
+
+// SetState sets the state of the instance with the given ID, which requires
+// the services:state permission, and returns the updated registration.
+func (c *Client) SetState(ctx context.Context, id, state string) (*registry.Registration, error) {
+	body, err := json.Marshal(registry.StateUpdate{State: state})
+	if err != nil {
+		return nil, err
+	}
+
+	var registration registry.Registration
+	if err := c.do(ctx, http.MethodPut, "/admin/services/"+url.PathEscape(id)+"/state", body, &registration); err != nil {
+		return nil, fmt.Errorf("failed to set state of %s: %w", id, err)
+	}
+	return &registration, nil
+}
+
+// TrafficPolicies returns the traffic policies of all service types.
+func (c *Client) TrafficPolicies(ctx context.Context) ([]registry.TrafficPolicy, error) {
+	var policies []registry.TrafficPolicy
+	if err := c.do(ctx, http.MethodGet, "/policies", nil, &policies); err != nil {
+		return nil, fmt.Errorf("failed to get traffic policies: %w", err)
+	}
+	return policies, nil
+}
+
+// SetTrafficPolicy sets the traffic policy of policy.ServiceType, which
+// requires the policies:write permission. A policy without splits removes
+// the current one.
+func (c *Client) SetTrafficPolicy(ctx context.Context, policy registry.TrafficPolicy) error {
+	path := "/policies/" + url.PathEscape(policy.ServiceType)
+	if len(policy.Splits) == 0 {
+		if err := c.do(ctx, http.MethodDelete, path, nil, nil); err != nil {
+			return fmt.Errorf("failed to remove traffic policy of %s: %w", policy.ServiceType, err)
+		}
+		return nil
+	}
+
+	body, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	if err := c.do(ctx, http.MethodPut, path, body, nil); err != nil {
+		return fmt.Errorf("failed to set traffic policy of %s: %w", policy.ServiceType, err)
+	}
+	return nil
+}
+
+// StreamEvents reads the registrar's event stream, which starts with the
+// recent events, and passes each event to fn until ctx is done, the
+// registrar ends the stream or fn returns an error. Reading events requires
+// the events:read permission.
+func (c *Client) StreamEvents(ctx context.Context, fn func(registry.Event) error) error {
+	client := http.DefaultClient
+	if c.HTTPClient != nil {
+		// The stream stays open, so a timeout on the whole request would cut it.
+		stream := *c.HTTPClient
+		stream.Timeout = 0
+		client = &stream
+	}
+
+	resp, err := c.send(ctx, client, http.MethodGet, "/events/stream", nil)
+	if err != nil {
+		return fmt.Errorf("failed to stream events: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Server-sent events: "data:" lines up to a blank line form one event;
+	// comments and the id and event fields are not needed.
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	var data []byte
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if value, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			data = append(data, bytes.TrimPrefix(value, []byte(" "))...)
+			continue
+		}
+		if len(line) > 0 || len(data) == 0 {
+			continue
+		}
+
+		var e registry.Event
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("failed to decode event: %w", err)
+		}
+		data = data[:0]
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to stream events: %w", err)
+	}
+	return nil
+}
+
+// do sends a signed request for path with body, which may be nil, to the
+// registrar and decodes the JSON response into out unless it is nil.
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out any) error {
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := c.send(ctx, client, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// send sends a signed request through client and returns the response if
+// its status is 200, or a StatusError otherwise.
+func (c *Client) send(ctx context.Context, client *http.Client, method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.RegistryAddr+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c.Signer.Sign(req, body)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	return resp, nil
+}
@@ -0,0 +1,286 @@
+// Package discovery resolves service types to their registered instances
+// through the registrar, caching results in memory and optionally on disk.
+package discovery
+
+import (
+	"context"
+	"demo/auth"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Instance is one registered instance of a service type.
+type Instance struct {
+	ID          string   `json:"id"`
+	ServiceType string   `json:"serviceType"`
+	IP          string   `json:"ip"`
+	Port        int      `json:"port"`
+	Scheme      string   `json:"scheme,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	State       string   `json:"state,omitempty"`
+	Version     string   `json:"version,omitempty"`
+	Weight      int      `json:"weight,omitempty"`
+
+	HealthCheckEndpoint string `json:"healthcheckEndpoint,omitempty"`
+}
+
+// URL returns the URL of path on the instance.
+func (i Instance) URL(path string) string {
+	scheme := i.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s:%d%s", scheme, i.IP, i.Port, path)
+}
+
+// Client resolves service types against the registrar. Results are fresh for
+// TTL; after that the cached instances are still returned while they are
+// refreshed in the background, so callers keep working while the registrar is
+// unreachable. With CacheDir set, results also survive restarts.
+type Client struct {
+	// RegistryAddr is the registrar's base URL, e.g. http://localhost:8080.
+	RegistryAddr string
+
+	// HTTPClient performs the lookups. Nil uses http.DefaultClient.
+	HTTPClient *http.Client
+
+	// Signer authenticates lookups when the registrar enforces an access policy.
+	Signer auth.Signer
+
+	// TTL is how long resolved instances are considered fresh. Defaults to 5s.
+	TTL time.Duration
+
+	// CacheDir, when set, stores the last resolved instances of every service
+	// type as <CacheDir>/<serviceType>.json.
+	CacheDir string
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+type entry struct {
+	Instances []Instance `json:"instances"`
+	Fetched   time.Time  `json:"fetched"`
+
+	refreshing bool
+}
+
+// Resolve returns the instances registered for serviceType.
+func (c *Client) Resolve(ctx context.Context, serviceType string) ([]Instance, error) {
+	c.mu.Lock()
+	e, ok := c.entries[serviceType]
+	if ok {
+		instances := e.Instances
+		if time.Since(e.Fetched) >= c.ttl() && !e.refreshing {
+			e.refreshing = true
+			go c.revalidate(serviceType)
+		}
+		c.mu.Unlock()
+		return instances, nil
+	}
+	c.mu.Unlock()
+
+	instances, err := c.refresh(ctx, serviceType)
+	if err == nil {
+		return instances, nil
+	}
+
+	// The registrar is unreachable and nothing is cached in memory; fall back
+	// to what a previous run saw.
+	if cached, ok := c.load(serviceType); ok {
+		log.Printf("Registrar unreachable, using cached instances of %s: %v", serviceType, err)
+		c.mu.Lock()
+		if c.entries == nil {
+			c.entries = make(map[string]*entry)
+		}
+		if _, exists := c.entries[serviceType]; !exists {
+			c.entries[serviceType] = cached
+		}
+		c.mu.Unlock()
+		return cached.Instances, nil
+	}
+	return nil, err
+}
+
+// Watch sends the instances of serviceType whenever they change, starting
+// with the current ones, and closes the channel when ctx is done. The
+// registrar is polled every TTL.
+func (c *Client) Watch(ctx context.Context, serviceType string) <-chan []Instance {
+	ch := make(chan []Instance, 1)
+
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(c.ttl())
+		defer ticker.Stop()
+
+		var last []Instance
+		sent := false
+		for {
+			instances, err := c.refresh(ctx, serviceType)
+			if err != nil {
+				// Keep the last known instances rather than reporting none.
+				instances, err = c.Resolve(ctx, serviceType)
+			}
+			if err == nil && (!sent || !reflect.DeepEqual(instances, last)) {
+				select {
+				case ch <- instances:
+					last, sent = instances, true
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return ch
+}
+
+func (c *Client) revalidate(serviceType string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := c.refresh(ctx, serviceType); err != nil {
+		log.Printf("Failed to refresh instances of %s, serving stale: %v", serviceType, err)
+		c.mu.Lock()
+		if e, ok := c.entries[serviceType]; ok {
+			e.refreshing = false
+		}
+		c.mu.Unlock()
+	}
+}
+
+// refresh fetches the instances of serviceType from the registrar and caches them.
+func (c *Client) refresh(ctx context.Context, serviceType string) ([]Instance, error) {
+	instances, err := c.fetch(ctx, serviceType)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &entry{Instances: instances, Fetched: time.Now()}
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]*entry)
+	}
+	c.entries[serviceType] = e
+	c.mu.Unlock()
+
+	c.store(serviceType, e)
+	return instances, nil
+}
+
+func (c *Client) fetch(ctx context.Context, serviceType string) ([]Instance, error) {
+	registrations, err := c.Services(ctx, serviceType, "")
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]Instance, 0, len(registrations))
+	for _, r := range registrations {
+		instances = append(instances, Instance{
+			ID:          r.ID,
+			ServiceType: r.ServiceType,
+			IP:          r.IP,
+			Port:        r.Port,
+			Scheme:      r.Scheme,
+			Tags:        r.Tags,
+			State:       r.State,
+			Version:     r.Version,
+			Weight:      r.Weight,
+
+			HealthCheckEndpoint: r.HealthCheckEndpoint,
+		})
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].ID < instances[j].ID })
+	return instances, nil
+}
+
+func (c *Client) ttl() time.Duration {
+	if c.TTL <= 0 {
+		return 5 * time.Second
+	}
+	return c.TTL
+}
+
+func (c *Client) cachePath(serviceType string) string {
+	return filepath.Join(c.CacheDir, filepath.Base(serviceType)+".json")
+}
+
+func (c *Client) store(serviceType string, e *entry) {
+	if c.CacheDir == "" {
+		return
+	}
+	if err := os.MkdirAll(c.CacheDir, 0o755); err != nil {
+		log.Println("Failed to create discovery cache directory:", err)
+		return
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	// Write then rename so a crash never leaves a truncated cache behind.
+	// Each write gets its own temporary file, so a revalidation and a watch
+	// storing the same type never rename each other's partial writes.
+	if err := writeFileAtomic(c.CacheDir, c.cachePath(serviceType), data); err != nil {
+		log.Println("Failed to write discovery cache:", err)
+	}
+}
+
+// writeFileAtomic replaces path with data through a uniquely named temporary
+// file in dir.
+func writeFileAtomic(dir, path string, data []byte) error {
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (c *Client) load(serviceType string) (*entry, bool) {
+	if c.CacheDir == "" {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.cachePath(serviceType))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Println("Failed to read discovery cache:", err)
+		}
+		return nil, false
+	}
+
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		log.Println("Failed to decode discovery cache:", err)
+		return nil, false
+	}
+	return &e, true
+}
@@ -0,0 +1,284 @@
+package discovery
+
+import (
+	"context"
+	"demo/registry"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// fakeRegistrar answers GET /services with the registrations it holds.
+type fakeRegistrar struct {
+	mu       sync.Mutex
+	services []registry.Registration
+	// gate, when set, holds every lookup until it receives or is closed.
+	gate  chan struct{}
+	calls atomic.Int32
+}
+
+func (f *fakeRegistrar) set(ports ...int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.services = nil
+	for _, port := range ports {
+		f.services = append(f.services, registry.Registration{
+			ID: fmt.Sprint("logging-", port), ServiceType: "Logging", IP: "127.0.0.1", Port: port,
+		})
+	}
+}
+
+func (f *fakeRegistrar) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.calls.Add(1)
+	f.mu.Lock()
+	gate := f.gate
+	f.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var matched []registry.Registration
+	for _, s := range f.services {
+		if s.ServiceType == r.URL.Query().Get("type") {
+			matched = append(matched, s)
+		}
+	}
+	json.NewEncoder(w).Encode(matched)
+}
+
+func newFakeRegistrar(t *testing.T, ports ...int) (*fakeRegistrar, *httptest.Server) {
+	t.Helper()
+	f := &fakeRegistrar{}
+	f.set(ports...)
+	ts := httptest.NewServer(f)
+	t.Cleanup(ts.Close)
+	return f, ts
+}
+
+func ports(instances []Instance) []int {
+	var ps []int
+	for _, i := range instances {
+		ps = append(ps, i.Port)
+	}
+	return ps
+}
+
+func samePorts(instances []Instance, want ...int) bool {
+	got := ports(instances)
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// eventually polls cond until it holds or a few seconds have passed.
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestResolveCachesForTTL(t *testing.T) {
+	f, ts := newFakeRegistrar(t, 8081)
+	c := &Client{RegistryAddr: ts.URL, TTL: 50 * time.Millisecond}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		instances, err := c.Resolve(ctx, "Logging")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !samePorts(instances, 8081) {
+			t.Fatalf("Resolve() = %v, want [8081]", ports(instances))
+		}
+	}
+	if n := f.calls.Load(); n != 1 {
+		t.Fatalf("registrar asked %d times within the TTL, want 1", n)
+	}
+
+	// Once expired, the next lookup triggers a refresh that picks up changes.
+	f.set(8083)
+	time.Sleep(60 * time.Millisecond)
+	c.Resolve(ctx, "Logging")
+	eventually(t, func() bool {
+		instances, _ := c.Resolve(ctx, "Logging")
+		return samePorts(instances, 8083)
+	})
+}
+
+func TestResolveServesStaleWhileRevalidating(t *testing.T) {
+	f, ts := newFakeRegistrar(t, 8081)
+	c := &Client{RegistryAddr: ts.URL, TTL: 10 * time.Millisecond}
+	ctx := context.Background()
+
+	if _, err := c.Resolve(ctx, "Logging"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold the refresh at the registrar.
+	gate := make(chan struct{})
+	f.mu.Lock()
+	f.gate = gate
+	f.mu.Unlock()
+	f.set(8083)
+	time.Sleep(20 * time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		instances, err := c.Resolve(ctx, "Logging")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !samePorts(instances, 8081) {
+			t.Fatalf("Resolve() while refreshing = %v, want the stale [8081]", ports(instances))
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("Resolve() waited for the refresh")
+		}
+	}
+	eventually(t, func() bool { return f.calls.Load() == 2 })
+
+	close(gate)
+	eventually(t, func() bool {
+		instances, _ := c.Resolve(ctx, "Logging")
+		return samePorts(instances, 8083)
+	})
+	if n := f.calls.Load(); n > 3 {
+		t.Errorf("registrar asked %d times, want one refresh at a time", n)
+	}
+}
+
+func TestResolveFallsBackToDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	_, ts := newFakeRegistrar(t, 8081, 8083)
+
+	first := &Client{RegistryAddr: ts.URL, CacheDir: dir}
+	if _, err := first.Resolve(context.Background(), "Logging"); err != nil {
+		t.Fatal(err)
+	}
+	ts.Close()
+
+	// A new process starts while the registrar is down.
+	restarted := &Client{RegistryAddr: ts.URL, CacheDir: dir}
+	instances, err := restarted.Resolve(context.Background(), "Logging")
+	if err != nil {
+		t.Fatalf("Resolve() with the registrar down = %v", err)
+	}
+	if !samePorts(instances, 8081, 8083) {
+		t.Errorf("Resolve() = %v, want the cached [8081 8083]", ports(instances))
+	}
+
+	// Without a cache the lookup fails.
+	if _, err := (&Client{RegistryAddr: ts.URL}).Resolve(context.Background(), "Logging"); err == nil {
+		t.Error("Resolve() without a cache succeeded with the registrar down")
+	}
+}
+
+func TestConcurrentCacheWrites(t *testing.T) {
+	dir := t.TempDir()
+	c := &Client{CacheDir: dir}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				instances := make([]Instance, g+1)
+				for j := range instances {
+					instances[j] = Instance{ID: fmt.Sprint(g, j), IP: "127.0.0.1", Port: 8081 + j}
+				}
+				c.store("Logging", &entry{Instances: instances, Fetched: time.Now()})
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if _, ok := c.load("Logging"); !ok {
+		t.Fatal("cache unreadable after concurrent writes")
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != "Logging.json" {
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name())
+		}
+		t.Errorf("cache directory holds %v, want only Logging.json", names)
+	}
+}
+
+func TestWatchDeliversChanges(t *testing.T) {
+	f, ts := newFakeRegistrar(t, 8081)
+	c := &Client{RegistryAddr: ts.URL, TTL: 10 * time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := c.Watch(ctx, "Logging")
+
+	next := func() []Instance {
+		t.Helper()
+		select {
+		case instances := <-updates:
+			return instances
+		case <-time.After(5 * time.Second):
+			t.Fatal("no update from Watch")
+			return nil
+		}
+	}
+
+	if got := next(); !samePorts(got, 8081) {
+		t.Fatalf("first update = %v, want [8081]", ports(got))
+	}
+	f.set(8081, 8083)
+	if got := next(); !samePorts(got, 8081, 8083) {
+		t.Fatalf("update = %v, want [8081 8083]", ports(got))
+	}
+	f.set()
+	if got := next(); len(got) != 0 {
+		t.Fatalf("update = %v, want none", ports(got))
+	}
+
+	// Polls that find nothing new send nothing.
+	select {
+	case got := <-updates:
+		t.Fatalf("unexpected update %v", ports(got))
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	eventually(t, func() bool {
+		select {
+		case _, ok := <-updates:
+			return !ok
+		default:
+			return false
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package logr
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// Entry is a log record received from another service.
+type Entry struct {
+	Time    time.Time
+	Level   slog.Level
+	Service string
+	Message string
+	Attrs   []slog.Attr
+}
+
+// ParseEntry decodes a record posted to the logging service. JSON objects
+// written by slog's JSON handler keep their time, level, message and
+// attributes; anything else is taken verbatim as an info message.
+func ParseEntry(data []byte) Entry {
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return Entry{Time: time.Now(), Level: slog.LevelInfo, Message: string(data)}
+	}
+
+	e := Entry{Time: time.Now(), Level: slog.LevelInfo}
+
+	if v, ok := fields[slog.TimeKey].(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			e.Time = t
+		}
+	}
+	if v, ok := fields[slog.LevelKey].(string); ok {
+		e.Level.UnmarshalText([]byte(v))
+	}
+	if v, ok := fields[slog.MessageKey].(string); ok {
+		e.Message = v
+	}
+	if v, ok := fields[ServiceKey].(string); ok {
+		e.Service = v
+	}
+	delete(fields, slog.TimeKey)
+	delete(fields, slog.LevelKey)
+	delete(fields, slog.MessageKey)
+	delete(fields, ServiceKey)
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		e.Attrs = append(e.Attrs, slog.Any(k, fields[k]))
+	}
+
+	return e
+}
+
+// Write logs e through the logger's sinks, keeping its original time.
+func (l *Logger) Write(ctx context.Context, e Entry) error {
+	handler := l.Handler()
+	if !handler.Enabled(ctx, e.Level) {
+		return nil
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	record := slog.NewRecord(e.Time, e.Level, e.Message, 0)
+	if e.Service != "" {
+		record.AddAttrs(slog.String(ServiceKey, e.Service))
+	}
+	record.AddAttrs(e.Attrs...)
+
+	return handler.Handle(ctx, record)
+}
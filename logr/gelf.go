@@ -0,0 +1,250 @@
+package logr
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gelfChunkMagic prefixes every chunk of a chunked GELF UDP message.
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+// MaxIngestMessage bounds the size of a single syslog or GELF message, both
+// as received and once decompressed.
+const MaxIngestMessage = 1 << 20
+
+// Defaults for the limits of a GELFAssembler.
+const (
+	DefaultGELFMaxPending  = 1024
+	DefaultGELFMaxBuffered = 32 << 20
+)
+
+// ParseGELF decodes a GELF message, optionally gzip or zlib compressed.
+// Additional fields lose their leading underscore and become attributes; the
+// _service field, if present, becomes the entry's service.
+func ParseGELF(data []byte) (Entry, error) {
+	// Trim the TCP delimiter only after decompressing: compressed trailers
+	// often end in null bytes.
+	data, err := gelfDecompress(data)
+	if err != nil {
+		return Entry{}, err
+	}
+	data = bytes.TrimRight(data, "\x00")
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return Entry{}, fmt.Errorf("gelf: %w", err)
+	}
+
+	message, ok := fields["short_message"].(string)
+	if !ok {
+		return Entry{}, errors.New("gelf: missing short_message")
+	}
+
+	// GELF levels are syslog severities and default to 1 (alert).
+	severity := 1
+	if v, ok := fields["level"].(float64); ok {
+		severity = int(v)
+	}
+
+	e := Entry{
+		Time:    time.Now(),
+		Level:   syslogLevel(severity),
+		Message: message,
+	}
+	if v, ok := fields["timestamp"].(float64); ok {
+		sec, frac := math.Modf(v)
+		e.Time = time.Unix(int64(sec), int64(frac*1e9))
+	}
+	if v, ok := fields["host"].(string); ok {
+		e.Attrs = append(e.Attrs, slog.String("host", v))
+	}
+	if v, ok := fields["full_message"].(string); ok {
+		e.Attrs = append(e.Attrs, slog.String("full_message", v))
+	}
+
+	var extra []string
+	for k := range fields {
+		if strings.HasPrefix(k, "_") && k != "_id" {
+			extra = append(extra, k)
+		}
+	}
+	sort.Strings(extra)
+	for _, k := range extra {
+		if k == "_"+ServiceKey {
+			if service, ok := fields[k].(string); ok {
+				e.Service = service
+				continue
+			}
+		}
+		e.Attrs = append(e.Attrs, slog.Any(k[1:], fields[k]))
+	}
+
+	return e, nil
+}
+
+func gelfDecompress(data []byte) ([]byte, error) {
+	var (
+		r   io.ReadCloser
+		err error
+	)
+	switch {
+	case len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b:
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	case len(data) > 2 && data[0] == 0x78:
+		r, err = zlib.NewReader(bytes.NewReader(data))
+	default:
+		return data, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gelf: %w", err)
+	}
+	defer r.Close()
+
+	// A small compressed message can inflate to gigabytes, so stop reading
+	// one byte past the limit.
+	out, err := io.ReadAll(io.LimitReader(r, MaxIngestMessage+1))
+	if err != nil {
+		return nil, fmt.Errorf("gelf: %w", err)
+	}
+	if len(out) > MaxIngestMessage {
+		return nil, fmt.Errorf("gelf: decompressed message exceeds %d bytes", MaxIngestMessage)
+	}
+	return out, nil
+}
+
+// GELFAssembler reassembles chunked GELF UDP messages. Incomplete messages
+// are dropped after five seconds, as the GELF specification requires, and
+// the oldest ones are dropped early to stay within its limits.
+type GELFAssembler struct {
+	// MaxPending is the number of incomplete messages kept at once, and
+	// MaxBuffered the bytes their chunks may hold together. Zero values use
+	// DefaultGELFMaxPending and DefaultGELFMaxBuffered.
+	MaxPending  int
+	MaxBuffered int
+
+	mu       sync.Mutex
+	pending  map[uint64]*gelfMessage
+	buffered int
+	next     uint64
+}
+
+type gelfMessage struct {
+	started  time.Time
+	order    uint64
+	chunks   [][]byte
+	received int
+	size     int
+}
+
+// Add consumes one UDP datagram. It returns the complete message and true
+// once all chunks of a message have arrived; unchunked datagrams are returned
+// immediately.
+func (a *GELFAssembler) Add(packet []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(packet, gelfChunkMagic) {
+		return packet, true
+	}
+	if len(packet) < 12 {
+		return nil, false
+	}
+
+	id := binary.BigEndian.Uint64(packet[2:10])
+	seq, count := int(packet[10]), int(packet[11])
+	if count == 0 || count > 128 || seq >= count {
+		return nil, false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.pending == nil {
+		a.pending = make(map[uint64]*gelfMessage)
+	}
+	now := time.Now()
+	for k, m := range a.pending {
+		if now.Sub(m.started) > 5*time.Second {
+			a.drop(k)
+		}
+	}
+
+	data := packet[12:]
+	m, ok := a.pending[id]
+	if ok && (len(m.chunks) != count || m.chunks[seq] != nil) {
+		return nil, false
+	}
+	if len(data) > a.maxBuffered() || (ok && m.size+len(data) > MaxIngestMessage) {
+		a.drop(id)
+		return nil, false
+	}
+	if !ok {
+		for len(a.pending) >= a.maxPending() {
+			a.drop(a.oldest())
+		}
+		m = &gelfMessage{started: now, order: a.next, chunks: make([][]byte, count)}
+		a.next++
+		a.pending[id] = m
+	}
+	for a.buffered+len(data) > a.maxBuffered() {
+		a.drop(a.oldest())
+	}
+	if _, ok := a.pending[id]; !ok {
+		// The message was the oldest one and had to make room itself.
+		return nil, false
+	}
+
+	m.chunks[seq] = append([]byte(nil), data...)
+	m.received++
+	m.size += len(data)
+	a.buffered += len(data)
+
+	if m.received < count {
+		return nil, false
+	}
+	a.drop(id)
+	return bytes.Join(m.chunks, nil), true
+}
+
+// drop forgets the pending message id and the bytes it buffered.
+func (a *GELFAssembler) drop(id uint64) {
+	if m, ok := a.pending[id]; ok {
+		a.buffered -= m.size
+		delete(a.pending, id)
+	}
+}
+
+// oldest returns the ID of the pending message started first.
+func (a *GELFAssembler) oldest() uint64 {
+	var oldest *gelfMessage
+	var oldestID uint64
+	for id, m := range a.pending {
+		if oldest == nil || m.order < oldest.order {
+			oldest, oldestID = m, id
+		}
+	}
+	return oldestID
+}
+
+func (a *GELFAssembler) maxPending() int {
+	if a.MaxPending <= 0 {
+		return DefaultGELFMaxPending
+	}
+	return a.MaxPending
+}
+
+func (a *GELFAssembler) maxBuffered() int {
+	if a.MaxBuffered <= 0 {
+		return DefaultGELFMaxBuffered
+	}
+	return a.MaxBuffered
+}
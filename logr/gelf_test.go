@@ -0,0 +1,205 @@
+package logr
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseGELF(t *testing.T) {
+	const message = `{"version":"1.1","host":"web1","short_message":"login failed","timestamp":1792404000.5,"level":4,"_service":"Business","_user":"ann","_id":"dropped"}`
+	want := Entry{
+		Time:    time.Unix(1792404000, 5e8),
+		Level:   slog.LevelWarn,
+		Service: "Business",
+		Message: "login failed",
+		Attrs:   []slog.Attr{slog.String("host", "web1"), slog.String("user", "ann")},
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    Entry
+		wantErr bool
+	}{
+		{name: "plain", data: []byte(message), want: want},
+		{name: "null terminated", data: []byte(message + "\x00"), want: want},
+		{name: "gzip", data: compress(t, "gzip", message), want: want},
+		{name: "zlib", data: compress(t, "zlib", message), want: want},
+		{
+			name: "defaults to alert level",
+			data: []byte(`{"short_message":"m","timestamp":1792404000,"full_message":"details","_count":3}`),
+			want: Entry{
+				Time:    time.Unix(1792404000, 0),
+				Level:   slog.LevelError,
+				Message: "m",
+				Attrs:   []slog.Attr{slog.String("full_message", "details"), slog.Any("count", float64(3))},
+			},
+		},
+		{name: "missing short_message", data: []byte(`{"host":"web1"}`), wantErr: true},
+		{name: "not JSON", data: []byte("login failed"), wantErr: true},
+		{name: "corrupt gzip", data: []byte{0x1f, 0x8b, 0x00, 0x01}, wantErr: true},
+		{
+			name: "gzip inflating to the limit",
+			data: compress(t, "gzip", padded(`{"short_message":"m","timestamp":1792404000}`, MaxIngestMessage)),
+			want: Entry{Time: time.Unix(1792404000, 0), Level: slog.LevelError, Message: "m"},
+		},
+		{
+			name:    "gzip inflating past the limit",
+			data:    compress(t, "gzip", padded(`{"short_message":"m"}`, MaxIngestMessage+1)),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseGELF(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseGELF() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				assertEntry(t, got, tt.want)
+			}
+		})
+	}
+}
+
+// padded returns s followed by spaces up to n bytes.
+func padded(s string, n int) string {
+	return s + strings.Repeat(" ", n-len(s))
+}
+
+func chunk(id uint64, seq, count byte, data string) []byte {
+	packet := append([]byte(nil), gelfChunkMagic...)
+	packet = binary.BigEndian.AppendUint64(packet, id)
+	return append(append(packet, seq, count), data...)
+}
+
+func TestGELFAssembler(t *testing.T) {
+	tests := []struct {
+		name    string
+		packets [][]byte
+		want    string // empty when no message completes
+	}{
+		{"unchunked", [][]byte{[]byte(`{"a":1}`)}, `{"a":1}`},
+		{"in order", [][]byte{chunk(1, 0, 2, `{"a":`), chunk(1, 1, 2, `1}`)}, `{"a":1}`},
+		{"out of order", [][]byte{chunk(2, 1, 2, `1}`), chunk(2, 0, 2, `{"a":`)}, `{"a":1}`},
+		{"missing chunk", [][]byte{chunk(3, 0, 3, `{"a":`), chunk(3, 2, 3, `1}`)}, ""},
+		{"duplicate chunk", [][]byte{chunk(4, 0, 2, `{"a":`), chunk(4, 0, 2, `{"a":`)}, ""},
+		{"sequence out of range", [][]byte{chunk(5, 2, 2, `x`)}, ""},
+		{"too short", [][]byte{gelfChunkMagic}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a GELFAssembler
+			var got string
+			for _, p := range tt.packets {
+				if msg, ok := a.Add(p); ok {
+					got = string(msg)
+				}
+			}
+			if got != tt.want {
+				t.Errorf("assembled %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGELFAssemblerLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxPending  int
+		maxBuffered int
+		fill        [][]byte
+		later       []byte // completes message 1 if it is still pending
+		want        string
+	}{
+		{
+			"within the limits",
+			2, 100,
+			[][]byte{chunk(1, 0, 2, `{"a":`), chunk(2, 0, 2, `{"b":`)},
+			chunk(1, 1, 2, `1}`),
+			`{"a":1}`,
+		},
+		{
+			"oldest dropped for a new message",
+			2, 100,
+			[][]byte{chunk(1, 0, 2, `{"a":`), chunk(2, 0, 2, `{"b":`), chunk(3, 0, 2, `{"c":`)},
+			chunk(1, 1, 2, `1}`),
+			"",
+		},
+		{
+			"oldest dropped to stay within the buffered bytes",
+			10, 12,
+			[][]byte{chunk(1, 0, 2, `{"a":`), chunk(2, 0, 2, `{"b":`), chunk(3, 0, 2, `{"c":`)},
+			chunk(1, 1, 2, `1}`),
+			"",
+		},
+		{
+			"chunk larger than the buffer dropped",
+			10, 12,
+			[][]byte{chunk(1, 0, 2, `{"a":`), chunk(2, 0, 2, strings.Repeat("x", 13))},
+			chunk(1, 1, 2, `1}`),
+			`{"a":1}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &GELFAssembler{MaxPending: tt.maxPending, MaxBuffered: tt.maxBuffered}
+			for _, p := range tt.fill {
+				if _, ok := a.Add(p); ok {
+					t.Fatal("message completed while filling")
+				}
+			}
+			if len(a.pending) > a.maxPending() || a.buffered > a.maxBuffered() {
+				t.Errorf("%d messages and %d bytes pending, over the limits", len(a.pending), a.buffered)
+			}
+
+			var got string
+			if msg, ok := a.Add(tt.later); ok {
+				got = string(msg)
+			}
+			if got != tt.want {
+				t.Errorf("assembled %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGELFAssemblerDefaultCap(t *testing.T) {
+	var a GELFAssembler
+	for id := uint64(0); id < 3*DefaultGELFMaxPending; id++ {
+		a.Add(chunk(id, 0, 2, "x"))
+	}
+	if n := len(a.pending); n != DefaultGELFMaxPending {
+		t.Errorf("%d messages pending, want %d", n, DefaultGELFMaxPending)
+	}
+	if a.buffered != DefaultGELFMaxPending {
+		t.Errorf("%d bytes buffered, want %d", a.buffered, DefaultGELFMaxPending)
+	}
+}
+
+func compress(t *testing.T, format, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w interface {
+		Write([]byte) (int, error)
+		Close() error
+	}
+	if format == "gzip" {
+		w = gzip.NewWriter(&buf)
+	} else {
+		w = zlib.NewWriter(&buf)
+	}
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,158 @@
+package logr
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// AllLevels is below every slog level. Sinks accept all records and leave
+// the threshold to the logger's level; as Match.MinLevel it routes records
+// of any level.
+const AllLevels = slog.Level(math.MinInt)
+
+// sinkOptions configures the slog handlers backing sinks.
+var sinkOptions = &slog.HandlerOptions{Level: AllLevels}
+
+// WithLevel drops records below level before they reach any sink. Pass a
+// *slog.LevelVar to change the threshold at runtime. The default is info.
+func WithLevel(level slog.Leveler) Option {
+	return func(lw *Logger) error {
+		lw.level = level
+		return nil
+	}
+}
+
+// Sampling limits how many records with the same key are logged per Tick.
+// The key is the record's service and message.
+type Sampling struct {
+	// First is the number of records logged per key each Tick before sampling starts.
+	First int
+
+	// Thereafter logs every Thereafter-th record once First is exceeded. Zero drops them all.
+	Thereafter int
+
+	// Tick is the interval after which the per-key counters reset.
+	Tick time.Duration
+}
+
+// WithSampling applies s to records before they reach any sink.
+func WithSampling(s Sampling) Option {
+	return func(lw *Logger) error {
+		lw.sampling = &s
+		return nil
+	}
+}
+
+// levelHandler drops records below a runtime-adjustable level.
+type levelHandler struct {
+	level slog.Leveler
+	next  slog.Handler
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level() && h.next.Enabled(ctx, level)
+}
+
+func (h *levelHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.next.Handle(ctx, record)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{level: h.level, next: h.next.WithAttrs(attrs)}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{level: h.level, next: h.next.WithGroup(name)}
+}
+
+// NewSamplingHandler wraps next so that records are sampled per service and
+// message according to s.
+func NewSamplingHandler(next slog.Handler, s Sampling) slog.Handler {
+	return &samplingHandler{
+		next:     next,
+		sampling: s,
+		counters: &sampleCounters{counts: make(map[string]*sampleCount)},
+	}
+}
+
+type samplingHandler struct {
+	next     slog.Handler
+	sampling Sampling
+	counters *sampleCounters
+	service  string
+}
+
+// maxSampleKeys bounds the number of keys tracked. Expired keys are purged
+// when it is reached; records with new keys are logged unsampled while none
+// have expired.
+const maxSampleKeys = 10000
+
+type sampleCounters struct {
+	mu     sync.Mutex
+	counts map[string]*sampleCount
+}
+
+type sampleCount struct {
+	resetAt time.Time
+	n       int
+}
+
+// allow counts a record for key and reports whether it should be logged.
+func (c *sampleCounters) allow(key string, s Sampling, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	count, ok := c.counts[key]
+	if !ok || now.After(count.resetAt) {
+		if !ok && len(c.counts) >= maxSampleKeys {
+			for k, v := range c.counts {
+				if now.After(v.resetAt) {
+					delete(c.counts, k)
+				}
+			}
+			if len(c.counts) >= maxSampleKeys {
+				return true
+			}
+		}
+		count = &sampleCount{resetAt: now.Add(s.Tick)}
+		c.counts[key] = count
+	}
+	count.n++
+
+	if count.n <= s.First {
+		return true
+	}
+	return s.Thereafter > 0 && (count.n-s.First)%s.Thereafter == 0
+}
+
+func (h *samplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, record slog.Record) error {
+	key := recordService(record, h.service) + "\x00" + record.Message
+	if !h.counters.allow(key, h.sampling, time.Now()) {
+		return nil
+	}
+	return h.next.Handle(ctx, record)
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	next.next = h.next.WithAttrs(attrs)
+	for _, a := range attrs {
+		if a.Key == ServiceKey {
+			next.service = a.Value.String()
+		}
+	}
+	return &next
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	next := *h
+	next.next = h.next.WithGroup(name)
+	return &next
+}
@@ -0,0 +1,130 @@
+package logr
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSampleCountersAllow(t *testing.T) {
+	tests := []struct {
+		name     string
+		sampling Sampling
+		want     []bool
+	}{
+		{"first only", Sampling{First: 2, Tick: time.Second}, []bool{true, true, false, false, false}},
+		{"every second thereafter", Sampling{First: 1, Thereafter: 2, Tick: time.Second}, []bool{true, false, true, false, true}},
+		{"every one thereafter", Sampling{First: 0, Thereafter: 1, Tick: time.Second}, []bool{true, true, true, true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &sampleCounters{counts: make(map[string]*sampleCount)}
+			now := time.Now()
+
+			var got []bool
+			for range tt.want {
+				got = append(got, c.allow("key", tt.sampling, now))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("allow() = %v, want %v", got, tt.want)
+			}
+
+			// The counter starts over once the tick has passed.
+			var again []bool
+			for range tt.want {
+				again = append(again, c.allow("key", tt.sampling, now.Add(2*tt.sampling.Tick)))
+			}
+			if !reflect.DeepEqual(again, tt.want) {
+				t.Errorf("allow() after Tick = %v, want %v", again, tt.want)
+			}
+		})
+	}
+}
+
+func TestSampleCountersCap(t *testing.T) {
+	c := &sampleCounters{counts: make(map[string]*sampleCount)}
+	s := Sampling{First: 1, Tick: time.Second}
+	now := time.Now()
+
+	for i := 0; i < maxSampleKeys; i++ {
+		c.allow(fmt.Sprint(i), s, now)
+	}
+
+	// No key has expired, so new keys pass unsampled and are not tracked.
+	for i := 0; i < 3; i++ {
+		if !c.allow("new", s, now) {
+			t.Fatalf("record %d with a new key dropped at the cap", i+1)
+		}
+	}
+	if n := len(c.counts); n != maxSampleKeys {
+		t.Fatalf("tracking %d keys, want %d", n, maxSampleKeys)
+	}
+
+	// Once the tracked keys expire they are purged and sampling resumes.
+	later := now.Add(2 * s.Tick)
+	if !c.allow("new", s, later) || c.allow("new", s, later) {
+		t.Error("new key not sampled after the expired keys were purged")
+	}
+	if n := len(c.counts); n != 1 {
+		t.Errorf("tracking %d keys after the purge, want 1", n)
+	}
+}
+
+func TestWithLevelLevelVar(t *testing.T) {
+	var level slog.LevelVar
+	rb := NewRingBuffer(10)
+	logger, err := NewLogWriter(WithLevel(&level), WithRingBuffer(rb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	logger.Debug("dropped at info")
+	level.Set(slog.LevelDebug)
+	logger.Debug("kept at debug")
+	level.Set(slog.LevelWarn)
+	logger.Info("dropped at warn")
+	logger.Warn("kept at warn")
+
+	if got := messages(t, rb); !reflect.DeepEqual(got, []string{"kept at debug", "kept at warn"}) {
+		t.Errorf("logged %q", got)
+	}
+}
+
+func TestSamplingPerKey(t *testing.T) {
+	rb := NewRingBuffer(10)
+	logger, err := NewLogWriter(WithSampling(Sampling{First: 1, Tick: time.Hour}), WithRingBuffer(rb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	business := logger.With(ServiceKey, "Business")
+	for i := 0; i < 3; i++ {
+		logger.Info("a")
+		logger.Info("b")
+		business.Info("a")
+		logger.Info("a", ServiceKey, "Logging")
+	}
+
+	if got := messages(t, rb); len(got) != 4 {
+		t.Errorf("logged %q, want one record per service and message", got)
+	}
+}
+
+// messages returns the messages of the records in rb, oldest first.
+func messages(t *testing.T, rb *RingBuffer) []string {
+	t.Helper()
+	var out []string
+	for _, entry := range rb.Entries() {
+		var record struct{ Msg string }
+		if err := json.Unmarshal(entry, &record); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, record.Msg)
+	}
+	return out
+}
@@ -1,43 +1,98 @@
 package logr
 
 import (
+	"errors"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 )
 
 type Logger struct {
 	*slog.Logger
+
+	routes   []route
+	closers  []io.Closer
+	level    slog.Leveler
+	sampling *Sampling
+
+	rotateBytes int64
+	written     *atomic.Int64
+
+	// patterns are globs matching the files of the file sinks.
+	patterns []string
 }
 
-type option func(*Logger) error
+// Option configures the sinks and routing rules of a Logger.
+type Option func(*Logger) error
 
-func NewLogWriter(options ...option) (*Logger, error) {
-	logWriter := &Logger{
-		Logger: slog.New(slog.NewJSONHandler(os.Stdout, nil)),
-	}
+// NewLogWriter builds a Logger from options. Without any sink options records
+// are written as JSON to stdout.
+func NewLogWriter(options ...Option) (*Logger, error) {
+	logWriter := &Logger{written: new(atomic.Int64)}
 
 	for _, opt := range options {
 		err := opt(logWriter)
 		if err != nil {
+			logWriter.Close()
 			return nil, err
 		}
 	}
 
+	if len(logWriter.routes) == 0 {
+		logWriter.addSink(slog.NewJSONHandler(os.Stdout, sinkOptions))
+	}
+
+	var handler slog.Handler = &routingHandler{routes: logWriter.routes}
+	if logWriter.sampling != nil {
+		handler = NewSamplingHandler(handler, *logWriter.sampling)
+	}
+	if logWriter.level == nil {
+		logWriter.level = slog.LevelInfo
+	}
+	logWriter.Logger = slog.New(&levelHandler{level: logWriter.level, next: handler})
+
 	return logWriter, nil
 }
 
-func DefaultFileLogger(path string) (*Logger, error) {
-	w, err := NewLogWriter(WithFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600))
+// Close releases the files and connections held by the logger's sinks.
+func (l *Logger) Close() error {
+	var errs []error
+	for _, c := range l.closers {
+		errs = append(errs, c.Close())
+	}
+	l.closers = nil
+	return errors.Join(errs...)
+}
+
+// BytesWritten returns the number of bytes written to file sinks.
+func (l *Logger) BytesWritten() int64 {
+	return l.written.Load()
+}
 
-	if err != nil {
-		return nil, err
+// FilePatterns returns globs matching the files written by every file sink,
+// including those behind routes, and their rotated segments, for use as
+// Janitor.Patterns.
+func (l *Logger) FilePatterns() []string {
+	var patterns []string
+	seen := make(map[string]bool)
+	for _, p := range l.patterns {
+		if !seen[p] {
+			seen[p] = true
+			patterns = append(patterns, p)
+		}
 	}
-	return w, nil
+	return patterns
+}
+
+// addSink routes every record to h.
+func (l *Logger) addSink(h slog.Handler) {
+	l.routes = append(l.routes, route{match: Match{MinLevel: AllLevels}, handler: h})
 }
 
-// WithFile sets the log writer to a file.
-func WithFile(path string, flag int, perm os.FileMode) option {
+// WithFile adds a sink writing JSON records to a file.
+func WithFile(path string, flag int, perm os.FileMode) Option {
 	return func(lw *Logger) error {
 		// Ensure the directory exists before attempting to open the file
 		dir := filepath.Dir(path)
@@ -45,12 +100,14 @@ func WithFile(path string, flag int, perm os.FileMode) option {
 			return err
 		}
 
-		f, err := os.OpenFile(path, flag, perm)
+		f, err := lw.openFile(path, flag, perm)
 		if err != nil {
 			return err
 		}
 
-		lw.Logger = slog.New(slog.NewJSONHandler(f, nil))
+		lw.closers = append(lw.closers, f)
+		lw.patterns = append(lw.patterns, path, path+".*")
+		lw.addSink(slog.NewJSONHandler(f, sinkOptions))
 		return nil
 	}
 }
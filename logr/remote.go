@@ -0,0 +1,143 @@
+package logr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// RemoteQueueSize is the number of records waiting to be shipped before
+// further records fall back to stdout.
+const RemoteQueueSize = 1024
+
+// EndpointResolver returns the URL of the logging service's /log endpoint,
+// or false when no logging instance is currently connected.
+type EndpointResolver func() (string, bool)
+
+// NewRemoteHandler returns a slog.Handler that encodes records as JSON and
+// ships them to the endpoint returned by resolve from a background goroutine,
+// so logging never waits on the network. Records fall back to stdout when no
+// logging instance is connected, the request fails or RemoteQueueSize records
+// are already waiting. Records at ERROR and above are also written to stdout
+// right away, so they are not lost if the process exits before they ship. A
+// nil client uses a plain HTTP client with a short timeout.
+func NewRemoteHandler(resolve EndpointResolver, client *http.Client, opts *slog.HandlerOptions) slog.Handler {
+	if client == nil {
+		client = &http.Client{Timeout: 2 * time.Second}
+	}
+	w := newRemoteWriter(resolve, client, os.Stdout)
+	go w.ship()
+	return newRemoteHandler(w, opts)
+}
+
+func newRemoteHandler(w *remoteWriter, opts *slog.HandlerOptions) slog.Handler {
+	return &remoteHandler{
+		remote: slog.NewJSONHandler(w, opts),
+		local:  slog.NewJSONHandler(fallbackWriter{w}, opts),
+	}
+}
+
+// remoteHandler queues every record through remote and writes records at
+// ERROR and above through local as well.
+type remoteHandler struct {
+	remote slog.Handler
+	local  slog.Handler
+}
+
+func (h *remoteHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.remote.Enabled(ctx, level)
+}
+
+func (h *remoteHandler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level >= slog.LevelError {
+		if err := h.local.Handle(ctx, record.Clone()); err != nil {
+			return err
+		}
+	}
+	return h.remote.Handle(ctx, record)
+}
+
+func (h *remoteHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &remoteHandler{remote: h.remote.WithAttrs(attrs), local: h.local.WithAttrs(attrs)}
+}
+
+func (h *remoteHandler) WithGroup(name string) slog.Handler {
+	return &remoteHandler{remote: h.remote.WithGroup(name), local: h.local.WithGroup(name)}
+}
+
+// remoteWriter receives one encoded record per Write call from the JSON
+// handler and queues it for ship to forward to the logging service.
+type remoteWriter struct {
+	resolve  EndpointResolver
+	client   *http.Client
+	queue    chan []byte
+	mu       sync.Mutex
+	fallback io.Writer
+}
+
+func newRemoteWriter(resolve EndpointResolver, client *http.Client, fallback io.Writer) *remoteWriter {
+	return &remoteWriter{
+		resolve:  resolve,
+		client:   client,
+		queue:    make(chan []byte, RemoteQueueSize),
+		fallback: fallback,
+	}
+}
+
+func (w *remoteWriter) Write(p []byte) (int, error) {
+	// The handler reuses p once Write returns.
+	record := append([]byte(nil), p...)
+	select {
+	case w.queue <- record:
+		return len(p), nil
+	default:
+		return w.writeFallback(p)
+	}
+}
+
+// ship posts queued records one at a time, forever.
+func (w *remoteWriter) ship() {
+	for record := range w.queue {
+		if endpoint, ok := w.resolve(); ok {
+			if err := w.post(endpoint, record); err == nil {
+				continue
+			}
+		}
+		w.writeFallback(record)
+	}
+}
+
+// writeFallback keeps records written from Write and ship from interleaving.
+func (w *remoteWriter) writeFallback(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.fallback.Write(p)
+}
+
+// fallbackWriter writes straight to the fallback of a remoteWriter.
+type fallbackWriter struct {
+	w *remoteWriter
+}
+
+func (f fallbackWriter) Write(p []byte) (int, error) {
+	return f.w.writeFallback(p)
+}
+
+func (w *remoteWriter) post(endpoint string, p []byte) error {
+	resp, err := w.client.Post(endpoint, "application/json", bytes.NewReader(p))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
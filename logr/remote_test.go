@@ -0,0 +1,122 @@
+package logr
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for the shipping goroutine and the test.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRemoteWriterDoesNotWaitForTheNetwork(t *testing.T) {
+	release := make(chan struct{})
+	received := make(chan string, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	var fallback syncBuffer
+	w := newRemoteWriter(func() (string, bool) { return ts.URL, true }, ts.Client(), &fallback)
+	go w.ship()
+
+	start := time.Now()
+	record := []byte(`{"msg":"hello"}` + "\n")
+	if _, err := w.Write(record); err != nil {
+		t.Fatal(err)
+	}
+	// The caller may reuse its buffer once Write returns.
+	copy(record, "XXXXXXXXXXXXXXX")
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("Write took %s while the logging service was stalled", elapsed)
+	}
+
+	release <- struct{}{}
+	select {
+	case body := <-received:
+		if body != `{"msg":"hello"}`+"\n" {
+			t.Errorf("shipped %q", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("record was not shipped")
+	}
+	if fallback.String() != "" {
+		t.Errorf("fallback got %q", fallback.String())
+	}
+}
+
+func TestRemoteWriterFallsBackWhenQueueIsFull(t *testing.T) {
+	var fallback syncBuffer
+	// Without ship running, nothing drains the queue.
+	w := newRemoteWriter(func() (string, bool) { return "", false }, http.DefaultClient, &fallback)
+	for i := 0; i < RemoteQueueSize; i++ {
+		w.Write([]byte("queued\n"))
+	}
+	w.Write([]byte("overflow\n"))
+
+	if got := fallback.String(); got != "overflow\n" {
+		t.Errorf("fallback = %q, want the overflowing record", got)
+	}
+}
+
+func TestRemoteWriterFallsBackWithoutEndpoint(t *testing.T) {
+	var fallback syncBuffer
+	w := newRemoteWriter(func() (string, bool) { return "", false }, http.DefaultClient, &fallback)
+	go w.ship()
+
+	w.Write([]byte("record\n"))
+	deadline := time.Now().Add(5 * time.Second)
+	for fallback.String() != "record\n" {
+		if time.Now().After(deadline) {
+			t.Fatalf("fallback = %q, want the record", fallback.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRemoteHandlerWritesErrorsRightAway(t *testing.T) {
+	var fallback syncBuffer
+	// Without ship running, queued records are never written.
+	w := newRemoteWriter(func() (string, bool) { return "", false }, http.DefaultClient, &fallback)
+	logger := slog.New(newRemoteHandler(w, nil)).With("service", "Business")
+
+	logger.Info("starting")
+	logger.Error("failed to bind", "port", 8082)
+
+	got := fallback.String()
+	if strings.Contains(got, "starting") {
+		t.Errorf("fallback = %q, want only the error before the queue drains", got)
+	}
+	if !strings.Contains(got, `"msg":"failed to bind"`) || !strings.Contains(got, `"service":"Business"`) {
+		t.Errorf("fallback = %q, want the error record with its attributes", got)
+	}
+	// The error is still shipped like any other record.
+	if n := len(w.queue); n != 2 {
+		t.Errorf("%d records queued, want 2", n)
+	}
+}
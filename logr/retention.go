@@ -0,0 +1,166 @@
+package logr
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Janitor enforces retention over the files written by file sinks. Rotated
+// segments older than MaxAge are deleted, then the oldest segments are deleted
+// until all files together fit in MaxBytes. Live files are never deleted but
+// count towards the quota.
+type Janitor struct {
+	// Patterns are globs matching the live files and their rotated segments.
+	Patterns []string
+
+	// MaxAge is the age after which segments are deleted. Zero keeps them forever.
+	MaxAge time.Duration
+
+	// MaxBytes is the hard limit on the total size of all files. Zero disables the quota.
+	MaxBytes int64
+
+	// WarnRatio is the fraction of MaxBytes at which the quota is considered near.
+	WarnRatio float64
+
+	// Written, when set, returns the bytes written to the files so far, such
+	// as Logger.BytesWritten, so usage keeps growing between sweeps.
+	Written func() int64
+
+	usage atomic.Int64
+	swept atomic.Int64
+}
+
+type logFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+	segment bool
+}
+
+// Run sweeps once immediately and then every interval until ctx is done.
+func (j *Janitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := j.Sweep(); err != nil {
+			log.Println("Log retention sweep failed:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep applies the retention policy once and refreshes the recorded usage.
+func (j *Janitor) Sweep() error {
+	// Read before measuring, so bytes written meanwhile are counted twice
+	// rather than not at all until the next sweep.
+	written := j.written()
+
+	files, err := j.files()
+	if err != nil {
+		return err
+	}
+
+	// Oldest first, so both passes delete the oldest segments first.
+	sort.Slice(files, func(a, b int) bool { return files[a].modTime.Before(files[b].modTime) })
+
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+
+	kept := files[:0]
+	for _, f := range files {
+		if f.segment && j.MaxAge > 0 && time.Since(f.modTime) > j.MaxAge {
+			if err := os.Remove(f.path); err != nil {
+				return err
+			}
+			total -= f.size
+			continue
+		}
+		kept = append(kept, f)
+	}
+
+	for _, f := range kept {
+		if j.MaxBytes <= 0 || total <= j.MaxBytes {
+			break
+		}
+		if !f.segment {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			return err
+		}
+		total -= f.size
+	}
+
+	j.usage.Store(total)
+	j.swept.Store(written)
+	return nil
+}
+
+func (j *Janitor) written() int64 {
+	if j.Written == nil {
+		return 0
+	}
+	return j.Written()
+}
+
+func (j *Janitor) files() ([]logFile, error) {
+	seen := make(map[string]bool)
+	var files []logFile
+
+	for _, pattern := range j.Patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, path := range matches {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			files = append(files, logFile{
+				path:    path,
+				size:    info.Size(),
+				modTime: info.ModTime(),
+				segment: isSegment(filepath.Base(path)),
+			})
+		}
+	}
+
+	return files, nil
+}
+
+// Usage returns the total size of all files as of the last sweep plus the
+// bytes written since.
+func (j *Janitor) Usage() int64 {
+	return j.usage.Load() + j.written() - j.swept.Load()
+}
+
+// NearQuota reports whether usage has reached WarnRatio of MaxBytes.
+func (j *Janitor) NearQuota() bool {
+	return j.MaxBytes > 0 && float64(j.Usage()) >= j.WarnRatio*float64(j.MaxBytes)
+}
+
+// OverQuota reports whether usage has reached MaxBytes, in which case new
+// records should be rejected until a sweep frees space.
+func (j *Janitor) OverQuota() bool {
+	return j.MaxBytes > 0 && j.Usage() >= j.MaxBytes
+}
@@ -0,0 +1,126 @@
+package logr
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestJanitorCountsWritesBetweenSweeps(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, make([]byte, 40), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var written atomic.Int64
+	j := &Janitor{Patterns: []string{path}, MaxBytes: 100, Written: written.Load}
+	if err := j.Sweep(); err != nil {
+		t.Fatal(err)
+	}
+	if j.OverQuota() {
+		t.Fatalf("OverQuota() = true at %d of %d bytes", j.Usage(), j.MaxBytes)
+	}
+
+	written.Add(60)
+	if got := j.Usage(); got != 100 {
+		t.Errorf("Usage() = %d, want 100", got)
+	}
+	if !j.OverQuota() {
+		t.Error("OverQuota() = false after writing up to MaxBytes")
+	}
+
+	// The next sweep measures the files again instead of adding the writes twice.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(make([]byte, 20))
+	f.Close()
+	if err := j.Sweep(); err != nil {
+		t.Fatal(err)
+	}
+	if got := j.Usage(); got != 60 {
+		t.Errorf("Usage() after sweep = %d, want 60", got)
+	}
+}
+
+func TestJanitorRecoversFromQuota(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	logger, err := NewLogWriter(WithRotation(200), WithFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	j := &Janitor{Patterns: []string{path, path + ".*"}, MaxBytes: 1000, Written: logger.BytesWritten}
+	if err := j.Sweep(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Write like the service does: only while under quota.
+	for i := 0; i < 1000 && !j.OverQuota(); i++ {
+		logger.Info("filling the quota", "i", i)
+	}
+	if !j.OverQuota() {
+		t.Fatal("quota was never reached")
+	}
+
+	if err := j.Sweep(); err != nil {
+		t.Fatal(err)
+	}
+	if j.OverQuota() {
+		t.Fatalf("still over quota after a sweep: %d of %d bytes", j.Usage(), j.MaxBytes)
+	}
+	logger.Info("accepted again")
+}
+
+func TestFilePatternsIncludeRoutedSinks(t *testing.T) {
+	dir := t.TempDir()
+	appLog := filepath.Join(dir, "app.log")
+	errorsLog := filepath.Join(dir, "routed", "errors.log")
+	services := filepath.Join(dir, "services")
+
+	logger, err := NewLogWriter(
+		WithRotation(10),
+		WithFile(appLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600),
+		WithRoute(Match{MinLevel: slog.LevelError}, WithFile(errorsLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)),
+		WithRoute(Match{Service: "Business"}, WithServiceFiles(services), WithStdout()),
+		WithFile(appLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	want := []string{
+		appLog, appLog + ".*",
+		errorsLog, errorsLog + ".*",
+		filepath.Join(services, "*.log"), filepath.Join(services, "*.log.*"),
+	}
+	if got := logger.FilePatterns(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("FilePatterns() = %v, want %v", got, want)
+	}
+
+	// Segments rotated out of a routed file are pruned like the others.
+	for i := 0; i < 3; i++ {
+		logger.Error("disk failing, rotating the routed file")
+	}
+	if segments, _ := filepath.Glob(errorsLog + ".*"); len(segments) == 0 {
+		t.Fatal("routed file was not rotated")
+	}
+	j := &Janitor{Patterns: logger.FilePatterns(), MaxBytes: 1}
+	if err := j.Sweep(); err != nil {
+		t.Fatal(err)
+	}
+	segments, err := filepath.Glob(errorsLog + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 0 {
+		t.Errorf("rotated segments of the routed file kept: %v", segments)
+	}
+}
@@ -0,0 +1,120 @@
+package logr
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// segmentLayout is the timestamp suffix appended to rotated segments.
+const segmentLayout = "20060102T150405,000000000"
+
+// WithRotation makes file sinks added after it rotate once they grow past
+// maxBytes. The full file is renamed to <path>.<timestamp> and a new one is
+// started.
+func WithRotation(maxBytes int64) Option {
+	return func(lw *Logger) error {
+		lw.rotateBytes = maxBytes
+		return nil
+	}
+}
+
+// openFile opens path for a file sink, rotating it if WithRotation was applied.
+func (l *Logger) openFile(path string, flag int, perm os.FileMode) (io.WriteCloser, error) {
+	f, err := os.OpenFile(path, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if l.rotateBytes <= 0 {
+		return &countingWriter{WriteCloser: f, written: l.written}, nil
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	rf := &rotatingFile{
+		path:     path,
+		flag:     flag,
+		perm:     perm,
+		maxBytes: l.rotateBytes,
+		f:        f,
+		size:     info.Size(),
+	}
+	return &countingWriter{WriteCloser: rf, written: l.written}, nil
+}
+
+// countingWriter adds the bytes written through it to a shared counter.
+type countingWriter struct {
+	io.WriteCloser
+	written *atomic.Int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.WriteCloser.Write(p)
+	cw.written.Add(int64(n))
+	return n, err
+}
+
+type rotatingFile struct {
+	path     string
+	flag     int
+	perm     os.FileMode
+	maxBytes int64
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.size > 0 && rf.size+int64(len(p)) > rf.maxBytes {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *rotatingFile) rotate() error {
+	if err := rf.f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(rf.path, rf.path+"."+time.Now().UTC().Format(segmentLayout)); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(rf.path, rf.flag|os.O_CREATE|os.O_TRUNC, rf.perm)
+	if err != nil {
+		return err
+	}
+	rf.f = f
+	rf.size = 0
+	return nil
+}
+
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.f.Close()
+}
+
+// isSegment reports whether name is a rotated segment rather than a live file.
+func isSegment(name string) bool {
+	i := strings.LastIndexByte(name, '.')
+	if i < 0 {
+		return false
+	}
+	_, err := time.Parse(segmentLayout, name[i+1:])
+	return err == nil
+}
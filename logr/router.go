@@ -0,0 +1,126 @@
+package logr
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// ServiceKey is the record attribute naming the service a record came from.
+const ServiceKey = "service"
+
+// Match selects the records a route applies to.
+type Match struct {
+	// Service restricts the route to records from one service. Empty matches any service.
+	Service string
+
+	// MinLevel is the lowest level the route accepts. The zero value is
+	// info; use AllLevels to accept every level.
+	MinLevel slog.Level
+}
+
+func (m Match) matches(service string, level slog.Level) bool {
+	if m.Service != "" && m.Service != service {
+		return false
+	}
+	return level >= m.MinLevel
+}
+
+type route struct {
+	match   Match
+	handler slog.Handler
+}
+
+// WithRoute restricts the sinks added by options to records matching m.
+//
+//	logr.WithRoute(logr.Match{Service: "Business", MinLevel: slog.LevelWarn}, logr.WithStdout())
+func WithRoute(m Match, options ...Option) Option {
+	return func(lw *Logger) error {
+		inner := &Logger{rotateBytes: lw.rotateBytes, written: lw.written}
+		for _, opt := range options {
+			if err := opt(inner); err != nil {
+				lw.closers = append(lw.closers, inner.closers...)
+				return err
+			}
+		}
+
+		for _, r := range inner.routes {
+			r.match = m
+			lw.routes = append(lw.routes, r)
+		}
+		lw.closers = append(lw.closers, inner.closers...)
+		lw.patterns = append(lw.patterns, inner.patterns...)
+		return nil
+	}
+}
+
+// routingHandler fans records out to every route whose Match accepts them.
+type routingHandler struct {
+	routes []route
+
+	// service is the source service set through WithAttrs, if any.
+	service string
+}
+
+func (h *routingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, r := range h.routes {
+		if level >= r.match.MinLevel && r.handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *routingHandler) Handle(ctx context.Context, record slog.Record) error {
+	service := recordService(record, h.service)
+
+	var errs []error
+	for _, r := range h.routes {
+		if !r.match.matches(service, record.Level) || !r.handler.Enabled(ctx, record.Level) {
+			continue
+		}
+		errs = append(errs, r.handler.Handle(ctx, record.Clone()))
+	}
+	return errors.Join(errs...)
+}
+
+func (h *routingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := &routingHandler{
+		routes:  make([]route, len(h.routes)),
+		service: h.service,
+	}
+	for i, r := range h.routes {
+		next.routes[i] = route{match: r.match, handler: r.handler.WithAttrs(attrs)}
+	}
+	for _, a := range attrs {
+		if a.Key == ServiceKey {
+			next.service = a.Value.String()
+		}
+	}
+	return next
+}
+
+func (h *routingHandler) WithGroup(name string) slog.Handler {
+	next := &routingHandler{
+		routes:  make([]route, len(h.routes)),
+		service: h.service,
+	}
+	for i, r := range h.routes {
+		next.routes[i] = route{match: r.match, handler: r.handler.WithGroup(name)}
+	}
+	return next
+}
+
+// recordService returns the value of the record's service attribute, or
+// fallback when it has none.
+func recordService(record slog.Record, fallback string) string {
+	service := fallback
+	record.Attrs(func(a slog.Attr) bool {
+		if a.Key == ServiceKey {
+			service = a.Value.String()
+			return false
+		}
+		return true
+	})
+	return service
+}
@@ -0,0 +1,69 @@
+package logr
+
+import (
+	"log/slog"
+	"reflect"
+	"testing"
+)
+
+func TestRoutes(t *testing.T) {
+	tests := []struct {
+		name  string
+		match Match
+		want  []string
+	}{
+		{"every record", Match{MinLevel: AllLevels}, []string{"debug", "business info", "business error", "logging info", "logging warn"}},
+		{"by service", Match{Service: "Business", MinLevel: AllLevels}, []string{"business info", "business error"}},
+		{"by level", Match{MinLevel: slog.LevelWarn}, []string{"business error", "logging warn"}},
+		{"by service and level", Match{Service: "Logging", MinLevel: slog.LevelWarn}, []string{"logging warn"}},
+		{"zero level", Match{Service: "Business"}, []string{"business info", "business error"}},
+		{"no match", Match{Service: "Registry"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routed := NewRingBuffer(10)
+			logger, err := NewLogWriter(WithLevel(slog.LevelDebug), WithRoute(tt.match, WithRingBuffer(routed)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer logger.Close()
+
+			logger.Debug("debug")
+			// The service is attached with With, as services do, or per record.
+			business := logger.With(ServiceKey, "Business")
+			business.Info("business info")
+			business.WithGroup("request").Error("business error")
+			logger.Info("logging info", ServiceKey, "Logging")
+			logger.Warn("logging warn", ServiceKey, "Logging")
+
+			if got := messages(t, routed); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("routed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoutesAndSinks(t *testing.T) {
+	all := NewRingBuffer(10)
+	routed := NewRingBuffer(10)
+	logger, err := NewLogWriter(
+		WithRingBuffer(all),
+		WithRoute(Match{Service: "Business", MinLevel: slog.LevelError}, WithRingBuffer(routed)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	business := logger.With(ServiceKey, "Business")
+	business.Info("started")
+	business.Error("failed")
+	logger.Error("failed elsewhere")
+
+	if got, want := messages(t, all), []string{"started", "failed", "failed elsewhere"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unrouted sink got %q, want %q", got, want)
+	}
+	if got, want := messages(t, routed), []string{"failed"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("routed sink got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,232 @@
+package logr
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// WithStdout adds a sink writing JSON records to stdout.
+func WithStdout() Option {
+	return func(lw *Logger) error {
+		lw.addSink(slog.NewJSONHandler(os.Stdout, sinkOptions))
+		return nil
+	}
+}
+
+// MaxOpenServiceFiles is the number of per-service files kept open at once.
+// Beyond it, the least recently written file is closed and reopened when its
+// service logs again.
+const MaxOpenServiceFiles = 128
+
+// WithServiceFiles adds a sink writing each service's records to its own
+// <dir>/<service>.log file. Records without a service attribute go to unknown.log.
+func WithServiceFiles(dir string) Option {
+	return func(lw *Logger) error {
+		if err := ensureDir(dir); err != nil {
+			return err
+		}
+
+		files := &serviceFiles{dir: dir, open: lw.openFile, max: MaxOpenServiceFiles}
+		lw.closers = append(lw.closers, files)
+		lw.patterns = append(lw.patterns, filepath.Join(dir, "*.log"), filepath.Join(dir, "*.log.*"))
+		lw.addSink(&serviceFileHandler{files: files})
+		return nil
+	}
+}
+
+// serviceFiles lazily opens one log file per service, keeping at most max
+// open and closing the least recently used one to make room.
+type serviceFiles struct {
+	dir  string
+	open func(path string, flag int, perm os.FileMode) (io.WriteCloser, error)
+	max  int
+
+	mu    sync.Mutex
+	files map[string]*serviceFile
+	lru   *list.List // of *serviceFile, most recently used first
+}
+
+// serviceFile is an open file and its handler. A file evicted while records
+// are being written to it is closed once the last of them is done.
+type serviceFile struct {
+	service string
+	file    io.Closer
+	handler slog.Handler
+	element *list.Element
+	users   int
+	evicted bool
+}
+
+// acquire returns the file of service, opening it if needed. release must be
+// called once the record is written.
+func (sf *serviceFiles) acquire(service string) (*serviceFile, error) {
+	if service == "" {
+		service = "unknown"
+	}
+	// Service names come from remote callers, keep them inside dir.
+	service = strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(service)
+
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	if sf.files == nil {
+		sf.files = make(map[string]*serviceFile)
+		sf.lru = list.New()
+	}
+	if f, ok := sf.files[service]; ok {
+		sf.lru.MoveToFront(f.element)
+		f.users++
+		return f, nil
+	}
+
+	file, err := sf.open(filepath.Join(sf.dir, service+".log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	f := &serviceFile{service: service, file: file, handler: slog.NewJSONHandler(file, sinkOptions), users: 1}
+	f.element = sf.lru.PushFront(f)
+	sf.files[service] = f
+
+	for sf.max > 0 && sf.lru.Len() > sf.max {
+		oldest := sf.lru.Remove(sf.lru.Back()).(*serviceFile)
+		delete(sf.files, oldest.service)
+		oldest.evicted = true
+		if oldest.users == 0 {
+			oldest.file.Close()
+		}
+	}
+	return f, nil
+}
+
+func (sf *serviceFiles) release(f *serviceFile) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	f.users--
+	if f.evicted && f.users == 0 {
+		f.file.Close()
+	}
+}
+
+func (sf *serviceFiles) Close() error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	var firstErr error
+	for _, f := range sf.files {
+		if err := f.file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	sf.files = nil
+	sf.lru = nil
+	return firstErr
+}
+
+// serviceFileHandler picks the file for each record from its service
+// attribute and replays WithAttrs/WithGroup calls onto that file's handler.
+type serviceFileHandler struct {
+	files   *serviceFiles
+	service string
+	wrap    []func(slog.Handler) slog.Handler
+}
+
+func (h *serviceFileHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *serviceFileHandler) Handle(ctx context.Context, record slog.Record) error {
+	f, err := h.files.acquire(recordService(record, h.service))
+	if err != nil {
+		return err
+	}
+	defer h.files.release(f)
+
+	base := f.handler
+	for _, w := range h.wrap {
+		base = w(base)
+	}
+	return base.Handle(ctx, record)
+}
+
+func (h *serviceFileHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := h.with(func(base slog.Handler) slog.Handler { return base.WithAttrs(attrs) })
+	for _, a := range attrs {
+		if a.Key == ServiceKey {
+			next.service = a.Value.String()
+		}
+	}
+	return next
+}
+
+func (h *serviceFileHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(base slog.Handler) slog.Handler { return base.WithGroup(name) })
+}
+
+func (h *serviceFileHandler) with(w func(slog.Handler) slog.Handler) *serviceFileHandler {
+	wrap := make([]func(slog.Handler) slog.Handler, len(h.wrap), len(h.wrap)+1)
+	copy(wrap, h.wrap)
+	return &serviceFileHandler{files: h.files, service: h.service, wrap: append(wrap, w)}
+}
+
+// RingBuffer keeps the most recent records in memory as encoded JSON.
+type RingBuffer struct {
+	mu      sync.Mutex
+	entries []json.RawMessage
+	next    int
+	full    bool
+}
+
+// NewRingBuffer returns a RingBuffer holding up to size records.
+func NewRingBuffer(size int) *RingBuffer {
+	if size < 1 {
+		size = 1
+	}
+	return &RingBuffer{entries: make([]json.RawMessage, size)}
+}
+
+// Write stores one encoded record, overwriting the oldest once the buffer is full.
+func (rb *RingBuffer) Write(p []byte) (int, error) {
+	entry := make(json.RawMessage, len(p))
+	copy(entry, p)
+	entry = bytes.TrimRight(entry, "\n")
+
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	rb.entries[rb.next] = entry
+	rb.next = (rb.next + 1) % len(rb.entries)
+	if rb.next == 0 {
+		rb.full = true
+	}
+	return len(p), nil
+}
+
+// Entries returns the buffered records, oldest first.
+func (rb *RingBuffer) Entries() []json.RawMessage {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	if !rb.full {
+		return append([]json.RawMessage(nil), rb.entries[:rb.next]...)
+	}
+	out := make([]json.RawMessage, 0, len(rb.entries))
+	out = append(out, rb.entries[rb.next:]...)
+	return append(out, rb.entries[:rb.next]...)
+}
+
+// WithRingBuffer adds a sink keeping recent records in rb.
+func WithRingBuffer(rb *RingBuffer) Option {
+	return func(lw *Logger) error {
+		lw.addSink(slog.NewJSONHandler(rb, sinkOptions))
+		return nil
+	}
+}
@@ -0,0 +1,152 @@
+package logr
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServiceFilesCapsOpenFiles(t *testing.T) {
+	dir := t.TempDir()
+	var open atomic.Int32
+	var maxOpen int32
+	var mu sync.Mutex
+	files := &serviceFiles{
+		dir: dir,
+		max: 2,
+		open: func(path string, flag int, perm os.FileMode) (io.WriteCloser, error) {
+			f, err := os.OpenFile(path, flag, perm)
+			if err != nil {
+				return nil, err
+			}
+			mu.Lock()
+			if n := open.Add(1); n > maxOpen {
+				maxOpen = n
+			}
+			mu.Unlock()
+			return &closeCounter{WriteCloser: f, open: &open}, nil
+		},
+	}
+	handler := &serviceFileHandler{files: files}
+
+	services := []string{"Business", "Logging", "Registry", "Business", "Billing"}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			service := services[i%len(services)]
+			record := slog.NewRecord(time.Now(), slog.LevelInfo, fmt.Sprint("record ", i), 0)
+			record.AddAttrs(slog.String(ServiceKey, service))
+			if err := handler.Handle(context.Background(), record); err != nil {
+				t.Errorf("Handle() = %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Files evicted while in use stay open until their records are written.
+	if maxOpen > 2+4 {
+		t.Errorf("%d files open at once", maxOpen)
+	}
+	if err := files.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := open.Load(); n != 0 {
+		t.Errorf("%d files still open after Close", n)
+	}
+
+	// Every record reached its service's file despite the evictions.
+	total := 0
+	for _, service := range []string{"Business", "Logging", "Registry", "Billing"} {
+		data, err := os.ReadFile(filepath.Join(dir, service+".log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += strings.Count(string(data), "\n")
+	}
+	if total != 50 {
+		t.Errorf("%d records written, want 50", total)
+	}
+}
+
+func TestServiceFilesEvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	var opened []string
+	files := &serviceFiles{
+		dir: dir,
+		max: 2,
+		open: func(path string, flag int, perm os.FileMode) (io.WriteCloser, error) {
+			opened = append(opened, filepath.Base(path))
+			return os.OpenFile(path, flag, perm)
+		},
+	}
+	defer files.Close()
+
+	for _, service := range []string{"a", "b", "a", "c", "a", "b"} {
+		f, err := files.acquire(service)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files.release(f)
+	}
+
+	// "a" stays open as the most recently used; "b" is evicted by "c" and reopened.
+	want := []string{"a.log", "b.log", "c.log", "b.log"}
+	if fmt.Sprint(opened) != fmt.Sprint(want) {
+		t.Errorf("opened %v, want %v", opened, want)
+	}
+}
+
+func TestRingBuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		writes int
+		want   []string
+	}{
+		{"empty", 3, 0, nil},
+		{"partly filled", 3, 2, []string{"1", "2"}},
+		{"exactly full", 3, 3, []string{"1", "2", "3"}},
+		{"wrapped around", 3, 5, []string{"3", "4", "5"}},
+		{"wrapped around twice", 3, 7, []string{"5", "6", "7"}},
+		{"size below one", 0, 2, []string{"2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rb := NewRingBuffer(tt.size)
+			for i := 1; i <= tt.writes; i++ {
+				fmt.Fprintf(rb, "%d\n", i)
+			}
+			var got []string
+			for _, entry := range rb.Entries() {
+				got = append(got, string(entry))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Entries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type closeCounter struct {
+	io.WriteCloser
+	open   *atomic.Int32
+	closed atomic.Bool
+}
+
+func (c *closeCounter) Close() error {
+	if c.closed.Swap(true) {
+		return os.ErrClosed
+	}
+	c.open.Add(-1)
+	return c.WriteCloser.Close()
+}
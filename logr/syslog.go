@@ -0,0 +1,343 @@
+package logr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syslogFacility is the RFC 5424 facility used for forwarded records (user-level).
+const syslogFacility = 1
+
+// syslogSDID is the structured data element carrying record attributes.
+// 32473 is the enterprise number RFC 5612 reserves for documentation.
+const syslogSDID = "attrs@32473"
+
+// WithSyslog adds a sink forwarding records in RFC 5424 syslog format to a
+// collector at addr over network ("udp" or "tcp").
+func WithSyslog(network, addr string) Option {
+	return func(lw *Logger) error {
+		if network != "udp" && network != "tcp" {
+			return fmt.Errorf("unsupported syslog network: %q", network)
+		}
+
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "-"
+		}
+
+		conn := &syslogConn{network: network, addr: addr}
+		lw.closers = append(lw.closers, conn)
+		lw.addSink(&syslogHandler{conn: conn, hostname: hostname})
+		return nil
+	}
+}
+
+// syslogConn is a lazily dialed connection to a syslog collector that
+// redials after write errors.
+type syslogConn struct {
+	network string
+	addr    string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (c *syslogConn) send(msg []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// TCP needs framing, use octet counting (RFC 6587).
+	if c.network == "tcp" {
+		msg = append([]byte(fmt.Sprintf("%d ", len(msg))), msg...)
+	}
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if c.conn == nil {
+			c.conn, err = net.DialTimeout(c.network, c.addr, 2*time.Second)
+			if err != nil {
+				return err
+			}
+		}
+		if _, err = c.conn.Write(msg); err == nil {
+			return nil
+		}
+		c.conn.Close()
+		c.conn = nil
+	}
+	return err
+}
+
+func (c *syslogConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+type syslogHandler struct {
+	conn     *syslogConn
+	hostname string
+	service  string
+	prefix   string
+	attrs    []slog.Attr
+}
+
+func (h *syslogHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *syslogHandler) Handle(_ context.Context, record slog.Record) error {
+	return h.conn.send(h.format(record))
+}
+
+func (h *syslogHandler) format(record slog.Record) []byte {
+	appName := recordService(record, h.service)
+	if appName == "" {
+		appName = "-"
+	}
+
+	var params []string
+	for _, a := range h.attrs {
+		params = appendSyslogParams(params, "", a)
+	}
+	record.Attrs(func(a slog.Attr) bool {
+		params = appendSyslogParams(params, h.prefix, a)
+		return true
+	})
+
+	sd := "-"
+	if len(params) > 0 {
+		sd = "[" + syslogSDID + " " + strings.Join(params, " ") + "]"
+	}
+
+	ts := record.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	return []byte(fmt.Sprintf("<%d>1 %s %s %s %d - %s %s",
+		syslogFacility*8+syslogSeverity(record.Level),
+		ts.Format(time.RFC3339Nano),
+		h.hostname,
+		appName,
+		os.Getpid(),
+		sd,
+		record.Message,
+	))
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	next.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		if h.prefix != "" {
+			a.Key = h.prefix + a.Key
+		} else if a.Key == ServiceKey {
+			next.service = a.Value.String()
+		}
+		next.attrs = append(next.attrs, a)
+	}
+	return &next
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	next := *h
+	next.prefix = h.prefix + name + "."
+	return &next
+}
+
+// syslogSeverity maps slog levels onto RFC 5424 severities.
+func syslogSeverity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	default:
+		return 7
+	}
+}
+
+// appendSyslogParams flattens a into SD-PARAMs, expanding groups into dotted names.
+func appendSyslogParams(params []string, prefix string, a slog.Attr) []string {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			params = appendSyslogParams(params, prefix+a.Key+".", ga)
+		}
+		return params
+	}
+	if a.Key == "" {
+		return params
+	}
+
+	value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(a.Value.String())
+	return append(params, fmt.Sprintf(`%s="%s"`, syslogParamName(prefix+a.Key), value))
+}
+
+// syslogParamName replaces characters RFC 5424 forbids in PARAM-NAMEs.
+func syslogParamName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return name
+}
+
+// ParseSyslog decodes an RFC 5424 syslog message. The APP-NAME becomes the
+// entry's service and structured data parameters become attributes; params of
+// elements other than the one written by WithSyslog are prefixed with their SD-ID.
+func ParseSyslog(data []byte) (Entry, error) {
+	msg := string(bytes.TrimRight(data, "\r\n\x00"))
+
+	if !strings.HasPrefix(msg, "<") {
+		return Entry{}, errors.New("syslog: missing PRI")
+	}
+	end := strings.IndexByte(msg, '>')
+	if end < 2 || end > 4 {
+		return Entry{}, errors.New("syslog: invalid PRI")
+	}
+	pri, err := strconv.Atoi(msg[1:end])
+	if err != nil || pri > 191 {
+		return Entry{}, errors.New("syslog: invalid PRI")
+	}
+	msg = msg[end+1:]
+
+	// VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID
+	var header [6]string
+	for i := range header {
+		field, rest, ok := strings.Cut(msg, " ")
+		if !ok && i < len(header)-1 {
+			return Entry{}, errors.New("syslog: truncated header")
+		}
+		header[i], msg = field, rest
+	}
+	if header[0] != "1" {
+		return Entry{}, fmt.Errorf("syslog: unsupported version %q", header[0])
+	}
+
+	e := Entry{
+		Time:  time.Now(),
+		Level: syslogLevel(pri % 8),
+	}
+	if header[1] != "-" {
+		t, err := time.Parse(time.RFC3339Nano, header[1])
+		if err != nil {
+			return Entry{}, fmt.Errorf("syslog: invalid timestamp: %w", err)
+		}
+		e.Time = t
+	}
+	if header[3] != "-" {
+		e.Service = header[3]
+	}
+
+	e.Attrs = append(e.Attrs, slog.Int("facility", pri/8))
+	for i, key := range []string{"", "", "host", "", "procid", "msgid"} {
+		if key != "" && header[i] != "-" {
+			e.Attrs = append(e.Attrs, slog.String(key, header[i]))
+		}
+	}
+
+	sdAttrs, rest, err := parseStructuredData(msg)
+	if err != nil {
+		return Entry{}, err
+	}
+	e.Attrs = append(e.Attrs, sdAttrs...)
+	e.Message = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\uFEFF")
+
+	return e, nil
+}
+
+// parseStructuredData consumes STRUCTURED-DATA from the start of msg and
+// returns its params as attributes along with the remaining text.
+func parseStructuredData(msg string) ([]slog.Attr, string, error) {
+	if strings.HasPrefix(msg, "-") {
+		return nil, msg[1:], nil
+	}
+
+	if !strings.HasPrefix(msg, "[") {
+		return nil, "", errors.New("syslog: invalid structured data")
+	}
+
+	// An SD-ELEMENT may have no params, e.g. [exampleSDID@32473].
+	var attrs []slog.Attr
+	for strings.HasPrefix(msg, "[") {
+		end := strings.IndexAny(msg, " ]")
+		if end < 0 {
+			return nil, "", errors.New("syslog: unterminated structured data")
+		}
+		id := msg[1:end]
+		if id == "" {
+			return nil, "", errors.New("syslog: missing SD-ID")
+		}
+		msg = msg[end:]
+
+		for strings.HasPrefix(msg, " ") {
+			name, rest, ok := strings.Cut(msg[1:], `="`)
+			if !ok {
+				return nil, "", errors.New("syslog: invalid SD-PARAM")
+			}
+
+			var value strings.Builder
+			i := 0
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) && strings.IndexByte(`"\]`, rest[i+1]) >= 0 {
+					i++
+				}
+				value.WriteByte(rest[i])
+			}
+			if i == len(rest) {
+				return nil, "", errors.New("syslog: unterminated SD-PARAM value")
+			}
+			msg = rest[i+1:]
+
+			if id != syslogSDID {
+				name = id + "." + name
+			}
+			attrs = append(attrs, slog.String(name, value.String()))
+		}
+
+		if !strings.HasPrefix(msg, "]") {
+			return nil, "", errors.New("syslog: unterminated SD-ELEMENT")
+		}
+		msg = msg[1:]
+	}
+
+	return attrs, msg, nil
+}
+
+// syslogLevel maps RFC 5424 severities onto slog levels.
+func syslogLevel(severity int) slog.Level {
+	switch {
+	case severity <= 3:
+		return slog.LevelError
+	case severity == 4:
+		return slog.LevelWarn
+	case severity <= 6:
+		return slog.LevelInfo
+	default:
+		return slog.LevelDebug
+	}
+}
@@ -0,0 +1,138 @@
+package logr
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestParseSyslog(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    Entry
+		wantErr bool
+	}{
+		{
+			name: "no structured data",
+			data: "<165>1 2026-10-19T10:00:00Z host1 Business 42 ID47 - hello world\n",
+			want: Entry{
+				Time:    time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC),
+				Level:   slog.LevelInfo,
+				Service: "Business",
+				Message: "hello world",
+				Attrs: []slog.Attr{
+					slog.Int("facility", 20),
+					slog.String("host", "host1"),
+					slog.String("procid", "42"),
+					slog.String("msgid", "ID47"),
+				},
+			},
+		},
+		{
+			name: "own and foreign SD-ELEMENTs",
+			data: `<11>1 - - app - - [attrs@32473 user="ann"][origin@123 ip="10.0.0.1" note="a \"quoted\] value"] failed`,
+			want: Entry{
+				Level:   slog.LevelError,
+				Service: "app",
+				Message: "failed",
+				Attrs: []slog.Attr{
+					slog.Int("facility", 1),
+					slog.String("user", "ann"),
+					slog.String("origin@123.ip", "10.0.0.1"),
+					slog.String("origin@123.note", `a "quoted] value`),
+				},
+			},
+		},
+		{
+			name: "SD-ELEMENT without params",
+			data: "<14>1 - - app - - [exampleSDID@32473] started",
+			want: Entry{
+				Level:   slog.LevelInfo,
+				Service: "app",
+				Message: "started",
+				Attrs:   []slog.Attr{slog.Int("facility", 1)},
+			},
+		},
+		{
+			name: "empty SD-ELEMENT followed by params",
+			data: `<15>1 - - - - - [exampleSDID@32473][attrs@32473 k="v"] debug`,
+			want: Entry{
+				Level:   slog.LevelDebug,
+				Message: "debug",
+				Attrs:   []slog.Attr{slog.Int("facility", 1), slog.String("k", "v")},
+			},
+		},
+		{
+			name: "BOM before the message",
+			data: "<14>1 - - app - - - \uFEFFtext",
+			want: Entry{Level: slog.LevelInfo, Service: "app", Message: "text", Attrs: []slog.Attr{slog.Int("facility", 1)}},
+		},
+		{name: "missing PRI", data: "1 - - app - - - text", wantErr: true},
+		{name: "PRI out of range", data: "<192>1 - - app - - - text", wantErr: true},
+		{name: "unsupported version", data: "<14>2 - - app - - - text", wantErr: true},
+		{name: "truncated header", data: "<14>1 - - app", wantErr: true},
+		{name: "invalid timestamp", data: "<14>1 yesterday - app - - - text", wantErr: true},
+		{name: "text instead of structured data", data: "<14>1 - - app - - text", wantErr: true},
+		{name: "empty SD-ID", data: "<14>1 - - app - - [] text", wantErr: true},
+		{name: "unterminated SD-ELEMENT", data: `<14>1 - - app - - [id k="v" text`, wantErr: true},
+		{name: "unterminated SD-PARAM value", data: `<14>1 - - app - - [id k="v] text`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSyslog([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSyslog() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.want.Time.IsZero() {
+				// Without a timestamp the entry is stamped on arrival.
+				got.Time = time.Time{}
+			}
+			assertEntry(t, got, tt.want)
+		})
+	}
+}
+
+func TestSyslogRoundTrip(t *testing.T) {
+	h := &syslogHandler{service: "Business", hostname: "host1"}
+	record := slog.NewRecord(time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC), slog.LevelWarn, "disk almost full", 0)
+	record.AddAttrs(slog.String("disk", "/var"), slog.Int("percent", 93))
+
+	got, err := ParseSyslog(h.format(record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Message != "disk almost full" || got.Level != slog.LevelWarn || got.Service != "Business" {
+		t.Errorf("ParseSyslog(format()) = %+v", got)
+	}
+	if !hasAttr(got.Attrs, slog.String("disk", "/var")) || !hasAttr(got.Attrs, slog.String("percent", "93")) {
+		t.Errorf("attributes lost in round trip: %v", got.Attrs)
+	}
+}
+
+func assertEntry(t *testing.T, got, want Entry) {
+	t.Helper()
+	if !got.Time.Equal(want.Time) || got.Level != want.Level || got.Service != want.Service || got.Message != want.Message {
+		t.Errorf("got entry %+v, want %+v", got, want)
+	}
+	if len(got.Attrs) != len(want.Attrs) {
+		t.Fatalf("got attrs %v, want %v", got.Attrs, want.Attrs)
+	}
+	for i := range want.Attrs {
+		if !got.Attrs[i].Equal(want.Attrs[i]) {
+			t.Errorf("attr %d = %v, want %v", i, got.Attrs[i], want.Attrs[i])
+		}
+	}
+}
+
+func hasAttr(attrs []slog.Attr, want slog.Attr) bool {
+	for _, a := range attrs {
+		if a.Equal(want) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,387 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are latency buckets in seconds suited to HTTP requests.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry holds metrics and writes them in the Prometheus text exposition format.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// metric is a named family of series.
+type metric interface {
+	write(w io.Writer, name string) error
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.metrics[name]; exists {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+	r.metrics[name] = m
+}
+
+// WriteText writes every metric, sorted by name.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	metrics := make(map[string]metric, len(r.metrics))
+	for name, m := range r.metrics {
+		names = append(names, name)
+		metrics[name] = m
+	}
+	r.mu.Unlock()
+
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		if err := metrics[name].write(bw, name); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registry on a Prometheus scrape endpoint.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := r.WriteText(w); err != nil {
+			http.Error(w, fmt.Sprintf("failed to write metrics: %v", err), http.StatusInternalServerError)
+		}
+	})
+}
+
+// vec tracks one series per combination of label values.
+type vec[T any] struct {
+	help   string
+	kind   string
+	labels []string
+	newFn  func() *T
+
+	mu     sync.Mutex
+	series map[string]*T
+	values map[string][]string
+}
+
+func newVec[T any](help, kind string, labels []string, newFn func() *T) *vec[T] {
+	return &vec[T]{
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		newFn:  newFn,
+		series: make(map[string]*T),
+		values: make(map[string][]string),
+	}
+}
+
+func (v *vec[T]) with(labelValues []string) *T {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: expected %d label values, got %d", len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	s, ok := v.series[key]
+	if !ok {
+		s = v.newFn()
+		v.series[key] = s
+		v.values[key] = append([]string(nil), labelValues...)
+	}
+	return s
+}
+
+// each calls fn for every series, ordered by label values.
+func (v *vec[T]) each(fn func(labelValues []string, s *T) error) error {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	series := make(map[string]*T, len(keys))
+	values := make(map[string][]string, len(keys))
+	for _, k := range keys {
+		series[k] = v.series[k]
+		values[k] = v.values[k]
+	}
+	v.mu.Unlock()
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := fn(values[k], series[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *vec[T]) header(w io.Writer, name string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(v.help), name, v.kind)
+	return err
+}
+
+// Value is a float that is safe for concurrent use.
+type Value struct {
+	mu sync.Mutex
+	v  float64
+}
+
+// Add adds delta to the value.
+func (v *Value) Add(delta float64) {
+	v.mu.Lock()
+	v.v += delta
+	v.mu.Unlock()
+}
+
+// Set replaces the value. Only meaningful for gauges.
+func (v *Value) Set(value float64) {
+	v.mu.Lock()
+	v.v = value
+	v.mu.Unlock()
+}
+
+// Inc adds one to the value.
+func (v *Value) Inc() { v.Add(1) }
+
+// Dec subtracts one from the value. Only meaningful for gauges.
+func (v *Value) Dec() { v.Add(-1) }
+
+func (v *Value) get() float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.v
+}
+
+// CounterVec is a family of counters partitioned by labels.
+type CounterVec struct{ *vec[Value] }
+
+// NewCounterVec registers a counter family.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(help, "counter", labels, func() *Value { return &Value{} })}
+	r.register(name, c)
+	return c
+}
+
+// With returns the counter for labelValues. Counters only ever increase; use Inc or Add.
+func (c *CounterVec) With(labelValues ...string) *Value {
+	return c.with(labelValues)
+}
+
+func (c *CounterVec) write(w io.Writer, name string) error {
+	return writeValues(w, name, c.vec)
+}
+
+// GaugeVec is a family of gauges partitioned by labels.
+type GaugeVec struct{ *vec[Value] }
+
+// NewGaugeVec registers a gauge family.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newVec(help, "gauge", labels, func() *Value { return &Value{} })}
+	r.register(name, g)
+	return g
+}
+
+// With returns the gauge for labelValues.
+func (g *GaugeVec) With(labelValues ...string) *Value {
+	return g.with(labelValues)
+}
+
+func (g *GaugeVec) write(w io.Writer, name string) error {
+	return writeValues(w, name, g.vec)
+}
+
+func writeValues(w io.Writer, name string, v *vec[Value]) error {
+	if err := v.header(w, name); err != nil {
+		return err
+	}
+	return v.each(func(labelValues []string, s *Value) error {
+		_, err := fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(v.labels, labelValues), formatFloat(s.get()))
+		return err
+	})
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Observe records one value.
+func (h *Histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		if value <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// HistogramVec is a family of histograms partitioned by labels.
+type HistogramVec struct {
+	*vec[Histogram]
+	buckets []float64
+}
+
+// NewHistogramVec registers a histogram family with the given upper bounds.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	h := &HistogramVec{
+		vec: newVec(help, "histogram", labels, func() *Histogram {
+			return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+		}),
+		buckets: buckets,
+	}
+	r.register(name, h)
+	return h
+}
+
+// With returns the histogram for labelValues.
+func (h *HistogramVec) With(labelValues ...string) *Histogram {
+	return h.with(labelValues)
+}
+
+func (h *HistogramVec) write(w io.Writer, name string) error {
+	if err := h.header(w, name); err != nil {
+		return err
+	}
+
+	bucketLabels := append(append([]string(nil), h.labels...), "le")
+	return h.each(func(labelValues []string, s *Histogram) error {
+		s.mu.Lock()
+		counts := append([]uint64(nil), s.counts...)
+		sum, count := s.sum, s.count
+		s.mu.Unlock()
+
+		for i, upper := range h.buckets {
+			le := append(append([]string(nil), labelValues...), formatFloat(upper))
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(bucketLabels, le), counts[i]); err != nil {
+				return err
+			}
+		}
+		inf := append(append([]string(nil), labelValues...), "+Inf")
+		labels := formatLabels(h.labels, labelValues)
+		_, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			name, formatLabels(bucketLabels, inf), count,
+			name, labels, formatFloat(sum),
+			name, labels, count)
+		return err
+	})
+}
+
+// Emit reports one sample of a function-backed metric.
+type Emit func(value float64, labelValues ...string)
+
+// funcMetric computes its samples on every scrape.
+type funcMetric struct {
+	help    string
+	kind    string
+	labels  []string
+	collect func(emit Emit)
+}
+
+// NewGaugeFunc registers a gauge family whose samples are computed by collect on every scrape.
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, collect func(emit Emit)) {
+	r.register(name, &funcMetric{help: help, kind: "gauge", labels: labels, collect: collect})
+}
+
+// NewCounterFunc registers a counter family whose samples are computed by collect on every scrape.
+func (r *Registry) NewCounterFunc(name, help string, labels []string, collect func(emit Emit)) {
+	r.register(name, &funcMetric{help: help, kind: "counter", labels: labels, collect: collect})
+}
+
+func (f *funcMetric) write(w io.Writer, name string) error {
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(f.help), name, f.kind); err != nil {
+		return err
+	}
+
+	type sample struct {
+		labels string
+		value  float64
+	}
+	var samples []sample
+	f.collect(func(value float64, labelValues ...string) {
+		samples = append(samples, sample{labels: formatLabels(f.labels, labelValues), value: value})
+	})
+	sort.Slice(samples, func(i, j int) bool { return samples[i].labels < samples[j].labels })
+
+	for _, s := range samples {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", name, s.labels, formatFloat(s.value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
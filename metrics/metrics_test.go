@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	tests := []struct {
+		name     string
+		register func(r *Registry)
+		want     string
+	}{
+		{
+			name: "counter series sorted by label values",
+			register: func(r *Registry) {
+				c := r.NewCounterVec("requests_total", "Requests handled.", "route", "code")
+				c.With("/log", "500").Inc()
+				c.With("/healthcheck", "200").Add(2)
+				c.With("/log", "200").Inc()
+			},
+			want: `# HELP requests_total Requests handled.
+# TYPE requests_total counter
+requests_total{route="/healthcheck",code="200"} 2
+requests_total{route="/log",code="200"} 1
+requests_total{route="/log",code="500"} 1
+`,
+		},
+		{
+			name: "metrics sorted by name",
+			register: func(r *Registry) {
+				r.NewGaugeVec("b_gauge", "B.").With().Set(1.5)
+				r.NewGaugeVec("a_gauge", "A.").With().Dec()
+			},
+			want: `# HELP a_gauge A.
+# TYPE a_gauge gauge
+a_gauge -1
+# HELP b_gauge B.
+# TYPE b_gauge gauge
+b_gauge 1.5
+`,
+		},
+		{
+			name: "histogram buckets, sum and count",
+			register: func(r *Registry) {
+				h := r.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.1}, "route")
+				h.With("/log").Observe(0.05)
+				h.With("/log").Observe(0.5)
+				h.With("/log").Observe(3)
+			},
+			want: `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/log",le="0.1"} 1
+latency_seconds_bucket{route="/log",le="1"} 2
+latency_seconds_bucket{route="/log",le="+Inf"} 3
+latency_seconds_sum{route="/log"} 3.55
+latency_seconds_count{route="/log"} 3
+`,
+		},
+		{
+			name: "label values and help escaped",
+			register: func(r *Registry) {
+				c := r.NewCounterVec("messages_total", "Messages\nby \\ text.", "message")
+				c.With(`say "hi"`).Inc()
+				c.With("C:\\logs").Inc()
+				c.With("two\nlines").Inc()
+			},
+			want: `# HELP messages_total Messages\nby \\ text.
+# TYPE messages_total counter
+messages_total{message="C:\\logs"} 1
+messages_total{message="say \"hi\""} 1
+messages_total{message="two\nlines"} 1
+`,
+		},
+		{
+			name: "function samples sorted by labels",
+			register: func(r *Registry) {
+				r.NewGaugeFunc("instances", "Instances.", []string{"type"}, func(emit Emit) {
+					emit(2, "Logging")
+					emit(1, "Business")
+				})
+			},
+			want: `# HELP instances Instances.
+# TYPE instances gauge
+instances{type="Business"} 1
+instances{type="Logging"} 2
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			tt.register(r)
+
+			var b strings.Builder
+			if err := r.WriteText(&b); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("WriteText() =\n%s\nwant\n%s", b.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("requests_total", "Requests handled.").With().Inc()
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(w.Body.String(), "requests_total 1\n") {
+		t.Errorf("body = %q", w.Body.String())
+	}
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice did not panic")
+		}
+	}()
+	r := NewRegistry()
+	r.NewCounterVec("requests_total", "Requests handled.")
+	r.NewGaugeVec("requests_total", "Requests handled.")
+}
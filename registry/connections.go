@@ -0,0 +1,397 @@
+package registry
+
+import (
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// Change describes an instance being connected to or disconnected from a
+// required service type.
+type Change struct {
+	ServiceType string
+	Instance    ConnectedInstance
+
+	// Connected is false when Instance was disconnected.
+	Connected bool
+}
+
+// Connections holds the instance a service is connected to for each service
+// type it requires, and every instance of those types it has heard of as
+// candidates to replace it, along with the traffic policies of those types
+// and which candidates passed their last health check. It is safe for
+// concurrent use; the zero value is empty and ready to use.
+type Connections struct {
+	mu          sync.RWMutex
+	instances   ConnectedInstances
+	known       map[string][]ConnectedInstance
+	healthy     map[string]map[string]bool
+	policies    map[string]TrafficPolicy
+	subscribers map[int]func(Change)
+	nextID      int
+
+	// pending holds changes not yet delivered to subscribers, in the order
+	// they were made; delivering is set while a goroutine delivers them.
+	pending    []Change
+	delivering bool
+}
+
+// Get returns the instance connected for serviceType.
+func (c *Connections) Get(serviceType string) (ConnectedInstance, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	instance, ok := c.instances[serviceType]
+	return instance, ok
+}
+
+// Choose returns the instance a request to serviceType should go to. Under a
+// traffic policy it picks a version by the policy's splits, among the versions
+// with eligible instances, and then an eligible instance of that version by
+// weight. Eligible instances are active and either connected or healthy at
+// their last check (see SetHealthy). Without a policy, or when no version in
+// it has an eligible instance, it returns the connected instance like Get.
+func (c *Connections) Choose(serviceType string) (ConnectedInstance, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	connected, isConnected := c.instances[serviceType]
+	if policy, ok := c.policies[serviceType]; ok {
+		byVersion := make(map[string][]ConnectedInstance)
+		for _, k := range c.known[serviceType] {
+			eligible := c.healthy[serviceType][addr(k)] || (isConnected && sameAddr(k, connected))
+			if eligible && k.Active() && policy.Splits[k.Version] > 0 {
+				byVersion[k.Version] = append(byVersion[k.Version], k)
+			}
+		}
+
+		total := 0
+		for version := range byVersion {
+			total += policy.Splits[version]
+		}
+		if total > 0 {
+			n := rand.Intn(total)
+			for version, instances := range byVersion {
+				if n -= policy.Splits[version]; n < 0 {
+					return chooseByWeight(instances), true
+				}
+			}
+		}
+	}
+
+	return connected, isConnected
+}
+
+// SetHealthy records the result of a health check of the known instance of
+// serviceType at instance's address, which makes it eligible for Choose
+// under a traffic policy while it is healthy.
+func (c *Connections) SetHealthy(serviceType string, instance ConnectedInstance, healthy bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.isKnown(serviceType, instance) {
+		return
+	}
+	if c.healthy == nil {
+		c.healthy = make(map[string]map[string]bool)
+	}
+	if c.healthy[serviceType] == nil {
+		c.healthy[serviceType] = make(map[string]bool)
+	}
+	c.healthy[serviceType][addr(instance)] = healthy
+}
+
+// Retain forgets the known instances of serviceType that are not among
+// current, such as instances discovery no longer reports, and returns them.
+func (c *Connections) Retain(serviceType string, current []ConnectedInstance) []ConnectedInstance {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var kept, gone []ConnectedInstance
+	for _, k := range c.known[serviceType] {
+		found := false
+		for _, i := range current {
+			if sameAddr(k, i) {
+				found = true
+				break
+			}
+		}
+		if found {
+			kept = append(kept, k)
+		} else {
+			gone = append(gone, k)
+			delete(c.healthy[serviceType], addr(k))
+		}
+	}
+	if len(gone) > 0 {
+		c.known[serviceType] = kept
+	}
+	return gone
+}
+
+// chooseByWeight picks one of instances, which must not be empty, with a
+// probability proportional to its weight.
+func chooseByWeight(instances []ConnectedInstance) ConnectedInstance {
+	total := 0
+	for _, i := range instances {
+		total += weight(i)
+	}
+	n := rand.Intn(total)
+	for _, i := range instances {
+		if n -= weight(i); n < 0 {
+			return i
+		}
+	}
+	return instances[len(instances)-1]
+}
+
+func weight(i ConnectedInstance) int {
+	if i.Weight <= 0 {
+		return 1
+	}
+	return i.Weight
+}
+
+// SetPolicy applies p to requests chosen for its service type, replacing the
+// previous policy. A policy without splits removes it.
+func (c *Connections) SetPolicy(p TrafficPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(p.Splits) == 0 {
+		delete(c.policies, p.ServiceType)
+		return
+	}
+	if c.policies == nil {
+		c.policies = make(map[string]TrafficPolicy)
+	}
+	c.policies[p.ServiceType] = p
+}
+
+// Policy returns the traffic policy applied to serviceType.
+func (c *Connections) Policy(serviceType string) (TrafficPolicy, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	p, ok := c.policies[serviceType]
+	return p, ok
+}
+
+// Snapshot returns a copy of all connected instances.
+func (c *Connections) Snapshot() ConnectedInstances {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	snapshot := make(ConnectedInstances, len(c.instances))
+	for serviceType, instance := range c.instances {
+		snapshot[serviceType] = instance
+	}
+	return snapshot
+}
+
+// Set connects instance for serviceType, replacing any previous instance.
+func (c *Connections) Set(serviceType string, instance ConnectedInstance) {
+	c.mu.Lock()
+	if c.instances == nil {
+		c.instances = make(ConnectedInstances)
+	}
+	previous, replaced := c.instances[serviceType]
+	c.instances[serviceType] = instance
+	if !replaced || previous != instance {
+		c.pending = append(c.pending, Change{ServiceType: serviceType, Instance: instance, Connected: true})
+	}
+	c.mu.Unlock()
+
+	c.deliver()
+}
+
+// SetIfAbsent connects instance for serviceType unless an instance is
+// already connected, and reports whether it did.
+func (c *Connections) SetIfAbsent(serviceType string, instance ConnectedInstance) bool {
+	c.mu.Lock()
+	if _, exists := c.instances[serviceType]; exists {
+		c.mu.Unlock()
+		return false
+	}
+	if c.instances == nil {
+		c.instances = make(ConnectedInstances)
+	}
+	c.instances[serviceType] = instance
+	c.pending = append(c.pending, Change{ServiceType: serviceType, Instance: instance, Connected: true})
+	c.mu.Unlock()
+
+	c.deliver()
+	return true
+}
+
+// Replace connects instance for serviceType unless an instance is already
+// connected or instance is no longer known, for example because it
+// deregistered after it was picked from Candidates, and reports whether it did.
+func (c *Connections) Replace(serviceType string, instance ConnectedInstance) bool {
+	c.mu.Lock()
+	if _, exists := c.instances[serviceType]; exists || !c.isKnown(serviceType, instance) {
+		c.mu.Unlock()
+		return false
+	}
+	if c.instances == nil {
+		c.instances = make(ConnectedInstances)
+	}
+	c.instances[serviceType] = instance
+	c.pending = append(c.pending, Change{ServiceType: serviceType, Instance: instance, Connected: true})
+	c.mu.Unlock()
+
+	c.deliver()
+	return true
+}
+
+func (c *Connections) isKnown(serviceType string, instance ConnectedInstance) bool {
+	for _, k := range c.known[serviceType] {
+		if sameAddr(k, instance) {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove disconnects the instance connected for serviceType if it is at the
+// same IP and port as instance, and reports whether it did.
+func (c *Connections) Remove(serviceType string, instance ConnectedInstance) bool {
+	c.mu.Lock()
+	current, exists := c.instances[serviceType]
+	if !exists || !sameAddr(current, instance) {
+		c.mu.Unlock()
+		return false
+	}
+	delete(c.instances, serviceType)
+	c.pending = append(c.pending, Change{ServiceType: serviceType, Instance: current, Connected: false})
+	c.mu.Unlock()
+
+	c.deliver()
+	return true
+}
+
+// Offer records instance as known for serviceType, replacing what was known
+// about it, and connects it if it is active and no instance is connected yet.
+// When instance is the one already connected, its state, version and weight
+// are refreshed in place and subscribers are told of the change. It reports
+// whether instance was connected.
+func (c *Connections) Offer(serviceType string, instance ConnectedInstance) bool {
+	c.mu.Lock()
+	if c.known == nil {
+		c.known = make(map[string][]ConnectedInstance)
+	}
+	known := c.known[serviceType][:0:0]
+	for _, k := range c.known[serviceType] {
+		if !sameAddr(k, instance) {
+			known = append(known, k)
+		}
+	}
+	c.known[serviceType] = append(known, instance)
+	if current, ok := c.instances[serviceType]; ok && current.ID == instance.ID && sameAddr(current, instance) {
+		c.instances[serviceType] = instance
+		if current != instance {
+			c.pending = append(c.pending, Change{ServiceType: serviceType, Instance: instance, Connected: true})
+		}
+	}
+	c.mu.Unlock()
+
+	c.deliver()
+	if !instance.Active() {
+		return false
+	}
+	return c.SetIfAbsent(serviceType, instance)
+}
+
+// Forget removes instance from the known instances of serviceType.
+func (c *Connections) Forget(serviceType string, instance ConnectedInstance) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.known == nil {
+		return
+	}
+	known := c.known[serviceType][:0:0]
+	for _, k := range c.known[serviceType] {
+		if !sameAddr(k, instance) {
+			known = append(known, k)
+		}
+	}
+	c.known[serviceType] = known
+	delete(c.healthy[serviceType], addr(instance))
+}
+
+// Candidates returns the known instances of serviceType, oldest first.
+func (c *Connections) Candidates(serviceType string) []ConnectedInstance {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]ConnectedInstance(nil), c.known[serviceType]...)
+}
+
+// Subscribe calls fn after every change until the returned function is
+// called. Changes are delivered one at a time in the order they were made.
+// While one goroutine is delivering, changes made by others are queued and
+// delivered by it, so fn may run after the method that made the change has
+// returned; fn may itself change the Connections.
+func (c *Connections) Subscribe(fn func(Change)) (unsubscribe func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.subscribers == nil {
+		c.subscribers = make(map[int]func(Change))
+	}
+	id := c.nextID
+	c.nextID++
+	c.subscribers[id] = fn
+
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.subscribers, id)
+	}
+}
+
+// deliver passes the pending changes to the subscribers, without holding the
+// lock, unless another goroutine is already delivering them.
+func (c *Connections) deliver() {
+	c.mu.Lock()
+	if c.delivering {
+		c.mu.Unlock()
+		return
+	}
+	c.delivering = true
+	for len(c.pending) > 0 {
+		change := c.pending[0]
+		c.pending = c.pending[1:]
+		subscribers := c.subscriberList()
+		c.mu.Unlock()
+
+		notify(subscribers, change)
+		c.mu.Lock()
+	}
+	c.delivering = false
+	c.mu.Unlock()
+}
+
+// subscriberList copies the subscribers so they can be called without the lock.
+func (c *Connections) subscriberList() []func(Change) {
+	subscribers := make([]func(Change), 0, len(c.subscribers))
+	for _, fn := range c.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	return subscribers
+}
+
+func sameAddr(a, b ConnectedInstance) bool {
+	return a.IP == b.IP && a.Port == b.Port
+}
+
+func addr(i ConnectedInstance) string {
+	return net.JoinHostPort(i.IP, strconv.Itoa(i.Port))
+}
+
+func notify(subscribers []func(Change), change Change) {
+	for _, fn := range subscribers {
+		fn(change)
+	}
+}
@@ -0,0 +1,255 @@
+package registry
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestConnectionsConcurrentUse(t *testing.T) {
+	var c Connections
+	var changes atomic.Int64
+	unsubscribe := c.Subscribe(func(Change) { changes.Add(1) })
+	defer unsubscribe()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				instance := ConnectedInstance{ID: fmt.Sprint(g, i), IP: "127.0.0.1", Port: 9000 + g*1000 + i}
+				c.Offer("Logging", instance)
+				c.Get("Logging")
+				c.Snapshot()
+				c.Candidates("Logging")
+				c.Forget("Logging", instance)
+				c.Remove("Logging", instance)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if n := len(c.Candidates("Logging")); n != 0 {
+		t.Errorf("Candidates() has %d instances after every instance was forgotten", n)
+	}
+	if changes.Load() == 0 {
+		t.Error("subscriber was never called")
+	}
+}
+
+func TestConnectionsOffer(t *testing.T) {
+	first := ConnectedInstance{IP: "127.0.0.1", Port: 8081}
+	second := ConnectedInstance{IP: "127.0.0.1", Port: 8083}
+	draining := ConnectedInstance{IP: "127.0.0.1", Port: 8084, State: StateDraining}
+
+	tests := []struct {
+		name      string
+		offers    []ConnectedInstance
+		connected ConnectedInstance
+		ok        bool
+	}{
+		{"first active instance is connected", []ConnectedInstance{first, second}, first, true},
+		{"inactive instance is not connected", []ConnectedInstance{draining}, ConnectedInstance{}, false},
+		{"active instance after an inactive one", []ConnectedInstance{draining, second}, second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Connections
+			for _, instance := range tt.offers {
+				c.Offer("Logging", instance)
+			}
+			connected, ok := c.Get("Logging")
+			if ok != tt.ok || connected != tt.connected {
+				t.Errorf("Get() = %+v, %v; want %+v, %v", connected, ok, tt.connected, tt.ok)
+			}
+			if n := len(c.Candidates("Logging")); n != len(tt.offers) {
+				t.Errorf("Candidates() has %d instances, want %d", n, len(tt.offers))
+			}
+		})
+	}
+}
+
+func TestConnectionsOfferRefreshesConnected(t *testing.T) {
+	connected := ConnectedInstance{ID: "logging-1", IP: "127.0.0.1", Port: 8081, Version: "v1", Weight: 1}
+
+	tests := []struct {
+		name  string
+		offer ConnectedInstance
+		want  ConnectedInstance
+	}{
+		{
+			"same instance with a new version and weight",
+			ConnectedInstance{ID: "logging-1", IP: "127.0.0.1", Port: 8081, Version: "v2", Weight: 5},
+			ConnectedInstance{ID: "logging-1", IP: "127.0.0.1", Port: 8081, Version: "v2", Weight: 5},
+		},
+		{
+			"same instance now draining",
+			ConnectedInstance{ID: "logging-1", IP: "127.0.0.1", Port: 8081, Version: "v1", Weight: 1, State: StateDraining},
+			ConnectedInstance{ID: "logging-1", IP: "127.0.0.1", Port: 8081, Version: "v1", Weight: 1, State: StateDraining},
+		},
+		{
+			"another instance at the same address",
+			ConnectedInstance{ID: "logging-2", IP: "127.0.0.1", Port: 8081, Version: "v2", Weight: 5},
+			connected,
+		},
+		{
+			"same instance unchanged",
+			connected,
+			connected,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Connections
+			c.Offer("Logging", connected)
+			var changes []Change
+			unsubscribe := c.Subscribe(func(change Change) { changes = append(changes, change) })
+			defer unsubscribe()
+
+			if c.Offer("Logging", tt.offer) {
+				t.Error("Offer() connected an instance while one was connected")
+			}
+			if got, _ := c.Get("Logging"); got != tt.want {
+				t.Errorf("Get() = %+v, want %+v", got, tt.want)
+			}
+
+			// Subscribers hear about a refresh that changed the connected instance.
+			var want []Change
+			if tt.want != connected {
+				want = []Change{{ServiceType: "Logging", Instance: tt.want, Connected: true}}
+			}
+			if !reflect.DeepEqual(changes, want) {
+				t.Errorf("changes = %+v, want %+v", changes, want)
+			}
+		})
+	}
+}
+
+func TestConnectionsChooseUnderPolicy(t *testing.T) {
+	v1 := ConnectedInstance{IP: "127.0.0.1", Port: 8081, Version: "v1", Weight: 1}
+	v2 := ConnectedInstance{IP: "127.0.0.1", Port: 8082, Version: "v2", Weight: 1}
+	policy := TrafficPolicy{ServiceType: "Logging", Splits: map[string]int{"v2": 100}}
+
+	tests := []struct {
+		name    string
+		healthy map[ConnectedInstance]bool
+		want    ConnectedInstance
+	}{
+		{"unchecked candidate falls back to the connected instance", nil, v1},
+		{"healthy candidate is chosen", map[ConnectedInstance]bool{v2: true}, v2},
+		{"unhealthy candidate falls back to the connected instance", map[ConnectedInstance]bool{v2: false}, v1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Connections
+			c.Offer("Logging", v1)
+			c.Offer("Logging", v2)
+			c.SetPolicy(policy)
+			for instance, ok := range tt.healthy {
+				c.SetHealthy("Logging", instance, ok)
+			}
+			if got, _ := c.Choose("Logging"); got != tt.want {
+				t.Errorf("Choose() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnectionsRetain(t *testing.T) {
+	v1 := ConnectedInstance{IP: "127.0.0.1", Port: 8081, Version: "v1", Weight: 1}
+	v2 := ConnectedInstance{IP: "127.0.0.1", Port: 8082, Version: "v2", Weight: 1}
+
+	var c Connections
+	c.Offer("Logging", v1)
+	c.Offer("Logging", v2)
+	c.SetPolicy(TrafficPolicy{ServiceType: "Logging", Splits: map[string]int{"v2": 100}})
+	c.SetHealthy("Logging", v2, true)
+
+	gone := c.Retain("Logging", []ConnectedInstance{v1})
+	if len(gone) != 1 || gone[0] != v2 {
+		t.Fatalf("Retain() = %+v, want [%+v]", gone, v2)
+	}
+	if candidates := c.Candidates("Logging"); len(candidates) != 1 || candidates[0] != v1 {
+		t.Errorf("Candidates() = %+v, want [%+v]", candidates, v1)
+	}
+	if got, _ := c.Choose("Logging"); got != v1 {
+		t.Errorf("Choose() = %+v, want %+v", got, v1)
+	}
+
+	// A vanished instance that comes back must pass a health check again.
+	c.Offer("Logging", v2)
+	if got, _ := c.Choose("Logging"); got != v1 {
+		t.Errorf("Choose() after re-offer = %+v, want %+v", got, v1)
+	}
+}
+
+func TestSubscribersSeeChangesInOrder(t *testing.T) {
+	var c Connections
+	var delivered []Change
+	var inFlight atomic.Int32
+	unsubscribe := c.Subscribe(func(change Change) {
+		if inFlight.Add(1) != 1 {
+			t.Error("subscriber called concurrently")
+		}
+		delivered = append(delivered, change)
+		inFlight.Add(-1)
+	})
+	defer unsubscribe()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				instance := ConnectedInstance{ID: fmt.Sprint(g, i), IP: "127.0.0.1", Port: 9000 + g*1000 + i}
+				c.Set("Logging", instance)
+				if i%3 == 0 {
+					c.Remove("Logging", instance)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// Replaying the changes in delivery order must end in the current state.
+	var replayed ConnectedInstance
+	var connected bool
+	for _, change := range delivered {
+		replayed, connected = change.Instance, change.Connected
+	}
+	current, ok := c.Get("Logging")
+	if connected != ok || (ok && replayed != current) {
+		t.Errorf("last delivered change %+v (connected %v), but Get() = %+v, %v", replayed, connected, current, ok)
+	}
+}
+
+func TestSubscriberMayChangeConnections(t *testing.T) {
+	var c Connections
+	first := ConnectedInstance{ID: "logging-1", IP: "127.0.0.1", Port: 8081}
+	second := ConnectedInstance{ID: "logging-2", IP: "127.0.0.1", Port: 8082}
+
+	var delivered []string
+	unsubscribe := c.Subscribe(func(change Change) {
+		delivered = append(delivered, fmt.Sprintf("%s %v", change.Instance.ID, change.Connected))
+		// Fail over from the first instance as soon as it connects.
+		if change.Connected && change.Instance == first {
+			c.Remove("Logging", first)
+			c.Set("Logging", second)
+		}
+	})
+	defer unsubscribe()
+
+	c.Set("Logging", first)
+
+	want := []string{"logging-1 true", "logging-1 false", "logging-2 true"}
+	if fmt.Sprint(delivered) != fmt.Sprint(want) {
+		t.Errorf("delivered %v, want %v", delivered, want)
+	}
+	if current, _ := c.Get("Logging"); current != second {
+		t.Errorf("Get() = %+v, want %+v", current, second)
+	}
+}
@@ -0,0 +1,286 @@
+package registry
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Event types. Registrations never expire in this registry, so there is no
+// expiry event: an instance that stops answering shows up as a health event
+// and stays registered until it deregisters or an administrator removes it.
+const (
+	EventRegistered    = "register"
+	EventDeregistered  = "deregister"
+	EventUpdated       = "update"
+	EventHealthChanged = "health"
+	EventPolicyChanged = "policy"
+)
+
+// Event is a change to the registry.
+type Event struct {
+	ID          int64     `json:"id"`
+	Time        time.Time `json:"time"`
+	Type        string    `json:"type"`
+	ServiceID   string    `json:"serviceId,omitempty"`
+	ServiceType string    `json:"serviceType"`
+
+	// Actor is who made the change: the service type of an instance acting
+	// on itself, an administrator's policy identity or "health-checker".
+	Actor string `json:"actor,omitempty"`
+
+	// SourceIP is the address the change was requested from.
+	SourceIP string `json:"sourceIp,omitempty"`
+
+	// Before and After are the registration before and after the change,
+	// nil where it did not exist.
+	Before *Registration `json:"before,omitempty"`
+	After  *Registration `json:"after,omitempty"`
+
+	// PreviousPolicy and Policy are the traffic policy before and after a
+	// policy event, nil where there was none.
+	PreviousPolicy *TrafficPolicy `json:"previousPolicy,omitempty"`
+	Policy         *TrafficPolicy `json:"policy,omitempty"`
+
+	// PreviousHealth and Health are the health status before and after a
+	// health event. PreviousHealth is empty for an instance's first check.
+	PreviousHealth string `json:"previousHealth,omitempty"`
+	Health         string `json:"health,omitempty"`
+}
+
+// EventStream numbers published events, keeps the most recent ones and
+// delivers them to subscribers. With Path set, it also appends every event to
+// that file, which then holds the full history. The zero value is ready to
+// use without a file.
+type EventStream struct {
+	// Size is the number of recent events kept in memory. Defaults to 100.
+	Size int
+
+	// Path is the JSON lines file events are appended to. Open must be
+	// called before publishing.
+	Path string
+
+	mu     sync.Mutex
+	nextID int64
+	recent []Event
+	subs   map[chan Event]struct{}
+	closed bool
+	file   *os.File
+}
+
+// Open loads the history in Path, so numbering and the recent events
+// continue where the previous run stopped, and opens it for appending.
+func (s *EventStream) Open() error {
+	if s.Path == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.scan(func(e Event) bool {
+		s.nextID = e.ID
+		s.remember(e)
+		return true
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	file, err := os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	// A crash can leave a partial last line; start the next event on its own line.
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			file.Write([]byte("\n"))
+		}
+	}
+	s.file = file
+	return nil
+}
+
+// Publish stamps e with an ID and, unless set, the current time, records it
+// and delivers it to every subscriber. Subscribers that fall behind miss
+// events rather than block the registry.
+func (s *EventStream) Publish(e Event) Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	e.ID = s.nextID
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	if s.file != nil {
+		if data, err := json.Marshal(e); err != nil {
+			log.Println("Failed to encode event:", err)
+		} else if _, err := s.file.Write(append(data, '\n')); err != nil {
+			log.Println("Failed to write event log:", err)
+		}
+	}
+	s.remember(e)
+
+	for ch := range s.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+	return e
+}
+
+func (s *EventStream) remember(e Event) {
+	size := s.Size
+	if size <= 0 {
+		size = 100
+	}
+	s.recent = append(s.recent, e)
+	if len(s.recent) > size {
+		s.recent = s.recent[len(s.recent)-size:]
+	}
+}
+
+// Recent returns the most recent events, oldest first.
+func (s *EventStream) Recent() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Event(nil), s.recent...)
+}
+
+// EventFilter selects events. Zero fields match every event.
+type EventFilter struct {
+	// SinceID matches events after the one with this ID.
+	SinceID int64
+
+	// Since matches events at or after this time.
+	Since time.Time
+
+	// Type matches events of this type.
+	Type string
+
+	// Limit, when positive, is the most events to return. The oldest
+	// matching events are returned, so the next page starts after the ID of
+	// the last one.
+	Limit int
+}
+
+func (f EventFilter) matches(e Event) bool {
+	return e.ID > f.SinceID &&
+		!e.Time.Before(f.Since) &&
+		(f.Type == "" || e.Type == f.Type)
+}
+
+// Events returns the events matching f, oldest first: the full history with
+// Path set, otherwise the recent events. The file is read without holding
+// the lock, so publishing is not blocked by a long history; events published
+// meanwhile are left out.
+func (s *EventStream) Events(f EventFilter) ([]Event, error) {
+	events := []Event{}
+	full := func() bool { return f.Limit > 0 && len(events) >= f.Limit }
+
+	s.mu.Lock()
+	if s.file == nil {
+		for _, e := range s.recent {
+			if full() {
+				break
+			}
+			if f.matches(e) {
+				events = append(events, e)
+			}
+		}
+		s.mu.Unlock()
+		return events, nil
+	}
+	lastID := s.nextID
+	s.mu.Unlock()
+
+	err := s.scan(func(e Event) bool {
+		if e.ID > lastID {
+			return false
+		}
+		if f.matches(e) {
+			events = append(events, e)
+		}
+		return !full()
+	})
+	return events, err
+}
+
+// scan calls fn for every event in Path, skipping lines that do not decode,
+// until fn returns false. A last line without a newline is still being
+// written, or was cut short by a crash, and is skipped too.
+func (s *EventStream) scan(fn func(Event) bool) error {
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if len(data) > 1 {
+			var e Event
+			if err := json.Unmarshal(data, &e); err != nil {
+				log.Printf("Skipping invalid event on line %d of %s: %v", line, s.Path, err)
+			} else if !fn(e) {
+				return nil
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read event log: %w", err)
+		}
+	}
+}
+
+// Subscribe returns a channel receiving events published from now on and a
+// function that ends the subscription. The channel is closed when either is
+// called or the stream is closed.
+func (s *EventStream) Subscribe() (<-chan Event, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan Event, 64)
+	if s.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if s.subs == nil {
+		s.subs = make(map[chan Event]struct{})
+	}
+	s.subs[ch] = struct{}{}
+
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subs[ch]; ok {
+			delete(s.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close ends every subscription so long-lived streams finish, for example
+// before the server shuts down. Events are still recorded afterwards.
+func (s *EventStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for ch := range s.subs {
+		delete(s.subs, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,89 @@
+package registry
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestEventStreamEvents(t *testing.T) {
+	for _, withFile := range []bool{false, true} {
+		name := "memory"
+		if withFile {
+			name = "file"
+		}
+		t.Run(name, func(t *testing.T) {
+			s := &EventStream{}
+			if withFile {
+				s.Path = filepath.Join(t.TempDir(), "events.jsonl")
+				if err := s.Open(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < 5; i++ {
+				s.Publish(Event{Type: EventRegistered, ServiceType: "Logging"})
+				s.Publish(Event{Type: EventHealthChanged, ServiceType: "Logging"})
+			}
+
+			tests := []struct {
+				name   string
+				filter EventFilter
+				ids    []int64
+			}{
+				{"type", EventFilter{Type: EventHealthChanged}, []int64{2, 4, 6, 8, 10}},
+				{"limit", EventFilter{Limit: 3}, []int64{1, 2, 3}},
+				{"next page", EventFilter{SinceID: 3, Limit: 3}, []int64{4, 5, 6}},
+				{"type and limit", EventFilter{Type: EventRegistered, Limit: 2}, []int64{1, 3}},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					events, err := s.Events(tt.filter)
+					if err != nil {
+						t.Fatal(err)
+					}
+					var ids []int64
+					for _, e := range events {
+						ids = append(ids, e.ID)
+					}
+					if len(ids) != len(tt.ids) {
+						t.Fatalf("Events() IDs = %v, want %v", ids, tt.ids)
+					}
+					for i := range ids {
+						if ids[i] != tt.ids[i] {
+							t.Fatalf("Events() IDs = %v, want %v", ids, tt.ids)
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestEventStreamEventsWhilePublishing(t *testing.T) {
+	s := &EventStream{Path: filepath.Join(t.TempDir(), "events.jsonl")}
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			s.Publish(Event{Type: EventUpdated, ServiceType: "Logging"})
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		events, err := s.Events(EventFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j, e := range events {
+			if e.ID != int64(j+1) {
+				t.Fatalf("event %d has ID %d, want %d", j, e.ID, j+1)
+			}
+		}
+	}
+	wg.Wait()
+}
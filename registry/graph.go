@@ -0,0 +1,194 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// GraphNode is a service type in the dependency graph.
+type GraphNode struct {
+	ServiceType string `json:"serviceType"`
+
+	// Instances is the number of registered instances of the type.
+	Instances int `json:"instances"`
+
+	// Requires lists the service types any instance of the type requires.
+	Requires []string `json:"requires"`
+
+	// Unsatisfied lists the required service types without any instance.
+	Unsatisfied []string `json:"unsatisfied,omitempty"`
+}
+
+// Graph is the service-type dependency graph of the registered services.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+
+	// Cycles lists each group of service types that depend on each other.
+	Cycles [][]string `json:"cycles,omitempty"`
+}
+
+// BuildGraph builds the dependency graph of services. Required types without
+// any registration appear as nodes with no instances.
+func BuildGraph(services []Registration) Graph {
+	instances := make(map[string]int)
+	requires := make(map[string]map[string]bool)
+
+	addType := func(serviceType string) {
+		if requires[serviceType] == nil {
+			requires[serviceType] = make(map[string]bool)
+		}
+	}
+	for _, s := range services {
+		addType(s.ServiceType)
+		instances[s.ServiceType]++
+		for _, required := range s.RequiredServices {
+			addType(required)
+			requires[s.ServiceType][required] = true
+		}
+	}
+
+	types := make([]string, 0, len(requires))
+	for serviceType := range requires {
+		types = append(types, serviceType)
+	}
+	sort.Strings(types)
+
+	var g Graph
+	edges := make(map[string][]string, len(types))
+	for _, serviceType := range types {
+		node := GraphNode{ServiceType: serviceType, Instances: instances[serviceType], Requires: []string{}}
+		for required := range requires[serviceType] {
+			node.Requires = append(node.Requires, required)
+		}
+		sort.Strings(node.Requires)
+		for _, required := range node.Requires {
+			if instances[required] == 0 {
+				node.Unsatisfied = append(node.Unsatisfied, required)
+			}
+		}
+		edges[serviceType] = node.Requires
+		g.Nodes = append(g.Nodes, node)
+	}
+	g.Cycles = findCycles(types, edges)
+
+	return g
+}
+
+// CyclesWith returns the cycles that include serviceType.
+func (g Graph) CyclesWith(serviceType string) [][]string {
+	var cycles [][]string
+	for _, cycle := range g.Cycles {
+		for _, t := range cycle {
+			if t == serviceType {
+				cycles = append(cycles, cycle)
+				break
+			}
+		}
+	}
+	return cycles
+}
+
+// DOT renders the graph in Graphviz DOT. Types without instances and the
+// edges to them are drawn red and dashed.
+func (g Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph services {\n\trankdir=LR;\n\tnode [shape=box];\n")
+
+	inCycle := make(map[string]bool)
+	for _, cycle := range g.Cycles {
+		for _, t := range cycle {
+			inCycle[t] = true
+		}
+	}
+
+	for _, n := range g.Nodes {
+		attrs := fmt.Sprintf("label=%q", fmt.Sprintf("%s\n%d instance(s)", n.ServiceType, n.Instances))
+		if n.Instances == 0 {
+			attrs += ", color=red, style=dashed"
+		} else if inCycle[n.ServiceType] {
+			attrs += ", color=orange"
+		}
+		fmt.Fprintf(&b, "\t%q [%s];\n", n.ServiceType, attrs)
+	}
+
+	for _, n := range g.Nodes {
+		unsatisfied := make(map[string]bool, len(n.Unsatisfied))
+		for _, t := range n.Unsatisfied {
+			unsatisfied[t] = true
+		}
+		for _, required := range n.Requires {
+			if unsatisfied[required] {
+				fmt.Fprintf(&b, "\t%q -> %q [color=red, style=dashed];\n", n.ServiceType, required)
+			} else {
+				fmt.Fprintf(&b, "\t%q -> %q;\n", n.ServiceType, required)
+			}
+		}
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// findCycles returns the strongly connected components of the graph that
+// contain a cycle, using Tarjan's algorithm.
+func findCycles(types []string, edges map[string][]string) [][]string {
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var cycles [][]string
+	next := 0
+
+	var visit func(v string)
+	visit = func(v string) {
+		index[v], low[v] = next, next
+		next++
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, w := range edges[v] {
+			if _, seen := index[w]; !seen {
+				visit(w)
+				low[v] = min(low[v], low[w])
+			} else if onStack[w] {
+				low[v] = min(low[v], index[w])
+			}
+		}
+
+		if low[v] != index[v] {
+			return
+		}
+		var component []string
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			component = append(component, w)
+			if w == v {
+				break
+			}
+		}
+		if len(component) > 1 || requiresItself(v, edges) {
+			sort.Strings(component)
+			cycles = append(cycles, component)
+		}
+	}
+
+	for _, t := range types {
+		if _, seen := index[t]; !seen {
+			visit(t)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return cycles
+}
+
+func requiresItself(serviceType string, edges map[string][]string) bool {
+	for _, required := range edges[serviceType] {
+		if required == serviceType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+)
+
+func service(serviceType string, requires ...string) Registration {
+	return Registration{ID: serviceType, ServiceType: serviceType, RequiredServices: requires}
+}
+
+func TestBuildGraphCycles(t *testing.T) {
+	tests := []struct {
+		name     string
+		services []Registration
+		cycles   [][]string
+	}{
+		{
+			"acyclic chain",
+			[]Registration{service("A", "B"), service("B", "C"), service("C")},
+			nil,
+		},
+		{
+			"self-loop",
+			[]Registration{service("A", "A"), service("B", "A")},
+			[][]string{{"A"}},
+		},
+		{
+			"2-cycle",
+			[]Registration{service("A", "B"), service("B", "A"), service("C", "A")},
+			[][]string{{"A", "B"}},
+		},
+		{
+			"3-cycle",
+			[]Registration{service("C", "A"), service("A", "B"), service("B", "C"), service("D", "B")},
+			[][]string{{"A", "B", "C"}},
+		},
+		{
+			"separate cycles",
+			[]Registration{service("A", "B"), service("B", "A"), service("X", "Y"), service("Y", "X")},
+			[][]string{{"A", "B"}, {"X", "Y"}},
+		},
+		{
+			"unregistered dependency",
+			[]Registration{service("A", "Missing")},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := BuildGraph(tt.services)
+			if !reflect.DeepEqual(g.Cycles, tt.cycles) {
+				t.Errorf("Cycles = %v, want %v", g.Cycles, tt.cycles)
+			}
+		})
+	}
+}
+
+func TestBuildGraphUnregisteredDependency(t *testing.T) {
+	g := BuildGraph([]Registration{service("A", "Missing", "B"), service("B")})
+
+	want := []GraphNode{
+		{ServiceType: "A", Instances: 1, Requires: []string{"B", "Missing"}, Unsatisfied: []string{"Missing"}},
+		{ServiceType: "B", Instances: 1, Requires: []string{}},
+		{ServiceType: "Missing", Instances: 0, Requires: []string{}},
+	}
+	if !reflect.DeepEqual(g.Nodes, want) {
+		t.Errorf("Nodes = %+v, want %+v", g.Nodes, want)
+	}
+}
+
+func TestCyclesWith(t *testing.T) {
+	g := BuildGraph([]Registration{service("A", "B"), service("B", "A"), service("C", "C"), service("D", "A")})
+
+	tests := []struct {
+		serviceType string
+		want        [][]string
+	}{
+		{"A", [][]string{{"A", "B"}}},
+		{"C", [][]string{{"C"}}},
+		{"D", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.serviceType, func(t *testing.T) {
+			if got := g.CyclesWith(tt.serviceType); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CyclesWith(%q) = %v, want %v", tt.serviceType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphDOT(t *testing.T) {
+	services := []Registration{service("Business", "Logging", "Cache"), service("Logging", "Business")}
+
+	want := `digraph services {
+	rankdir=LR;
+	node [shape=box];
+	"Business" [label="Business\n1 instance(s)", color=orange];
+	"Cache" [label="Cache\n0 instance(s)", color=red, style=dashed];
+	"Logging" [label="Logging\n1 instance(s)", color=orange];
+	"Business" -> "Cache" [color=red, style=dashed];
+	"Business" -> "Logging";
+	"Logging" -> "Business";
+}
+`
+	for i := 0; i < 10; i++ {
+		if got := BuildGraph(services).DOT(); got != want {
+			t.Fatalf("DOT() =\n%s\nwant\n%s", got, want)
+		}
+	}
+}
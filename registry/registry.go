@@ -2,6 +2,8 @@ package registry
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 	"sync"
 )
 
@@ -10,6 +12,50 @@ type ConnectedInstance struct {
 	ID   string `json:"int"`
 	IP   string `json:"ip"`
 	Port int    `json:"port"`
+
+	// Scheme is "https" when the instance serves TLS, otherwise "http".
+	Scheme string `json:"scheme,omitempty"`
+
+	HealthCheckEndpoint string `json:"healthcheckEndpoint,omitempty"`
+
+	// State is the instance's state; empty means active.
+	State string `json:"state,omitempty"`
+
+	// Version and Weight select the instance under a traffic policy.
+	Version string `json:"version,omitempty"`
+	Weight  int    `json:"weight,omitempty"`
+}
+
+// Active reports whether the instance takes new requests.
+func (i ConnectedInstance) Active() bool {
+	return i.State == "" || i.State == StateActive
+}
+
+// URL returns the URL of path on the instance.
+func (i ConnectedInstance) URL(path string) string {
+	scheme := i.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s:%d%s", scheme, i.IP, i.Port, path)
+}
+
+// Instance states. Only active instances take new requests; draining
+// instances finish the requests they have before they leave, and instances in
+// maintenance stay registered without traffic.
+const (
+	StateActive      = "active"
+	StateDraining    = "draining"
+	StateMaintenance = "maintenance"
+)
+
+// ValidState reports whether state is one of the instance states.
+func ValidState(state string) bool {
+	switch state {
+	case StateActive, StateDraining, StateMaintenance:
+		return true
+	}
+	return false
 }
 
 // ConnectedInstance represents a specific instance of a connected service.
@@ -25,14 +71,87 @@ type Registration struct {
 	ConnectedInstances   ConnectedInstances `json:"connectedInstances"`
 	NotificationEndpoint string             `json:"notificationEndpoint"`
 	HealthCheckEndpoint  string             `json:"healthcheckEndpoint"`
+	Scheme               string             `json:"scheme,omitempty"`
+
+	// Tags are free-form labels, such as a region or "canary", used to
+	// filter services.
+	Tags []string `json:"tags,omitempty"`
+
+	// State is the instance's state; the registrar starts every instance
+	// as active.
+	State string `json:"state,omitempty"`
+
+	// Version is the version of the service the instance runs, which traffic
+	// policies split requests by.
+	Version string `json:"version,omitempty"`
+
+	// Weight is the instance's share of the requests to its version,
+	// relative to the other instances of that version. Zero counts as 1.
+	Weight int `json:"weight,omitempty"`
+}
+
+// Instance returns the registration as an instance dependents connect to.
+func (r Registration) Instance() ConnectedInstance {
+	return ConnectedInstance{
+		ID:                  r.ID,
+		IP:                  r.IP,
+		Port:                r.Port,
+		Scheme:              r.Scheme,
+		HealthCheckEndpoint: r.HealthCheckEndpoint,
+		State:               r.State,
+		Version:             r.Version,
+		Weight:              r.Weight,
+	}
 }
 
+// HasTag reports whether the registration is labeled with tag.
+func (r Registration) HasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTags splits a comma-separated list of tags, dropping empty ones.
+func ParseTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// RegistrationResponse is returned to a service that registered. The
+// InstanceToken authenticates later requests made on behalf of that instance,
+// such as deregistration.
+type RegistrationResponse struct {
+	Registration
+	InstanceToken string `json:"instanceToken"`
+
+	// Warnings reports problems with the registration that did not prevent
+	// it, such as dependency cycles.
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Policies are the traffic policies of the service types the instance
+	// requires; later changes arrive as notifications.
+	Policies []TrafficPolicy `json:"policies,omitempty"`
+}
+
+// ErrAlreadyRegistered is returned by PostService when the registration's ID
+// or its type, IP and port are taken by a registered instance.
+var ErrAlreadyRegistered = errors.New("service already registered")
+
 type ServiceRegistry interface {
 	GetServices() ([]Registration, error)
 	GetServicesByType(name string) ([]Registration, error)
 	GetServiceByID(id string) (*Registration, error)
 	GetDependentServices(serviceName string) ([]Registration, error)
 	PostService(r *Registration) (*Registration, error)
+	SetServiceState(id, state string) (*Registration, error)
 	DeleteService(serviceName string) error
 }
 
@@ -41,37 +160,92 @@ type InMemoryServiceRegistry struct {
 	services []Registration
 }
 
+type ComponentHealth struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// HealthCheckResult is the health a service reports on /healthcheck.
+type HealthCheckResult struct {
+	ServiceID   string            `json:"service_id"`
+	ServiceType string            `json:"service_type"`
+	Healthy     bool              `json:"healthy"`
+	Status      string            `json:"status,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	Components  []ComponentHealth `json:"components,omitempty"`
+}
+
+// StateUpdate is the body of a request setting an instance's state.
+type StateUpdate struct {
+	State string `json:"state"`
+}
+
 type NotificationPayload struct {
 	Action       string `json:"action"`
 	Registration Registration
+
+	// Policy is the new traffic policy of a "policy" notification.
+	Policy *TrafficPolicy `json:"policy,omitempty"`
 }
 
+// GetServices returns a copy of the registered services, which callers may
+// read while the registry changes.
 func (r *InMemoryServiceRegistry) GetServices() ([]Registration, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	return r.services, nil
+	return append([]Registration(nil), r.services...), nil
 }
 
 func (r *InMemoryServiceRegistry) PostService(registration *Registration) (*Registration, error) {
-	if registration == nil || registration.ServiceType == "" {
+	if registration == nil || registration.ServiceType == "" || registration.ID == "" {
 		return nil, errors.New("invalid registration")
 	}
+	if registration.Weight < 0 {
+		return nil, errors.New("invalid registration: negative weight")
+	}
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	for _, existingService := range r.services {
+		// The instance token is issued per ID, so a reused ID would take over
+		// the registered instance.
+		if existingService.ID == registration.ID {
+			return nil, fmt.Errorf("%w with the same ID", ErrAlreadyRegistered)
+		}
 		if existingService.ServiceType == registration.ServiceType &&
 			existingService.IP == registration.IP &&
 			existingService.Port == registration.Port {
-			return nil, errors.New("service already registered with the same type, IP, and port")
+			return nil, fmt.Errorf("%w with the same type, IP, and port", ErrAlreadyRegistered)
 		}
 	}
 
+	registration.State = StateActive
 	r.services = append(r.services, *registration)
 	return registration, nil
 }
 
+// SetServiceState sets the state of the service with the given ID and
+// returns the updated registration.
+func (r *InMemoryServiceRegistry) SetServiceState(id, state string) (*Registration, error) {
+	if !ValidState(state) {
+		return nil, fmt.Errorf("invalid state %q", state)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.services {
+		if r.services[i].ID == id {
+			r.services[i].State = state
+			updated := r.services[i]
+			return &updated, nil
+		}
+	}
+	return nil, errors.New("id not found")
+}
+
 func (r *InMemoryServiceRegistry) DeleteService(serviceID string) error {
 	if serviceID == "" {
 		return errors.New("invalid service ID")
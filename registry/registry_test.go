@@ -0,0 +1,77 @@
+package registry
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPostServiceRejectsDuplicateID(t *testing.T) {
+	r := &InMemoryServiceRegistry{}
+	if _, err := r.PostService(&Registration{ID: "a", ServiceType: "Logging", IP: "127.0.0.1", Port: 8081}); err != nil {
+		t.Fatalf("first registration: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		registration Registration
+		wantErr      bool
+		conflict     bool
+	}{
+		{"same ID on another port", Registration{ID: "a", ServiceType: "Logging", IP: "127.0.0.1", Port: 9999}, true, true},
+		{"same ID as another type", Registration{ID: "a", ServiceType: "Business", IP: "127.0.0.1", Port: 8082}, true, true},
+		{"same type, IP and port", Registration{ID: "b", ServiceType: "Logging", IP: "127.0.0.1", Port: 8081}, true, true},
+		{"empty ID", Registration{ServiceType: "Logging", IP: "127.0.0.1", Port: 8083}, true, false},
+		{"new ID", Registration{ID: "c", ServiceType: "Logging", IP: "127.0.0.1", Port: 8083}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registration := tt.registration
+			_, err := r.PostService(&registration)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PostService() error = %v, want error %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrAlreadyRegistered) != tt.conflict {
+				t.Errorf("PostService() error = %v, want ErrAlreadyRegistered %v", err, tt.conflict)
+			}
+		})
+	}
+
+	original, err := r.GetServiceByID("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if original.Port != 8081 || original.ServiceType != "Logging" {
+		t.Errorf("registration a was replaced: %+v", original)
+	}
+}
+
+func TestGetServicesWhileStateChanges(t *testing.T) {
+	r := &InMemoryServiceRegistry{}
+	for _, id := range []string{"a", "b", "c"} {
+		if _, err := r.PostService(&Registration{ID: id, ServiceType: "Logging", Port: len(r.services)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			r.SetServiceState("a", StateDraining)
+			r.SetServiceState("a", StateActive)
+		}
+		r.DeleteService("a")
+	}()
+
+	services, _ := r.GetServices()
+	for i := 0; i < 1000; i++ {
+		for _, s := range services {
+			_ = s.State
+		}
+	}
+	<-done
+
+	if len(services) != 3 || services[0].ID != "a" || services[2].ID != "c" {
+		t.Errorf("snapshot changed after DeleteService: %+v", services)
+	}
+}
@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// TrafficPolicy splits the requests to a service type between its versions,
+// e.g. 95% to "v1" and 5% to the canary "v2".
+type TrafficPolicy struct {
+	ServiceType string `json:"serviceType"`
+
+	// Splits maps versions to the percentage of requests they receive. The
+	// percentages add up to 100. A policy without splits removes the policy.
+	Splits map[string]int `json:"splits"`
+}
+
+// Validate checks that the splits are percentages adding up to 100.
+func (p TrafficPolicy) Validate() error {
+	if p.ServiceType == "" {
+		return errors.New("missing service type")
+	}
+	if len(p.Splits) == 0 {
+		return errors.New("missing splits")
+	}
+
+	total := 0
+	for version, percent := range p.Splits {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("split of version %q must be between 0 and 100", version)
+		}
+		total += percent
+	}
+	if total != 100 {
+		return fmt.Errorf("splits add up to %d, not 100", total)
+	}
+	return nil
+}
+
+// TrafficPolicies holds the traffic policy of each service type. It is safe
+// for concurrent use; the zero value is empty and ready to use.
+type TrafficPolicies struct {
+	mu       sync.RWMutex
+	policies map[string]TrafficPolicy
+}
+
+// Get returns the policy of serviceType.
+func (tp *TrafficPolicies) Get(serviceType string) (TrafficPolicy, bool) {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	p, ok := tp.policies[serviceType]
+	return p, ok
+}
+
+// Set stores p as the policy of its service type and returns the policy it
+// replaced, if any. A policy without splits removes the current one.
+func (tp *TrafficPolicies) Set(p TrafficPolicy) (TrafficPolicy, bool) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	previous, ok := tp.policies[p.ServiceType]
+	if len(p.Splits) == 0 {
+		delete(tp.policies, p.ServiceType)
+		return previous, ok
+	}
+	if tp.policies == nil {
+		tp.policies = make(map[string]TrafficPolicy)
+	}
+	tp.policies[p.ServiceType] = p
+	return previous, ok
+}
+
+// List returns every policy, sorted by service type.
+func (tp *TrafficPolicies) List() []TrafficPolicy {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	list := make([]TrafficPolicy, 0, len(tp.policies))
+	for _, p := range tp.policies {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ServiceType < list[j].ServiceType })
+	return list
+}
@@ -0,0 +1,188 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned without calling the dependency while its breaker is open.
+var ErrOpen = errors.New("circuit breaker open")
+
+// State is the state of a Breaker.
+type State int
+
+const (
+	// StateClosed lets every call through.
+	StateClosed State = iota
+	// StateHalfOpen lets a single probe through to test recovery.
+	StateHalfOpen
+	// StateOpen rejects calls until OpenTimeout has passed.
+	StateOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breaker stops calls to a failing dependency. It opens after
+// FailureThreshold consecutive failures, rejects calls for OpenTimeout, then
+// lets one probe through: success closes it again, failure reopens it.
+type Breaker struct {
+	// FailureThreshold is the number of consecutive failures that open the
+	// breaker. Defaults to 5.
+	FailureThreshold int
+
+	// OpenTimeout is how long the breaker stays open. Defaults to 10s.
+	OpenTimeout time.Duration
+
+	// OnStateChange, when set, is called after every transition.
+	OnStateChange func(from, to State)
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// Allow reports whether a call may proceed. If it may, done must be called
+// with the call's error once it finishes.
+func (b *Breaker) Allow() (done func(error), err error) {
+	b.mu.Lock()
+	from := b.state
+
+	if b.state == StateOpen {
+		if time.Since(b.openedAt) < b.openTimeout() {
+			b.mu.Unlock()
+			return nil, ErrOpen
+		}
+		b.state = StateHalfOpen
+	}
+
+	probe := false
+	if b.state == StateHalfOpen {
+		if b.probing {
+			b.mu.Unlock()
+			b.notify(from, b.State())
+			return nil, ErrOpen
+		}
+		b.probing = true
+		probe = true
+	}
+	to := b.state
+	b.mu.Unlock()
+
+	b.notify(from, to)
+	return func(err error) { b.record(err, probe) }, nil
+}
+
+// State returns the breaker's current state.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *Breaker) record(err error, probe bool) {
+	b.mu.Lock()
+	from := b.state
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		// The caller gave up; this says nothing about the dependency.
+	case err == nil:
+		b.failures = 0
+		if probe {
+			b.state = StateClosed
+		}
+	default:
+		b.failures++
+		if probe || b.failures >= b.failureThreshold() {
+			b.state = StateOpen
+			b.openedAt = time.Now()
+		}
+	}
+	if probe {
+		b.probing = false
+	}
+	to := b.state
+	b.mu.Unlock()
+
+	b.notify(from, to)
+}
+
+func (b *Breaker) notify(from, to State) {
+	if from != to && b.OnStateChange != nil {
+		b.OnStateChange(from, to)
+	}
+}
+
+func (b *Breaker) failureThreshold() int {
+	if b.FailureThreshold <= 0 {
+		return 5
+	}
+	return b.FailureThreshold
+}
+
+func (b *Breaker) openTimeout() time.Duration {
+	if b.OpenTimeout <= 0 {
+		return 10 * time.Second
+	}
+	return b.OpenTimeout
+}
+
+// Breakers keeps one Breaker per dependency instance.
+type Breakers struct {
+	// New creates the breaker for key. Nil uses a Breaker with default settings.
+	New func(key string) *Breaker
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+// Get returns the breaker for key, creating it on first use.
+func (bs *Breakers) Get(key string) *Breaker {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if bs.breakers == nil {
+		bs.breakers = make(map[string]*Breaker)
+	}
+	b, ok := bs.breakers[key]
+	if !ok {
+		if bs.New != nil {
+			b = bs.New(key)
+		} else {
+			b = &Breaker{}
+		}
+		bs.breakers[key] = b
+	}
+	return b
+}
+
+// States returns the state of every breaker, keyed by dependency instance.
+func (bs *Breakers) States() map[string]State {
+	bs.mu.Lock()
+	breakers := make(map[string]*Breaker, len(bs.breakers))
+	for key, b := range bs.breakers {
+		breakers[key] = b
+	}
+	bs.mu.Unlock()
+
+	states := make(map[string]State, len(breakers))
+	for key, b := range breakers {
+		states[key] = b.State()
+	}
+	return states
+}
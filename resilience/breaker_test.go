@@ -0,0 +1,94 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errDependency = errors.New("dependency failed")
+
+func TestBreakerTransitions(t *testing.T) {
+	var transitions []string
+	b := &Breaker{
+		FailureThreshold: 2,
+		OpenTimeout:      20 * time.Millisecond,
+		OnStateChange: func(from, to State) {
+			transitions = append(transitions, from.String()+" -> "+to.String())
+		},
+	}
+	call := func(err error) error {
+		done, allowErr := b.Allow()
+		if allowErr != nil {
+			return allowErr
+		}
+		done(err)
+		return nil
+	}
+
+	// Failures below the threshold and cancelled calls keep it closed.
+	call(errDependency)
+	call(context.Canceled)
+	if b.State() != StateClosed {
+		t.Fatalf("state = %s after one failure, want closed", b.State())
+	}
+	call(errDependency)
+	if b.State() != StateOpen {
+		t.Fatalf("state = %s after reaching the threshold, want open", b.State())
+	}
+	if err := call(nil); !errors.Is(err, ErrOpen) {
+		t.Fatalf("call while open = %v, want ErrOpen", err)
+	}
+
+	// After OpenTimeout a single probe is let through; a failed probe reopens.
+	time.Sleep(30 * time.Millisecond)
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatalf("probe rejected: %v", err)
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("second call while probing = %v, want ErrOpen", err)
+	}
+	done(errDependency)
+	if b.State() != StateOpen {
+		t.Fatalf("state = %s after a failed probe, want open", b.State())
+	}
+
+	// A successful probe closes it.
+	time.Sleep(30 * time.Millisecond)
+	if err := call(nil); err != nil {
+		t.Fatalf("probe rejected: %v", err)
+	}
+	if b.State() != StateClosed {
+		t.Fatalf("state = %s after a successful probe, want closed", b.State())
+	}
+
+	want := []string{
+		"closed -> open",
+		"open -> half-open", "half-open -> open",
+		"open -> half-open", "half-open -> closed",
+	}
+	if len(transitions) != len(want) {
+		t.Fatalf("transitions = %v, want %v", transitions, want)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Fatalf("transitions = %v, want %v", transitions, want)
+		}
+	}
+}
+
+func TestBreakersPerInstance(t *testing.T) {
+	bs := &Breakers{New: func(string) *Breaker { return &Breaker{FailureThreshold: 1} }}
+	done, _ := bs.Get("127.0.0.1:8081").Allow()
+	done(errDependency)
+
+	states := bs.States()
+	if states["127.0.0.1:8081"] != StateOpen {
+		t.Errorf("failing instance is %s, want open", states["127.0.0.1:8081"])
+	}
+	if bs.Get("127.0.0.1:8083").State() != StateClosed {
+		t.Error("other instance is not closed")
+	}
+}
@@ -0,0 +1,119 @@
+package resilience
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// StatusError reports a response whose status code is worth retrying.
+type StatusError struct {
+	StatusCode int
+
+	// RetryAfter is the wait requested by a 429 or 503 response's
+	// Retry-After header, if it had one.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("retryable status code: %d", e.StatusCode)
+}
+
+// Transport applies a Policy to every request, keyed by the request's host.
+// GET, HEAD and OPTIONS requests are retried and hedged; other methods only
+// when the policy allows retrying non-idempotent calls. Responses with status
+// 429, 502, 503 or 504 count as failures and are retried; if retries run out
+// the last such response is returned. A retry after a 429 or 503 response
+// with Retry-After waits at least that long, or is not made when the wait
+// exceeds Policy.MaxRetryAfter or the request's deadline.
+type Transport struct {
+	Policy *Policy
+
+	// Base performs the request. Nil uses http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// Buffer the body so every attempt can send it.
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := Do(req.Context(), t.Policy, req.URL.Host, idempotent(req.Method), func(ctx context.Context) (*http.Response, error) {
+		attempt := req.Clone(ctx)
+		if body != nil {
+			attempt.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		resp, err := base.RoundTrip(attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		// Read the response before the attempt's context is cancelled.
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return resp, &StatusError{StatusCode: resp.StatusCode, RetryAfter: retryAfter(resp.Header.Get("Retry-After"), time.Now())}
+		case http.StatusBadGateway, http.StatusGatewayTimeout:
+			return resp, &StatusError{StatusCode: resp.StatusCode}
+		}
+		return resp, nil
+	})
+
+	if _, ok := err.(*StatusError); ok && resp != nil {
+		return resp, nil
+	}
+	return resp, err
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+// It returns zero when the header is absent, invalid or in the past.
+func retryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return max(0, time.Duration(seconds)*time.Second)
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return max(0, date.Sub(now))
+	}
+	return 0
+}
+
+// Client returns a copy of base whose requests go through p.
+func (p *Policy) Client(base *http.Client) *http.Client {
+	c := *base
+	c.Transport = &Transport{Policy: p, Base: base.Transport}
+	return &c
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package resilience
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTransportRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		deadline   time.Duration
+		calls      int32
+		wait       time.Duration
+		want       int
+	}{
+		{"waits for Retry-After", http.StatusTooManyRequests, "1", 0, 2, time.Second, http.StatusOK},
+		{"wait within the deadline", http.StatusServiceUnavailable, "1", 5 * time.Second, 2, time.Second, http.StatusOK},
+		{"wait past the deadline", http.StatusServiceUnavailable, "1", 500 * time.Millisecond, 1, 0, http.StatusServiceUnavailable},
+		{"wait past MaxRetryAfter", http.StatusServiceUnavailable, "5", 0, 1, 0, http.StatusServiceUnavailable},
+		{"without Retry-After", http.StatusServiceUnavailable, "", 0, 2, 0, http.StatusOK},
+		{"ignored on 502", http.StatusBadGateway, "5", 0, 2, 0, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) == 1 {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					w.WriteHeader(tt.status)
+				}
+			}))
+			defer ts.Close()
+
+			ctx := context.Background()
+			if tt.deadline > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.deadline)
+				defer cancel()
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := (&Policy{MaxAttempts: 3}).Client(http.DefaultClient)
+
+			start := time.Now()
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			elapsed := time.Since(start)
+
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if got := calls.Load(); got != tt.calls {
+				t.Errorf("server called %d times, want %d", got, tt.calls)
+			}
+			if elapsed < tt.wait {
+				t.Errorf("retried after %s, want at least %s", elapsed, tt.wait)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{"-3", 0},
+		{"soon", 0},
+		{now.Add(10 * time.Second).Format(http.TimeFormat), 10 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := retryAfter(tt.header, now); got != tt.want {
+				t.Errorf("retryAfter(%q) = %s, want %s", tt.header, got, tt.want)
+			}
+		})
+	}
+}
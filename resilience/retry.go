@@ -0,0 +1,263 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RetryBudget caps retries to a fraction of traffic so retries cannot
+// multiply the load on a struggling dependency. Every failed attempt costs a
+// token and every success earns Ratio tokens; retries are only allowed while
+// more than half of MaxTokens remain.
+type RetryBudget struct {
+	// MaxTokens defaults to 10.
+	MaxTokens float64
+
+	// Ratio defaults to 0.1, allowing roughly one retry per ten successes
+	// once the budget is drained.
+	Ratio float64
+
+	mu      sync.Mutex
+	tokens  float64
+	started bool
+}
+
+// CanRetry reports whether the budget allows another retry.
+func (rb *RetryBudget) CanRetry() bool {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.init()
+	return rb.tokens > rb.maxTokens()/2
+}
+
+func (rb *RetryBudget) onSuccess() {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.init()
+
+	ratio := rb.Ratio
+	if ratio <= 0 {
+		ratio = 0.1
+	}
+	rb.tokens = min(rb.maxTokens(), rb.tokens+ratio)
+}
+
+func (rb *RetryBudget) onFailure() {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.init()
+	rb.tokens = max(0, rb.tokens-1)
+}
+
+func (rb *RetryBudget) init() {
+	if !rb.started {
+		rb.tokens = rb.maxTokens()
+		rb.started = true
+	}
+}
+
+func (rb *RetryBudget) maxTokens() float64 {
+	if rb.MaxTokens <= 0 {
+		return 10
+	}
+	return rb.MaxTokens
+}
+
+// Policy describes how calls to a dependency are made. The zero Policy makes
+// a single attempt without timeout.
+type Policy struct {
+	// Timeout bounds each attempt. Zero relies on the caller's context.
+	Timeout time.Duration
+
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+
+	// Backoff is the base delay before a retry; it doubles with every retry
+	// and is jittered.
+	Backoff time.Duration
+
+	// Budget, when set, limits retries across all calls using the policy.
+	Budget *RetryBudget
+
+	// HedgeDelay, when positive, starts a second concurrent attempt if the
+	// first has not finished after this long, and takes whichever succeeds
+	// first. Only calls marked idempotent are hedged.
+	HedgeDelay time.Duration
+
+	// Breakers, when set, guards each dependency instance with a Breaker.
+	Breakers *Breakers
+
+	// RetryNonIdempotent allows retrying calls that are not idempotent, for
+	// dependencies where a duplicate is better than a lost call.
+	RetryNonIdempotent bool
+
+	// MaxRetryAfter is the longest wait a StatusError's RetryAfter may ask
+	// for before a retry; longer waits end the call instead. It defaults to
+	// one second.
+	MaxRetryAfter time.Duration
+}
+
+func (p *Policy) maxRetryAfter() time.Duration {
+	if p.MaxRetryAfter <= 0 {
+		return time.Second
+	}
+	return p.MaxRetryAfter
+}
+
+// Do calls call under p for the dependency instance key. Failed attempts are
+// retried while attempts and budget remain, unless the breaker is open or ctx
+// is done. A StatusError with RetryAfter delays the retry at least that long;
+// when the wait exceeds MaxRetryAfter or ctx's deadline, no retry is made.
+// The result of the last attempt is returned alongside its error.
+func Do[T any](ctx context.Context, p *Policy, key string, idempotent bool, call func(context.Context) (T, error)) (T, error) {
+	var breaker *Breaker
+	if p.Breakers != nil {
+		breaker = p.Breakers.Get(key)
+	}
+
+	attempts := max(p.MaxAttempts, 1)
+	if !idempotent && !p.RetryNonIdempotent {
+		attempts = 1
+	}
+
+	var result T
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			if p.Budget != nil && !p.Budget.CanRetry() {
+				break
+			}
+			delay := backoff(p.Backoff, i)
+			if wait := requestedWait(err); wait > 0 {
+				if wait > p.maxRetryAfter() || !fitsDeadline(ctx, wait) {
+					break
+				}
+				delay = max(delay, wait)
+			}
+			if err := sleep(ctx, delay); err != nil {
+				return result, err
+			}
+		}
+
+		result, err = hedged(ctx, p, breaker, idempotent, call)
+		if err == nil {
+			if p.Budget != nil {
+				p.Budget.onSuccess()
+			}
+			return result, nil
+		}
+		if p.Budget != nil {
+			p.Budget.onFailure()
+		}
+		if errors.Is(err, ErrOpen) || ctx.Err() != nil {
+			break
+		}
+	}
+	return result, err
+}
+
+// hedged makes one attempt, racing it against a second one when it is slow.
+func hedged[T any](ctx context.Context, p *Policy, breaker *Breaker, idempotent bool, call func(context.Context) (T, error)) (T, error) {
+	if !idempotent || p.HedgeDelay <= 0 {
+		return attempt(ctx, p, breaker, call)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type outcome struct {
+		result T
+		err    error
+	}
+	outcomes := make(chan outcome, 2)
+	launch := func() {
+		go func() {
+			result, err := attempt(ctx, p, breaker, call)
+			outcomes <- outcome{result, err}
+		}()
+	}
+
+	launch()
+	timer := time.NewTimer(p.HedgeDelay)
+	defer timer.Stop()
+
+	pending, hedging := 1, false
+	var last outcome
+	for pending > 0 {
+		select {
+		case o := <-outcomes:
+			pending--
+			if o.err == nil || !hedging {
+				return o.result, o.err
+			}
+			last = o
+		case <-timer.C:
+			hedging = true
+			pending++
+			launch()
+		}
+	}
+	return last.result, last.err
+}
+
+// attempt makes a single call through the breaker with the per-attempt timeout.
+func attempt[T any](ctx context.Context, p *Policy, breaker *Breaker, call func(context.Context) (T, error)) (result T, err error) {
+	if breaker != nil {
+		done, allowErr := breaker.Allow()
+		if allowErr != nil {
+			return result, allowErr
+		}
+		// A hedge cancelled because its sibling won reports context.Canceled,
+		// which the breaker does not count as a failure.
+		defer func() { done(err) }()
+	}
+
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+	return call(ctx)
+}
+
+// requestedWait returns the wait the dependency asked for with err, if any.
+func requestedWait(err error) time.Duration {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.RetryAfter
+	}
+	return 0
+}
+
+// fitsDeadline reports whether ctx leaves time to wait d and try again.
+func fitsDeadline(ctx context.Context, d time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Until(deadline) > d
+}
+
+// backoff returns the jittered delay before retry number n.
+func backoff(base time.Duration, n int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	d := base << (n - 1)
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
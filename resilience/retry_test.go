@@ -0,0 +1,145 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     Policy
+		idempotent bool
+		failures   int32
+		calls      int32
+		err        error
+	}{
+		{"succeeds after retries", Policy{MaxAttempts: 3}, true, 2, 3, nil},
+		{"gives up after MaxAttempts", Policy{MaxAttempts: 3}, true, 5, 3, errDependency},
+		{"non-idempotent call is not retried", Policy{MaxAttempts: 3}, false, 5, 1, errDependency},
+		{"non-idempotent retries when allowed", Policy{MaxAttempts: 3, RetryNonIdempotent: true}, false, 1, 2, nil},
+		{"open breaker stops retries", Policy{MaxAttempts: 3, Breakers: &Breakers{New: func(string) *Breaker {
+			return &Breaker{FailureThreshold: 1}
+		}}}, true, 5, 1, ErrOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			_, err := Do(context.Background(), &tt.policy, "logging", tt.idempotent, func(context.Context) (int, error) {
+				if calls.Add(1) <= tt.failures {
+					return 0, errDependency
+				}
+				return 1, nil
+			})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Do() error = %v, want %v", err, tt.err)
+			}
+			if got := calls.Load(); got != tt.calls {
+				t.Errorf("call made %d times, want %d", got, tt.calls)
+			}
+		})
+	}
+}
+
+func TestRetryBudgetExhaustion(t *testing.T) {
+	budget := &RetryBudget{MaxTokens: 10, Ratio: 1}
+	p := &Policy{MaxAttempts: 10, Budget: budget}
+
+	var calls atomic.Int32
+	fail := func(context.Context) (int, error) {
+		calls.Add(1)
+		return 0, errDependency
+	}
+
+	// Every failed attempt costs a token; retries stop at half the budget.
+	Do(context.Background(), p, "logging", true, fail)
+	if got := calls.Load(); got != 5 {
+		t.Fatalf("first call made %d attempts, want 5", got)
+	}
+	if budget.CanRetry() {
+		t.Fatal("CanRetry() = true with the budget drained")
+	}
+
+	calls.Store(0)
+	Do(context.Background(), p, "logging", true, fail)
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("call with a drained budget made %d attempts, want 1", got)
+	}
+
+	// Successes earn the budget back.
+	for i := 0; i < 3; i++ {
+		Do(context.Background(), p, "logging", true, func(context.Context) (int, error) { return 1, nil })
+	}
+	if !budget.CanRetry() {
+		t.Error("CanRetry() = false after successes refilled the budget")
+	}
+}
+
+func TestDoTimeout(t *testing.T) {
+	p := &Policy{Timeout: 10 * time.Millisecond}
+	_, err := Do(context.Background(), p, "logging", true, func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Do() error = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestDoHedging(t *testing.T) {
+	tests := []struct {
+		name       string
+		idempotent bool
+		calls      int32
+		result     int
+	}{
+		{"slow idempotent call is hedged", true, 2, 2},
+		{"non-idempotent call is not hedged", false, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Policy{HedgeDelay: 10 * time.Millisecond}
+			var calls atomic.Int32
+			result, err := Do(context.Background(), p, "logging", tt.idempotent, func(ctx context.Context) (int, error) {
+				n := calls.Add(1)
+				if n == 1 {
+					// The first attempt is slow; the hedge answers at once.
+					select {
+					case <-ctx.Done():
+						return 0, ctx.Err()
+					case <-time.After(200 * time.Millisecond):
+					}
+				}
+				return int(n), nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != tt.result {
+				t.Errorf("result from attempt %d, want %d", result, tt.result)
+			}
+			if got := calls.Load(); got != tt.calls {
+				t.Errorf("call made %d times, want %d", got, tt.calls)
+			}
+		})
+	}
+}
+
+func TestDoHedgingReturnsFirstSuccess(t *testing.T) {
+	p := &Policy{HedgeDelay: 10 * time.Millisecond}
+	var calls atomic.Int32
+	result, err := Do(context.Background(), p, "logging", true, func(ctx context.Context) (int, error) {
+		if calls.Add(1) == 1 {
+			// The first attempt is slow and then succeeds; the hedge fails.
+			time.Sleep(50 * time.Millisecond)
+			return 1, nil
+		}
+		return 0, errDependency
+	})
+	if err != nil || result != 1 {
+		t.Errorf("Do() = %d, %v; want the slow attempt's success", result, err)
+	}
+}
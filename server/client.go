@@ -0,0 +1,30 @@
+package server
+
+import (
+	"demo/tracing"
+	"net/http"
+	"time"
+)
+
+// NewClient returns the HTTP client a service uses for registration,
+// notifications, health checks and calls to its dependencies. It forwards the
+// request ID and trace context of the request being handled and, when
+// tlsConfig is set, verifies servers against its CA and presents the
+// service's certificate for mutual TLS.
+func NewClient(tracer *tracing.Tracer, tlsConfig *TLSConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		cfg, err := tlsConfig.ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = cfg
+	}
+
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &RequestIDTransport{
+			Base: &tracing.Transport{Tracer: tracer, Base: transport},
+		},
+	}, nil
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"demo/metrics"
+	"demo/registry"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DependencyRetryAfter is the Retry-After sent while a required dependency is
+// not connected.
+const DependencyRetryAfter = 5 * time.Second
+
+// CandidateCheckInterval is how often the known instances of required service
+// types under a traffic policy are health-checked.
+const CandidateCheckInterval = 5 * time.Second
+
+type dependencyKey string
+
+// RequireDependency returns middleware that answers 503 with Retry-After
+// until an instance of serviceType is connected. The instance chosen for the
+// request, following the traffic policy of serviceType if there is one, is
+// available to the handler through Dependency, so a replaced instance is
+// picked up by the next request.
+func (s *Server) RequireDependency(serviceType string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			instance, ok := s.ConnectedInstances.Choose(serviceType)
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(DependencyRetryAfter.Seconds())))
+				http.Error(w, serviceType+" service unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			ctx := context.WithValue(r.Context(), dependencyKey(serviceType), instance)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Dependency returns the instance of serviceType that RequireDependency
+// resolved for the request.
+func Dependency(ctx context.Context, serviceType string) (registry.ConnectedInstance, bool) {
+	instance, ok := ctx.Value(dependencyKey(serviceType)).(registry.ConnectedInstance)
+	return instance, ok
+}
+
+// DependencyClient returns a client for calls to required services: Client
+// with the Dependencies policy applied, or Client itself without a policy.
+// Client must be set, or StartServer must have created it.
+func (s *Server) DependencyClient() *http.Client {
+	if s.Dependencies == nil {
+		return s.Client
+	}
+	return s.Dependencies.Client(s.Client)
+}
+
+// registerDependencyMetrics exports the state of the Dependencies policy's
+// circuit breakers.
+func (s *Server) registerDependencyMetrics() {
+	if s.Dependencies == nil || s.Dependencies.Breakers == nil {
+		return
+	}
+	breakers := s.Dependencies.Breakers
+	s.Metrics.NewGaugeFunc("dependency_circuit_state", "Circuit breaker state per dependency instance: 0 closed, 1 half-open, 2 open.",
+		[]string{"instance"}, func(emit metrics.Emit) {
+			for instance, state := range breakers.States() {
+				emit(float64(state), instance)
+			}
+		})
+}
+
+// watchDependencies records every instance of the required service types that
+// s.Discovery reports, so instances that registered before this one are
+// connected too and state changes missed as notifications still apply, until
+// ctx is done. Instances discovery no longer reports are forgotten, and
+// replaced if connected.
+func (s *Server) watchDependencies(ctx context.Context) {
+	for _, serviceType := range s.RequiredServices {
+		go func(serviceType string) {
+			for instances := range s.Discovery.Watch(ctx, serviceType) {
+				current := make([]registry.ConnectedInstance, 0, len(instances))
+				for _, i := range instances {
+					instance := registry.ConnectedInstance{
+						ID:                  i.ID,
+						IP:                  i.IP,
+						Port:                i.Port,
+						Scheme:              i.Scheme,
+						HealthCheckEndpoint: i.HealthCheckEndpoint,
+						State:               i.State,
+						Version:             i.Version,
+						Weight:              i.Weight,
+					}
+					s.updateInstance(serviceType, instance)
+					current = append(current, instance)
+				}
+				for _, gone := range s.ConnectedInstances.Retain(serviceType, current) {
+					log.Printf("Forgot %s instance %s:%d, which discovery no longer reports", serviceType, gone.IP, gone.Port)
+					if s.ConnectedInstances.Remove(serviceType, gone) {
+						go s.replaceInstance(serviceType)
+					}
+				}
+			}
+		}(serviceType)
+	}
+}
+
+// checkCandidates health-checks the known instances of the required service
+// types under a traffic policy every CandidateCheckInterval until ctx is done,
+// so Choose only sends requests to instances that answer.
+func (s *Server) checkCandidates(ctx context.Context) {
+	ticker := time.NewTicker(CandidateCheckInterval)
+	defer ticker.Stop()
+	for {
+		for _, serviceType := range s.RequiredServices {
+			s.checkCandidatesOf(serviceType)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) checkCandidatesOf(serviceType string) {
+	if _, ok := s.ConnectedInstances.Policy(serviceType); !ok {
+		return
+	}
+	for _, candidate := range s.ConnectedInstances.Candidates(serviceType) {
+		if candidate.Active() {
+			s.ConnectedInstances.SetHealthy(serviceType, candidate, s.healthy(candidate))
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"demo/registry"
+	"demo/resilience"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDependencyClient(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name         string
+		dependencies *resilience.Policy
+		status       int
+		calls        int32
+	}{
+		{"without a policy", nil, http.StatusServiceUnavailable, 1},
+		{"with a retry policy", &resilience.Policy{MaxAttempts: 2}, http.StatusOK, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls.Store(0)
+			s := newTestServer()
+			s.Dependencies = tt.dependencies
+
+			resp, err := s.DependencyClient().Get(ts.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if got := calls.Load(); got != tt.calls {
+				t.Errorf("dependency called %d times, want %d", got, tt.calls)
+			}
+		})
+	}
+}
+
+func TestRequireDependency(t *testing.T) {
+	logging := registry.ConnectedInstance{ID: "logging-1", IP: "127.0.0.1", Port: 8081}
+
+	tests := []struct {
+		name      string
+		connected bool
+		status    int
+	}{
+		{"nothing connected", false, http.StatusServiceUnavailable},
+		{"instance connected", true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer("Logging")
+			if tt.connected {
+				s.ConnectedInstances.Set("Logging", logging)
+			}
+
+			var got registry.ConnectedInstance
+			var ok bool
+			handler := s.RequireDependency("Logging")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, ok = Dependency(r.Context(), "Logging")
+			}))
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/log", nil))
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if !tt.connected {
+				if w.Header().Get("Retry-After") != "5" {
+					t.Errorf("Retry-After = %q, want 5", w.Header().Get("Retry-After"))
+				}
+				return
+			}
+			if !ok || got != logging {
+				t.Errorf("Dependency() = %+v, %v; want %+v", got, ok, logging)
+			}
+		})
+	}
+}
+
+func TestRequireDependencyChoosesPerRequest(t *testing.T) {
+	v1 := registry.ConnectedInstance{ID: "logging-1", IP: "127.0.0.1", Port: 8081, Version: "v1"}
+	v2 := registry.ConnectedInstance{ID: "logging-2", IP: "127.0.0.1", Port: 8082, Version: "v2"}
+
+	s := newTestServer("Logging")
+	s.ConnectedInstances.Offer("Logging", v1)
+	s.ConnectedInstances.Offer("Logging", v2)
+	s.ConnectedInstances.SetHealthy("Logging", v2, true)
+
+	var got registry.ConnectedInstance
+	handler := s.RequireDependency("Logging")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = Dependency(r.Context(), "Logging")
+	}))
+	serve := func() registry.ConnectedInstance {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/log", nil))
+		return got
+	}
+
+	if instance := serve(); instance != v1 {
+		t.Errorf("without a policy: Dependency() = %+v, want the connected %+v", instance, v1)
+	}
+
+	// A policy set between requests applies to the next one.
+	s.ConnectedInstances.SetPolicy(registry.TrafficPolicy{ServiceType: "Logging", Splits: map[string]int{"v2": 100}})
+	if instance := serve(); instance != v2 {
+		t.Errorf("under a policy: Dependency() = %+v, want %+v", instance, v2)
+	}
+
+	// So does a replaced instance once the policy is removed.
+	s.ConnectedInstances.SetPolicy(registry.TrafficPolicy{ServiceType: "Logging"})
+	s.ConnectedInstances.Remove("Logging", v1)
+	s.ConnectedInstances.Replace("Logging", v2)
+	if instance := serve(); instance != v2 {
+		t.Errorf("after replacement: Dependency() = %+v, want %+v", instance, v2)
+	}
+}
+
+func TestDependencyWithoutGate(t *testing.T) {
+	if _, ok := Dependency(httptest.NewRequest(http.MethodGet, "/", nil).Context(), "Logging"); ok {
+		t.Error("Dependency() found an instance on a request that was not gated")
+	}
+}
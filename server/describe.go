@@ -0,0 +1,23 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Description is what a service binary prints when started with -describe,
+// so tools such as the supervisor learn its dependencies from the service
+// itself instead of repeating them.
+type Description struct {
+	ServiceType         string   `json:"serviceType"`
+	RequiredServices    []string `json:"requiredServices"`
+	HealthCheckEndpoint string   `json:"healthcheckEndpoint"`
+}
+
+// Describe writes d as JSON to w.
+func Describe(w io.Writer, d Description) error {
+	if d.RequiredServices == nil {
+		d.RequiredServices = []string{}
+	}
+	return json.NewEncoder(w).Encode(d)
+}
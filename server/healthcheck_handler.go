@@ -1,36 +1,87 @@
 package server
 
 import (
+	"demo/registry"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 )
 
-type HealthCheckResult struct {
-	ServiceID   string `json:"service_id"`
-	ServiceType string `json:"service_type"`
-	Healthy     bool   `json:"healthy"`
-	Message     string `json:"message,omitempty"`
-}
+// Health statuses, from best to worst.
+const (
+	StatusOK        = "ok"
+	StatusDegraded  = "degraded"
+	StatusUnhealthy = "unhealthy"
+)
+
+// HealthComponent checks one part of a service and returns its status and a
+// human readable message.
+type HealthComponent func() (status string, message string)
+
+// ComponentHealth and HealthCheckResult are shared with the registrar and its
+// clients through the registry package.
+type (
+	ComponentHealth   = registry.ComponentHealth
+	HealthCheckResult = registry.HealthCheckResult
+)
 
 func (s *Server) RegisterHealthcheckRoute() {
 	s.Router.Get("/healthcheck", s.HandleHealthCheck)
 }
 
 func (s *Server) HandleHealthCheck(w http.ResponseWriter, r *http.Request) {
-
-	// let's assume your service is always healthy.
-	result := HealthCheckResult{
-		ServiceID:   s.ID,
-		ServiceType: s.ServiceType,
-		Healthy:     true,
-		Message:     "Service is healthy",
-	}
+	result := s.checkHealth()
 
 	// Encode result as JSON
 	w.Header().Set("Content-Type", "application/json")
+	if !result.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
 	if err := json.NewEncoder(w).Encode(result); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to encode health check result: %v", err), http.StatusInternalServerError)
 		return
 	}
 }
+
+// checkHealth runs the service's health components. A service without
+// components is always healthy; otherwise it takes the worst component status.
+func (s *Server) checkHealth() HealthCheckResult {
+	result := HealthCheckResult{
+		ServiceID:   s.ID,
+		ServiceType: s.ServiceType,
+		Status:      StatusOK,
+	}
+
+	names := make([]string, 0, len(s.HealthComponents))
+	for name := range s.HealthComponents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		status, message := s.HealthComponents[name]()
+		result.Components = append(result.Components, ComponentHealth{Name: name, Status: status, Message: message})
+		if statusRank(status) > statusRank(result.Status) {
+			result.Status = status
+		}
+	}
+
+	result.Healthy = result.Status != StatusUnhealthy
+	result.Message = fmt.Sprintf("Service is %s", result.Status)
+	if result.Status == StatusOK {
+		result.Message = "Service is healthy"
+	}
+	return result
+}
+
+func statusRank(status string) int {
+	switch status {
+	case StatusOK:
+		return 0
+	case StatusDegraded:
+		return 1
+	default:
+		return 2
+	}
+}
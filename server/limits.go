@@ -0,0 +1,208 @@
+package server
+
+import (
+	"bytes"
+	"demo/metrics"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Limits bounds the load clients can put on a server. Zero values disable the
+// corresponding limit.
+type Limits struct {
+	// Rate is the sustained number of requests per second each client, keyed
+	// by remote IP, may make. Burst is the number it may make at once.
+	Rate  float64
+	Burst int
+
+	// MaxBodyBytes is the largest request body accepted on any route.
+	// RouteMaxBodyBytes overrides it per chi route pattern, e.g. "/log".
+	MaxBodyBytes      int64
+	RouteMaxBodyBytes map[string]int64
+
+	// MaxConcurrent is the number of requests handled at once across all clients.
+	MaxConcurrent int
+}
+
+// unthrottledRoutes are not rate limited: scrapes and health checks stay
+// answerable while a client is throttled, and notifications come from the
+// registrar, which shares its IP with every colocated service and signs them.
+var unthrottledRoutes = map[string]bool{"/metrics": true, "/healthcheck": true, "/notify": true}
+
+// streamingRoutes hold their request open for as long as the client listens,
+// so they do not take one of the MaxConcurrent slots.
+var streamingRoutes = map[string]bool{"/events/stream": true}
+
+// maxBodyBytes returns the body limit for route.
+func (l *Limits) maxBodyBytes(route string) int64 {
+	if n, ok := l.RouteMaxBodyBytes[route]; ok {
+		return n
+	}
+	return l.MaxBodyBytes
+}
+
+// limit enforces s.Limits: 429 for clients over their rate, 413 for bodies
+// over the route's limit and 503 while MaxConcurrent requests are in flight.
+// Rejections carry Retry-After where waiting helps. See unthrottledRoutes and
+// streamingRoutes for the routes exempt from the rate and concurrency limits.
+func (s *Server) limit(next http.Handler) http.Handler {
+	l := s.Limits
+	if l == nil {
+		return next
+	}
+
+	rejected := s.Metrics.NewCounterVec("http_requests_rejected_total",
+		"HTTP requests rejected by server limits, by reason.", "reason")
+	inFlight := s.Metrics.NewGaugeVec("http_requests_in_flight", "HTTP requests currently being handled.").With()
+	s.Metrics.NewGaugeFunc("http_limit", "Configured server limits; 0 means unlimited.", []string{"limit", "route"}, func(emit metrics.Emit) {
+		emit(l.Rate, "rate_per_second", "")
+		emit(float64(l.Burst), "burst", "")
+		emit(float64(l.MaxConcurrent), "max_concurrent", "")
+		emit(float64(l.MaxBodyBytes), "max_body_bytes", "")
+		for route, n := range l.RouteMaxBodyBytes {
+			emit(float64(n), "max_body_bytes", route)
+		}
+	})
+
+	var limiter *rateLimiter
+	if l.Rate > 0 {
+		limiter = newRateLimiter(l.Rate, l.Burst)
+	}
+	var slots chan struct{}
+	if l.MaxConcurrent > 0 {
+		slots = make(chan struct{}, l.MaxConcurrent)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Match the route up front so the body limit and the route label of
+		// rejected requests use the pattern the router will pick.
+		match := chi.NewRouteContext()
+		s.Router.Match(match, r.Method, r.URL.Path)
+		reject := func(reason string, code int, retryAfter time.Duration, msg string) {
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				rctx.RoutePatterns = match.RoutePatterns
+			}
+			if retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			}
+			rejected.With(reason).Inc()
+			http.Error(w, msg, code)
+		}
+
+		route := match.RoutePattern()
+		if limiter != nil && !unthrottledRoutes[route] {
+			if ok, wait := limiter.allow(clientIP(r), time.Now()); !ok {
+				reject("rate_limited", http.StatusTooManyRequests, wait, "rate limit exceeded")
+				return
+			}
+		}
+
+		if slots != nil && !streamingRoutes[route] {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			default:
+				reject("concurrency", http.StatusServiceUnavailable, time.Second, "server busy")
+				return
+			}
+		}
+
+		if max := l.maxBodyBytes(route); max > 0 && r.Body != nil && r.Body != http.NoBody {
+			if r.ContentLength > max {
+				reject("body_too_large", http.StatusRequestEntityTooLarge, 0, "request body too large")
+				return
+			}
+			// Buffer at most max+1 bytes so handlers never see more than max.
+			body, err := io.ReadAll(io.LimitReader(r.Body, max+1))
+			r.Body.Close()
+			if err != nil {
+				http.Error(w, "failed to read request body", http.StatusBadRequest)
+				return
+			}
+			if int64(len(body)) > max {
+				reject("body_too_large", http.StatusRequestEntityTooLarge, 0, "request body too large")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		inFlight.Inc()
+		defer inFlight.Dec()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the host part of the request's remote address.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimiter keeps one token bucket per client.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), buckets: make(map[string]*bucket)}
+}
+
+// allow takes a token from key's bucket, or reports how long until one is available.
+func (rl *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.sweep(now)
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{tokens: rl.burst, last: now}
+		rl.buckets[key] = b
+	}
+	b.tokens = math.Min(rl.burst, b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops buckets that have refilled completely, at most once a minute.
+func (rl *rateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < time.Minute {
+		return
+	}
+	rl.lastSweep = now
+
+	full := time.Duration(rl.burst / rl.rate * float64(time.Second))
+	for key, b := range rl.buckets {
+		if now.Sub(b.last) > full {
+			delete(rl.buckets, key)
+		}
+	}
+}
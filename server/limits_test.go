@@ -0,0 +1,192 @@
+package server
+
+import (
+	"demo/metrics"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newLimitedServer returns the handler of a server enforcing limits, with
+// handler at /echo, /log, /notify and /events/stream.
+func newLimitedServer(limits *Limits, handler http.HandlerFunc) http.Handler {
+	s := newTestServer()
+	s.Metrics = metrics.NewRegistry()
+	s.Limits = limits
+	for _, route := range []string{"/echo", "/log", "/notify"} {
+		s.Router.Post(route, handler)
+	}
+	s.Router.Get("/events/stream", handler)
+	s.RegisterMetricsRoute()
+	s.Router.Get("/healthcheck", func(w http.ResponseWriter, r *http.Request) {})
+	return s.limit(s.Router)
+}
+
+func echo(w http.ResponseWriter, r *http.Request) {
+	io.Copy(w, r.Body)
+}
+
+func request(method, path, remoteAddr, body string) *http.Request {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.RemoteAddr = remoteAddr
+	return r
+}
+
+func TestRateLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		remoteAddr string
+		status     int
+	}{
+		{"client over its rate", http.MethodPost, "/echo", "10.0.0.1:1234", http.StatusTooManyRequests},
+		{"same client from another port", http.MethodPost, "/echo", "10.0.0.1:5678", http.StatusTooManyRequests},
+		{"another client", http.MethodPost, "/echo", "10.0.0.2:1234", http.StatusOK},
+		{"metrics", http.MethodGet, "/metrics", "10.0.0.1:1234", http.StatusOK},
+		{"healthcheck", http.MethodGet, "/healthcheck", "10.0.0.1:1234", http.StatusOK},
+		{"notification", http.MethodPost, "/notify", "10.0.0.1:1234", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newLimitedServer(&Limits{Rate: 1, Burst: 2}, echo)
+
+			// Use up the burst of 10.0.0.1.
+			for i := 0; i < 2; i++ {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, request(http.MethodPost, "/echo", "10.0.0.1:1234", ""))
+				if w.Code != http.StatusOK {
+					t.Fatalf("request %d within the burst: status %d", i+1, w.Code)
+				}
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, request(tt.method, tt.path, tt.remoteAddr, ""))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "1" {
+				t.Errorf("Retry-After = %q, want 1", w.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	rl := newRateLimiter(2, 1)
+	now := time.Now()
+
+	if ok, _ := rl.allow("a", now); !ok {
+		t.Fatal("first request rejected")
+	}
+	ok, wait := rl.allow("a", now)
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("allow() = %v, %s; want false, 500ms", ok, wait)
+	}
+	if ok, _ := rl.allow("a", now.Add(500*time.Millisecond)); !ok {
+		t.Error("request after the refill rejected")
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	limits := &Limits{MaxBodyBytes: 10, RouteMaxBodyBytes: map[string]int64{"/log": 100}}
+
+	tests := []struct {
+		name          string
+		path          string
+		body          string
+		unknownLength bool
+		status        int
+	}{
+		{"within the limit", "/echo", "0123456789", false, http.StatusOK},
+		{"over the limit", "/echo", "0123456789a", false, http.StatusRequestEntityTooLarge},
+		{"over the limit without a length", "/echo", "0123456789a", true, http.StatusRequestEntityTooLarge},
+		{"route override", "/log", strings.Repeat("x", 100), false, http.StatusOK},
+		{"over the route override", "/log", strings.Repeat("x", 101), true, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newLimitedServer(limits, echo)
+
+			r := request(http.MethodPost, tt.path, "10.0.0.1:1234", tt.body)
+			if tt.unknownLength {
+				r.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusOK && w.Body.String() != tt.body {
+				t.Errorf("handler read %d bytes, want %d", w.Body.Len(), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+	}{
+		{"request while the slot is taken", http.MethodPost, "/echo", http.StatusServiceUnavailable},
+		{"event stream", http.MethodGet, "/events/stream", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{})
+			release := make(chan struct{})
+			handler := newLimitedServer(&Limits{MaxConcurrent: 1}, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("block") != "" {
+					close(started)
+					<-release
+				}
+			})
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				handler.ServeHTTP(httptest.NewRecorder(), request(http.MethodPost, "/echo?block=1", "10.0.0.1:1234", ""))
+			}()
+			<-started
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, request(tt.method, tt.path, "10.0.0.2:1234", ""))
+			close(release)
+			<-done
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusServiceUnavailable && w.Header().Get("Retry-After") != "1" {
+				t.Errorf("Retry-After = %q, want 1", w.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{"10.0.0.1:1234", "10.0.0.1"},
+		{"[::1]:1234", "::1"},
+		{"10.0.0.1", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.remoteAddr, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"demo/auth"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+)
+
+type LogLevelPayload struct {
+	Level string `json:"level"`
+}
+
+func (s *Server) RegisterLogLevelRoute() {
+	s.Router.Get("/admin/loglevel", s.HandleGetLogLevel)
+	s.Router.Put("/admin/loglevel", s.HandleSetLogLevel)
+}
+
+// HandleGetLogLevel reports the service's current log level.
+func (s *Server) HandleGetLogLevel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(LogLevelPayload{Level: s.LogLevel.Level().String()}); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode log level: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleSetLogLevel changes the service's log level at runtime. The request
+// must be authenticated with the secret the service registers with, as a
+// bearer token or HMAC signature; without a secret the level cannot be changed.
+func (s *Server) HandleSetLogLevel(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read log level payload", http.StatusBadRequest)
+		return
+	}
+	if err := auth.Verify(r, body, s.Signer.Secret); err != nil {
+		log.Printf("Rejected log level change: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var payload LogLevelPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "failed to decode log level payload", http.StatusBadRequest)
+		return
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(payload.Level)); err != nil {
+		http.Error(w, fmt.Sprintf("invalid log level %q", payload.Level), http.StatusBadRequest)
+		return
+	}
+
+	old := s.LogLevel.Level()
+	s.LogLevel.Set(level)
+	slog.Info("Log level changed", "from", old.String(), "to", level.String())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LogLevelPayload{Level: level.String()})
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"demo/auth"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleSetLogLevel(t *testing.T) {
+	body := `{"level": "DEBUG"}`
+
+	tests := []struct {
+		name   string
+		secret string
+		signer *auth.Signer
+		status int
+	}{
+		{"bearer secret", "business-secret", &auth.Signer{Secret: "business-secret"}, http.StatusOK},
+		{"HMAC signature", "business-secret", &auth.Signer{Secret: "business-secret", HMAC: true}, http.StatusOK},
+		{"unauthenticated", "business-secret", nil, http.StatusUnauthorized},
+		{"wrong secret", "business-secret", &auth.Signer{Secret: "guess"}, http.StatusUnauthorized},
+		{"no secret configured", "", &auth.Signer{Secret: ""}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			s.Signer = auth.Signer{Secret: tt.secret}
+			s.LogLevel = new(slog.LevelVar)
+
+			req := httptest.NewRequest(http.MethodPut, "/admin/loglevel", strings.NewReader(body))
+			if tt.signer != nil {
+				tt.signer.Sign(req, []byte(body))
+			}
+			w := httptest.NewRecorder()
+			s.HandleSetLogLevel(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			want := slog.LevelInfo
+			if tt.status == http.StatusOK {
+				want = slog.LevelDebug
+			}
+			if got := s.LogLevel.Level(); got != want {
+				t.Errorf("level = %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"demo/metrics"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func (s *Server) RegisterMetricsRoute() {
+	s.Router.Method(http.MethodGet, "/metrics", s.Metrics.Handler())
+}
+
+// instrument records request counts and latencies per chi route pattern.
+func (s *Server) instrument(next http.Handler) http.Handler {
+	requests := s.Metrics.NewCounterVec("http_requests_total",
+		"HTTP requests handled, by route, method and status code.", "route", "method", "code")
+	latency := s.Metrics.NewHistogramVec("http_request_duration_seconds",
+		"HTTP request latency in seconds, by route and method.", metrics.DefaultBuckets, "route", "method")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Seed the route context so the pattern chi matched is visible here afterwards.
+		rctx := chi.NewRouteContext()
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		next.ServeHTTP(ww, r)
+
+		route := rctx.RoutePattern()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		requests.With(route, r.Method, strconv.Itoa(status)).Inc()
+		latency.With(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
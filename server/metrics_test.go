@@ -0,0 +1,38 @@
+package server
+
+import (
+	"demo/metrics"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInstrumentCountsByRoutePattern(t *testing.T) {
+	s := newTestServer()
+	s.Metrics = metrics.NewRegistry()
+	s.Router.Get("/services/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	s.RegisterMetricsRoute()
+	handler := s.instrument(s.Router)
+
+	for _, path := range []string{"/services/1", "/services/2", "/services/3", "/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+
+	for _, want := range []string{
+		`http_requests_total{route="/services/{id}",method="GET",code="200"} 3`,
+		`http_requests_total{route="unmatched",method="GET",code="404"} 1`,
+		`http_request_duration_seconds_count{route="/services/{id}",method="GET"} 3`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+	if strings.Contains(body, "/services/1") {
+		t.Error("metrics are labeled with a raw path")
+	}
+}
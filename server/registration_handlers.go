@@ -1,10 +1,14 @@
 package server
 
 import (
+	"context"
+	"demo/auth"
 	"demo/registry"
 	"encoding/json"
-	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"time"
 )
 
 func (s *Server) RegisterNotifyRoute() {
@@ -12,48 +16,74 @@ func (s *Server) RegisterNotifyRoute() {
 }
 
 func (nh *Server) HandleReceivedNotification(w http.ResponseWriter, r *http.Request) {
-	var payload registry.NotificationPayload
-
-	err := json.NewDecoder(r.Body).Decode(&payload)
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
+		http.Error(w, "failed to read notification payload", http.StatusBadRequest)
+		return
+	}
+
+	// Only trust notifications the registry signed with this instance's token.
+	if err := auth.Verify(r, body, nh.token()); err != nil {
+		log.Printf("Rejected notification: %v", err)
+		http.Error(w, "invalid notification signature", http.StatusUnauthorized)
+		return
+	}
+
+	var payload registry.NotificationPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
 		http.Error(w, "failed to decode notification payload", http.StatusBadRequest)
 		return
 	}
 
+	instance := payload.Registration.Instance()
+	serviceType := payload.Registration.ServiceType
+
 	switch payload.Action {
 	case "register":
-		fmt.Printf("Received registration notification - Service: %s\n", payload.Registration.ServiceType)
-
-		// Check if any of the required services is not attached to any instance
-		for _, requiredService := range nh.RequiredServices {
-			if _, exists := nh.ConnectedInstances[requiredService]; !exists {
-				// Service is not attached to any instance, so add it to the ConnectedInstances
-				instance := registry.ConnectedInstance{
-					ID:   payload.Registration.ID,
-					IP:   payload.Registration.IP,
-					Port: payload.Registration.Port,
-				}
-				nh.ConnectedInstances[requiredService] = instance
-
-				fmt.Printf("Added new instance for required service: %s\n", requiredService)
-			}
+		log.Printf("Received registration notification - Service: %s", serviceType)
+
+		if !nh.requires(serviceType) {
+			log.Printf("Ignoring registration of %s, which this service does not require", serviceType)
+			break
+		}
+		if nh.ConnectedInstances.Offer(serviceType, instance) {
+			log.Printf("Added new instance for required service: %s", serviceType)
+		}
+
+	case "update":
+		log.Printf("Received update notification - Service: %s, state: %s", serviceType, instance.State)
+
+		if nh.requires(serviceType) {
+			nh.updateInstance(serviceType, instance)
+		}
+
+	case "policy":
+		if payload.Policy == nil {
+			http.Error(w, "missing policy in notification", http.StatusBadRequest)
+			return
+		}
+		log.Printf("Received traffic policy notification - Service: %s, splits: %v", payload.Policy.ServiceType, payload.Policy.Splits)
+
+		if nh.requires(payload.Policy.ServiceType) {
+			nh.ConnectedInstances.SetPolicy(*payload.Policy)
+			go nh.checkCandidatesOf(payload.Policy.ServiceType)
 		}
 
 	case "deregister":
-		fmt.Printf("Received deregistration notification - Service: %s\n", payload.Registration.ServiceType)
-
-		// Check if the service is connected and if the IP and port match
-		if instance, exists := nh.ConnectedInstances[payload.Registration.ServiceType]; exists {
-			if instance.IP == payload.Registration.IP && instance.Port == payload.Registration.Port {
-				// Deattach the service by removing it from ConnectedInstances
-				delete(nh.ConnectedInstances, payload.Registration.ServiceType)
-
-				fmt.Printf("Deregistered service: %s\n", payload.Registration.ServiceType)
-			} else {
-				fmt.Printf("Mismatch in IP or port for deregistering service: %s\n", payload.Registration.ServiceType)
-			}
+		log.Printf("Received deregistration notification - Service: %s", serviceType)
+
+		nh.ConnectedInstances.Forget(serviceType, instance)
+
+		// Deattach the service if it is connected at the same IP and port
+		if _, exists := nh.ConnectedInstances.Get(serviceType); !exists {
+			log.Printf("Service not found for deregistration: %s", serviceType)
+		} else if nh.ConnectedInstances.Remove(serviceType, instance) {
+			log.Printf("Deregistered service: %s", serviceType)
+
+			// Health checks can be slow; answer the registrar first.
+			go nh.replaceInstance(serviceType)
 		} else {
-			fmt.Printf("Service not found for deregistration: %s\n", payload.Registration.ServiceType)
+			log.Printf("Mismatch in IP or port for deregistering service: %s", serviceType)
 		}
 	default:
 		http.Error(w, "unknown action in notification", http.StatusBadRequest)
@@ -63,3 +93,65 @@ func (nh *Server) HandleReceivedNotification(w http.ResponseWriter, r *http.Requ
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Notification handled successfully"))
 }
+
+func (s *Server) requires(serviceType string) bool {
+	for _, required := range s.RequiredServices {
+		if required == serviceType {
+			return true
+		}
+	}
+	return false
+}
+
+// updateInstance records what is now known about instance of serviceType. An
+// instance that is no longer active stops receiving new requests: if it is
+// connected, it is replaced by another active instance.
+func (s *Server) updateInstance(serviceType string, instance registry.ConnectedInstance) {
+	if s.ConnectedInstances.Offer(serviceType, instance) {
+		log.Printf("Connected %s instance %s:%d", serviceType, instance.IP, instance.Port)
+	}
+	if !instance.Active() && s.ConnectedInstances.Remove(serviceType, instance) {
+		log.Printf("Disconnected %s instance %s:%d, which is %s", serviceType, instance.IP, instance.Port, instance.State)
+		go s.replaceInstance(serviceType)
+	}
+}
+
+// replaceInstance connects the first active known instance of serviceType
+// that passes its health check, unless another instance was connected or the
+// candidate deregistered in the meantime.
+func (s *Server) replaceInstance(serviceType string) {
+	for _, candidate := range s.ConnectedInstances.Candidates(serviceType) {
+		if !candidate.Active() {
+			continue
+		}
+		if !s.healthy(candidate) {
+			log.Printf("Skipping unhealthy %s instance %s:%d", serviceType, candidate.IP, candidate.Port)
+			continue
+		}
+		if s.ConnectedInstances.Replace(serviceType, candidate) {
+			log.Printf("Replaced disconnected %s instance with %s:%d", serviceType, candidate.IP, candidate.Port)
+		}
+		return
+	}
+	log.Printf("No healthy active %s instance known to replace the disconnected one", serviceType)
+}
+
+func (s *Server) healthy(instance registry.ConnectedInstance) bool {
+	if instance.HealthCheckEndpoint == "" {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, instance.HealthCheckEndpoint, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
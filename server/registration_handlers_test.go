@@ -0,0 +1,217 @@
+package server
+
+import (
+	"bytes"
+	"demo/auth"
+	"demo/registry"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const testToken = "instance-token"
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func newTestServer(required ...string) *Server {
+	s := &Server{
+		Router:           chi.NewRouter(),
+		ServiceType:      "Business",
+		RequiredServices: required,
+		Client:           &http.Client{Timeout: time.Second},
+	}
+	s.setInstanceToken(testToken)
+	return s
+}
+
+// notify delivers payload to s signed like the registrar does.
+func notify(t *testing.T, s *Server, payload registry.NotificationPayload) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/notify", bytes.NewReader(body))
+	auth.Signer{Secret: testToken, HMAC: true}.Sign(req, body)
+
+	w := httptest.NewRecorder()
+	s.HandleReceivedNotification(w, req)
+	return w
+}
+
+func registration(serviceType string, port int) registry.Registration {
+	return registry.Registration{ID: fmt.Sprint(serviceType, port), ServiceType: serviceType, IP: "127.0.0.1", Port: port}
+}
+
+func TestConcurrentNotifications(t *testing.T) {
+	s := newTestServer("Logging")
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				r := registration("Logging", 9000+g*100+i)
+				for _, action := range []string{"register", "deregister"} {
+					if w := notify(t, s, registry.NotificationPayload{Action: action, Registration: r}); w.Code != http.StatusOK {
+						t.Errorf("%s notification answered %d: %s", action, w.Code, w.Body)
+					}
+				}
+				s.ConnectedInstances.Get("Logging")
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// Deregistration replaces the connected instance in the background.
+	waitFor(t, func() bool {
+		_, ok := s.ConnectedInstances.Get("Logging")
+		return !ok
+	})
+	if n := len(s.ConnectedInstances.Candidates("Logging")); n != 0 {
+		t.Errorf("%d instances still known after every instance deregistered", n)
+	}
+}
+
+func TestNotificationSignature(t *testing.T) {
+	s := newTestServer("Logging")
+	body, _ := json.Marshal(registry.NotificationPayload{Action: "register", Registration: registration("Logging", 8081)})
+
+	req := httptest.NewRequest(http.MethodPost, "/notify", bytes.NewReader(body))
+	auth.Signer{Secret: "someone-else", HMAC: true}.Sign(req, body)
+	w := httptest.NewRecorder()
+	s.HandleReceivedNotification(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("notification signed with another token answered %d, want 401", w.Code)
+	}
+	if _, ok := s.ConnectedInstances.Get("Logging"); ok {
+		t.Error("unsigned notification connected an instance")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 5s")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHandleReceivedNotification(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unhealthy.Close()
+
+	instance := func(port int, healthURL string) registry.Registration {
+		r := registration("Logging", port)
+		r.HealthCheckEndpoint = healthURL
+		return r
+	}
+	register := func(r registry.Registration) registry.NotificationPayload {
+		return registry.NotificationPayload{Action: "register", Registration: r}
+	}
+	deregister := func(r registry.Registration) registry.NotificationPayload {
+		return registry.NotificationPayload{Action: "deregister", Registration: r}
+	}
+
+	a := instance(8081, healthy.URL)
+	b := instance(8083, unhealthy.URL)
+	c := instance(8084, healthy.URL)
+	movedA := a
+	movedA.IP = "10.0.0.1"
+
+	tests := []struct {
+		name          string
+		notifications []registry.NotificationPayload
+		wantPort      int // 0 for no connected instance
+		wantKnown     int
+	}{
+		{
+			name:          "first registration is connected",
+			notifications: []registry.NotificationPayload{register(a), register(c)},
+			wantPort:      8081,
+			wantKnown:     2,
+		},
+		{
+			name:          "types not required are ignored",
+			notifications: []registry.NotificationPayload{register(registration("Metrics", 9090))},
+			wantPort:      0,
+			wantKnown:     0,
+		},
+		{
+			name:          "deregistering the connected instance fails over to a healthy one",
+			notifications: []registry.NotificationPayload{register(a), register(c), deregister(a)},
+			wantPort:      8084,
+			wantKnown:     1,
+		},
+		{
+			name:          "unhealthy candidates are skipped",
+			notifications: []registry.NotificationPayload{register(a), register(b), register(c), deregister(a)},
+			wantPort:      8084,
+			wantKnown:     2,
+		},
+		{
+			name:          "mismatched IP does not disconnect the current instance",
+			notifications: []registry.NotificationPayload{register(a), register(c), deregister(movedA)},
+			wantPort:      8081,
+			wantKnown:     2,
+		},
+		{
+			name:          "mismatched port does not disconnect the current instance",
+			notifications: []registry.NotificationPayload{register(a), deregister(instance(8085, healthy.URL))},
+			wantPort:      8081,
+			wantKnown:     1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer("Logging")
+			for _, n := range tt.notifications {
+				if w := notify(t, s, n); w.Code != http.StatusOK {
+					t.Fatalf("%s notification answered %d: %s", n.Action, w.Code, w.Body)
+				}
+			}
+
+			// Failover happens in the background.
+			waitFor(t, func() bool {
+				connected, ok := s.ConnectedInstances.Get("Logging")
+				if tt.wantPort == 0 {
+					return !ok
+				}
+				return ok && connected.Port == tt.wantPort
+			})
+			if known := len(s.ConnectedInstances.Candidates("Logging")); known != tt.wantKnown {
+				t.Errorf("%d instances known, want %d", known, tt.wantKnown)
+			}
+		})
+	}
+}
+
+func TestHandleReceivedNotificationUnknownAction(t *testing.T) {
+	s := newTestServer("Logging")
+	w := notify(t, s, registry.NotificationPayload{Action: "explode", Registration: registration("Logging", 8081)})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown action answered %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"generated when absent", "", false},
+		{"incoming ID kept", "req-123", true},
+		{"overlong ID replaced", strings.Repeat("x", 129), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = middleware.GetReqID(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				r.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if seen == "" {
+				t.Fatal("handler saw no request ID")
+			}
+			if (seen == tt.incoming) != tt.keep {
+				t.Errorf("request ID = %q, incoming %q, want kept %v", seen, tt.incoming, tt.keep)
+			}
+			if got := w.Header().Get(RequestIDHeader); got != seen {
+				t.Errorf("response %s = %q, want %q", RequestIDHeader, got, seen)
+			}
+		})
+	}
+}
+
+func TestRequestIDTransport(t *testing.T) {
+	var received string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(RequestIDHeader)
+	}))
+	defer ts.Close()
+	client := &http.Client{Transport: &RequestIDTransport{}}
+
+	tests := []struct {
+		name   string
+		ctxID  string
+		header string
+		want   string
+	}{
+		{"ID from the context", "req-123", "", "req-123"},
+		{"explicit header wins", "req-123", "req-456", "req-456"},
+		{"no ID", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Serve the call from inside a request so it carries its context.
+			handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, ts.URL, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tt.header != "" {
+					req.Header.Set(RequestIDHeader, tt.header)
+				}
+				if tt.ctxID == "" {
+					req = req.WithContext(context.Background())
+				}
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				if tt.header == "" && req.Header.Get(RequestIDHeader) != "" {
+					t.Error("transport modified the caller's request")
+				}
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.ctxID != "" {
+				r.Header.Set(RequestIDHeader, tt.ctxID)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			if received != tt.want {
+				t.Errorf("outgoing %s = %q, want %q", RequestIDHeader, received, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestIDHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewRequestIDHandler(slog.NewJSONHandler(&buf, nil))).With("service", "Business")
+
+	ctx := context.Background()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(RequestIDHeader, "req-123")
+	RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	})).ServeHTTP(httptest.NewRecorder(), r)
+
+	logger.InfoContext(ctx, "with a request")
+	logger.Info("without a request")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d records, want 2", len(lines))
+	}
+	for i, want := range []string{"req-123", ""} {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(lines[i]), &record); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := record[RequestIDKey].(string)
+		if got != want {
+			t.Errorf("record %d %s = %q, want %q", i+1, RequestIDKey, got, want)
+		}
+		if record["service"] != "Business" {
+			t.Errorf("record %d lost the attributes added with With", i+1)
+		}
+	}
+}
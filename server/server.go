@@ -3,13 +3,20 @@ package server
 import (
 	"bytes"
 	"context"
+	"demo/auth"
+	"demo/discovery"
+	"demo/metrics"
 	"demo/registry"
+	"demo/resilience"
+	"demo/tracing"
 	"encoding/json"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -30,6 +37,15 @@ type Server struct {
 	// DeregistrationAddr is the address used by the server to deregister itself from the registry service..
 	DeregistrationAddr string
 
+	// StateAddr is the address the server sets its own state at, e.g.
+	// http://localhost:8080/services; the instance ID and /state are appended.
+	// When set, the server drains before deregistering on shutdown.
+	StateAddr string
+
+	// DrainPeriod is how long the server stays draining before it
+	// deregisters, giving dependents time to stop sending new requests.
+	DrainPeriod time.Duration
+
 	// Port is the port on which the server is running.
 	Port int
 
@@ -39,30 +55,126 @@ type Server struct {
 	// RequiredServices is a list of service names that this service depends on.
 	RequiredServices []string
 
-	ConnectedInstances registry.ConnectedInstances
+	// Tags label this instance in the registry.
+	Tags []string
+
+	// Version is the version of the service this instance runs, and Weight
+	// its share of the requests to that version; traffic policies split
+	// requests between versions.
+	Version string
+	Weight  int
+
+	// ConnectedInstances holds the instance connected for each required
+	// service type, updated as notifications arrive.
+	ConnectedInstances registry.Connections
+
+	// Discovery, when set, looks up instances of the required services that
+	// registered before this one, which no notification announces.
+	Discovery *discovery.Client
 
 	// NotificationEndpoint is the URL where the server receives notifications.
 	NotificationEndpoint string
 
 	HealthCheckEndpoint string
+
+	// HealthComponents are checked on every /healthcheck request, keyed by component name.
+	HealthComponents map[string]HealthComponent
+
+	// Metrics collects the service's metrics, served on /metrics. StartServer
+	// creates a registry if none is set.
+	Metrics *metrics.Registry
+
+	// Tracer traces incoming and outgoing requests. StartServer creates one
+	// that propagates trace context without exporting spans if none is set.
+	Tracer *tracing.Tracer
+
+	// Client is used for outgoing calls such as registration. StartServer
+	// creates one with NewClient if none is set.
+	Client *http.Client
+
+	// Dependencies, when set, is the resilience policy applied to calls to
+	// required services made through DependencyClient.
+	Dependencies *resilience.Policy
+
+	// Signer authenticates registration with the secret of the service type.
+	Signer auth.Signer
+
+	// instanceToken is issued by the registry on registration. It
+	// authenticates deregistration of this instance and signs the
+	// notifications the registry sends to it.
+	tokenMu       sync.Mutex
+	instanceToken string
+
+	// LogLevel, when set, is exposed for runtime changes on /admin/loglevel,
+	// authenticated with Signer's secret.
+	LogLevel *slog.LevelVar
+
+	// Limits, when set, rate limits clients and bounds request bodies and
+	// concurrent requests.
+	Limits *Limits
+
+	// TLS, when set, makes the server serve HTTPS and the default Client
+	// present the server's certificate.
+	TLS *TLSConfig
+
+	// OnShutdown, when set, is called as the server starts shutting down, to
+	// end long-lived requests such as event streams that would otherwise
+	// hold up the shutdown.
+	OnShutdown func()
 }
 
 func (s *Server) StartServer() error {
 
 	s.ID = uuid.New().String()
 
+	if s.Metrics == nil {
+		s.Metrics = metrics.NewRegistry()
+	}
+	if s.Tracer == nil {
+		s.Tracer = &tracing.Tracer{Service: s.ServiceType}
+	}
+	if s.Client == nil {
+		client, err := NewClient(s.Tracer, s.TLS)
+		if err != nil {
+			return err
+		}
+		s.Client = client
+	}
+
 	serverAddr := fmt.Sprintf(":%d", s.Port)
 	server := &http.Server{
 		Addr:    serverAddr,
-		Handler: s.Router,
+		Handler: s.instrument(s.limit(s.Tracer.Middleware(RequestID(s.Router)))),
+	}
+	if s.TLS != nil {
+		tlsConfig, err := s.TLS.ServerConfig()
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = tlsConfig
+	}
+	if s.OnShutdown != nil {
+		server.RegisterOnShutdown(s.OnShutdown)
 	}
 
+	s.registerDependencyMetrics()
 	s.RegisterNotifyRoute()
+	s.RegisterMetricsRoute()
 	s.RegisterHealthcheckRoute()
+	if s.LogLevel != nil {
+		s.RegisterLogLevelRoute()
+	}
 
 	go func() {
-		log.Printf("Starting server on port %d...", s.Port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("Starting server on port %d (%s)...", s.Port, s.TLS.Scheme())
+		var err error
+		if s.TLS != nil {
+			// The certificate is already loaded into server.TLSConfig.
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Error starting server: %v", err)
 		}
 	}()
@@ -71,12 +183,30 @@ func (s *Server) StartServer() error {
 		log.Printf("Error registering server: %v", err)
 	}
 
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	if s.Discovery != nil {
+		s.watchDependencies(watchCtx)
+	}
+	go s.checkCandidates(watchCtx)
+
 	// Wait for an interrupt signal to gracefully shut down the server
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
 	<-quit
 	log.Println("Shutting down server...")
 
+	// Drain first so dependents move to other instances while this one
+	// still answers, then deregister before shutting down.
+	if s.StateAddr != "" {
+		if err := s.SetState(registry.StateDraining); err != nil {
+			log.Printf("Error draining server: %v", err)
+		} else if s.DrainPeriod > 0 {
+			log.Printf("Draining for %s...", s.DrainPeriod)
+			time.Sleep(s.DrainPeriod)
+		}
+	}
+
 	// Deregister before shutting down
 	if err := s.DeregisterMe(); err != nil {
 		log.Printf("Error deregistering server: %v", err)
@@ -94,7 +224,13 @@ func (s *Server) StartServer() error {
 	return nil
 }
 
-func (s *Server) RegisterMe() error {
+func (s *Server) RegisterMe() (err error) {
+	ctx, span := s.Tracer.Start(context.Background(), "register", tracing.KindInternal)
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
 	selfRegistration := registry.Registration{
 		ID:                   s.ID,
 		ServiceType:          s.ServiceType,
@@ -103,6 +239,10 @@ func (s *Server) RegisterMe() error {
 		RequiredServices:     s.RequiredServices,
 		NotificationEndpoint: s.NotificationEndpoint,
 		HealthCheckEndpoint:  s.HealthCheckEndpoint,
+		Scheme:               s.TLS.Scheme(),
+		Tags:                 s.Tags,
+		Version:              s.Version,
+		Weight:               s.Weight,
 	}
 
 	body, err := json.Marshal(selfRegistration)
@@ -111,7 +251,14 @@ func (s *Server) RegisterMe() error {
 	}
 
 	// Make a POST request to register itself
-	resp, err := http.Post(s.RegistrationAddr, "application/json", bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.RegistrationAddr, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	s.Signer.Sign(req, body)
+
+	resp, err := s.Client.Do(req)
 	if err != nil {
 		return err
 	}
@@ -121,10 +268,28 @@ func (s *Server) RegisterMe() error {
 		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
+	var registered registry.RegistrationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&registered); err != nil {
+		return fmt.Errorf("failed to decode registration response: %w", err)
+	}
+	s.setInstanceToken(registered.InstanceToken)
+	for _, warning := range registered.Warnings {
+		log.Printf("Registration warning: %s", warning)
+	}
+	for _, policy := range registered.Policies {
+		s.ConnectedInstances.SetPolicy(policy)
+	}
+
 	return nil
 }
 
-func (s *Server) DeregisterMe() error {
+func (s *Server) DeregisterMe() (err error) {
+	ctx, span := s.Tracer.Start(context.Background(), "deregister", tracing.KindInternal)
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
 	selfRegistration := registry.Registration{
 		ID:                   s.ID,
 		ServiceType:          s.ServiceType,
@@ -133,19 +298,19 @@ func (s *Server) DeregisterMe() error {
 		RequiredServices:     s.RequiredServices,
 		NotificationEndpoint: s.NotificationEndpoint,
 		HealthCheckEndpoint:  s.HealthCheckEndpoint,
+		Scheme:               s.TLS.Scheme(),
 	}
 
 	url := fmt.Sprintf("%v/%v", s.DeregistrationAddr, selfRegistration.ID)
 
-	fmt.Println(url)
-	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
 	if err != nil {
 		log.Println(err.Error())
 		return err
 	}
+	auth.Signer{Secret: s.token(), HMAC: s.Signer.HMAC}.Sign(req, nil)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := s.Client.Do(req)
 
 	if err != nil {
 		log.Println(err.Error())
@@ -159,3 +324,59 @@ func (s *Server) DeregisterMe() error {
 
 	return nil
 }
+
+// SetState sets the state of this instance in the registry, which notifies
+// its dependents.
+func (s *Server) SetState(state string) (err error) {
+	ctx, span := s.Tracer.Start(context.Background(), "set state", tracing.KindInternal)
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
+	body, err := json.Marshal(registry.StateUpdate{State: state})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/%s/state", s.StateAddr, s.ID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	auth.Signer{Secret: s.token(), HMAC: s.Signer.HMAC}.Sign(req, body)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code while setting state: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *Server) setInstanceToken(token string) {
+	s.tokenMu.Lock()
+	defer s.tokenMu.Unlock()
+	s.instanceToken = token
+}
+
+func (s *Server) token() string {
+	s.tokenMu.Lock()
+	defer s.tokenMu.Unlock()
+	return s.instanceToken
+}
+
+// InstanceEndpoint returns the URL of path on the instance currently connected
+// for serviceType, or false if no such instance is connected.
+func (s *Server) InstanceEndpoint(serviceType, path string) (string, bool) {
+	instance, exists := s.ConnectedInstances.Get(serviceType)
+	if !exists {
+		return "", false
+	}
+	return instance.URL(path), true
+}
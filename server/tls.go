@@ -0,0 +1,94 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// TLSConfig configures HTTPS for a server and for the client it uses to call
+// other services.
+type TLSConfig struct {
+	// CertFile and KeyFile hold the certificate presented to clients, and to
+	// servers when they require client certificates.
+	CertFile string
+	KeyFile  string
+
+	// CAFile holds the CA certificates used to verify servers and, with
+	// RequireClientCert, clients.
+	CAFile string
+
+	// RequireClientCert enables mutual TLS: clients must present a
+	// certificate signed by a CA in CAFile.
+	RequireClientCert bool
+}
+
+// ServerConfig returns the tls.Config for the server's listener.
+func (c *TLSConfig) ServerConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if c.RequireClientCert {
+		pool, err := c.caPool()
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// ClientConfig returns the tls.Config for outgoing calls, presenting the
+// server's certificate as client certificate.
+func (c *TLSConfig) ClientConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if c.CAFile != "" {
+		pool, err := c.caPool()
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if c.CertFile != "" && c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func (c *TLSConfig) caPool() (*x509.CertPool, error) {
+	if c.CAFile == "" {
+		return nil, errors.New("no CA file configured")
+	}
+	pem, err := os.ReadFile(c.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", c.CAFile)
+	}
+	return pool, nil
+}
+
+// Scheme returns the URL scheme services reach a server configured with c at.
+func (c *TLSConfig) Scheme() string {
+	if c == nil {
+		return "http"
+	}
+	return "https"
+}
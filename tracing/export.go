@@ -0,0 +1,71 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// Exporter receives finished spans.
+type Exporter interface {
+	Export(span SpanData)
+}
+
+// JSONExporter writes each span as one line of JSON.
+type JSONExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	c   io.Closer
+}
+
+// NewJSONExporter writes spans to w.
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	return &JSONExporter{enc: json.NewEncoder(w)}
+}
+
+// NewFileExporter appends spans to the file at path.
+func NewFileExporter(path string) (*JSONExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	e := NewJSONExporter(f)
+	e.c = f
+	return e, nil
+}
+
+// NewExporter returns an exporter for a command-line spec: "" disables
+// export, "stdout" writes to stdout and anything else is a file path.
+func NewExporter(spec string) (Exporter, error) {
+	switch spec {
+	case "":
+		return nil, nil
+	case "stdout":
+		return NewJSONExporter(os.Stdout), nil
+	default:
+		e, err := NewFileExporter(spec)
+		if err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+}
+
+func (e *JSONExporter) Export(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.enc.Encode(span); err != nil {
+		log.Println("Failed to export span:", err)
+	}
+}
+
+// Close closes the underlying file, if any.
+func (e *JSONExporter) Close() error {
+	if e.c == nil {
+		return nil
+	}
+	return e.c.Close()
+}
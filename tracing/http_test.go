@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestMiddlewareContinuesTrace(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		continued   bool
+	}{
+		{"incoming trace", "00-" + testTraceID + "-" + testSpanID + "-01", true},
+		{"no traceparent", "", false},
+		{"invalid traceparent", "00-" + testTraceID + "-0000000000000000-01", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recorder{}
+			tracer := &Tracer{Service: "Logging", Exporter: rec}
+
+			router := chi.NewRouter()
+			var inHandler SpanContext
+			router.Get("/services/{id}", func(w http.ResponseWriter, r *http.Request) {
+				inHandler = SpanContextFromContext(r.Context())
+				w.WriteHeader(http.StatusTeapot)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/services/42", nil)
+			// The server seeds the route context so the matched pattern is
+			// visible to middleware outside the router.
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chi.NewRouteContext()))
+			if tt.traceparent != "" {
+				req.Header.Set(TraceparentHeader, tt.traceparent)
+			}
+			tracer.Middleware(router).ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := rec.exported()
+			if len(spans) != 1 {
+				t.Fatalf("exported %d spans, want 1", len(spans))
+			}
+			span := spans[0]
+			if span.SpanID != inHandler.SpanID.String() {
+				t.Errorf("handler saw span %s, exported %s", inHandler.SpanID, span.SpanID)
+			}
+			if continued := span.TraceID == testTraceID && span.ParentSpanID == testSpanID; continued != tt.continued {
+				t.Errorf("span %+v continued the incoming trace: %v, want %v", span, continued, tt.continued)
+			}
+			if span.Kind != KindServer || span.Name != "GET /services/{id}" {
+				t.Errorf("span is %s %q, want a server span named by route", span.Kind, span.Name)
+			}
+			if span.Attributes["http.status_code"] != "418" {
+				t.Errorf("status code attribute = %q", span.Attributes["http.status_code"])
+			}
+		})
+	}
+}
+
+func TestTransportInjectsChildSpan(t *testing.T) {
+	var received string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(TraceparentHeader)
+	}))
+	defer ts.Close()
+
+	rec := &recorder{}
+	tracer := &Tracer{Service: "Business", Exporter: rec}
+	client := &http.Client{Transport: &Transport{Tracer: tracer}}
+
+	ctx, parent := tracer.Start(context.Background(), "handle", KindServer)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	parent.End()
+
+	if req.Header.Get(TraceparentHeader) != "" {
+		t.Error("the caller's request was modified")
+	}
+	sc, err := ParseTraceparent(received)
+	if err != nil {
+		t.Fatalf("received traceparent %q: %v", received, err)
+	}
+
+	spans := rec.exported()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	client0 := spans[0]
+	if client0.Kind != KindClient || client0.SpanID != sc.SpanID.String() {
+		t.Errorf("traceparent %s does not carry the client span %+v", received, client0)
+	}
+	if sc.TraceID != parent.SpanContext().TraceID || client0.ParentSpanID != parent.SpanContext().SpanID.String() {
+		t.Errorf("client span %+v is not a child of %+v", client0, parent.SpanContext())
+	}
+}
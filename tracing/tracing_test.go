@@ -0,0 +1,105 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+const (
+	testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID  = "00f067aa0ba902b7"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		valid   bool
+		sampled bool
+	}{
+		{"sampled", "00-" + testTraceID + "-" + testSpanID + "-01", true, true},
+		{"not sampled", "00-" + testTraceID + "-" + testSpanID + "-00", true, false},
+		{"surrounding whitespace", " 00-" + testTraceID + "-" + testSpanID + "-01 ", true, true},
+		{"future version with extra field", "01-" + testTraceID + "-" + testSpanID + "-01-extra", true, true},
+		{"version 00 with extra field", "00-" + testTraceID + "-" + testSpanID + "-01-extra", false, false},
+		{"forbidden version ff", "ff-" + testTraceID + "-" + testSpanID + "-01", false, false},
+		{"three-digit version", "000-" + testTraceID + "-" + testSpanID + "-01", false, false},
+		{"all-zero trace ID", "00-00000000000000000000000000000000-" + testSpanID + "-01", false, false},
+		{"all-zero span ID", "00-" + testTraceID + "-0000000000000000-01", false, false},
+		{"short trace ID", "00-" + testTraceID[:30] + "-" + testSpanID + "-01", false, false},
+		{"long span ID", "00-" + testTraceID + "-" + testSpanID + "00-01", false, false},
+		{"short flags", "00-" + testTraceID + "-" + testSpanID + "-1", false, false},
+		{"non-hex trace ID", "00-" + "zz" + testTraceID[2:] + "-" + testSpanID + "-01", false, false},
+		{"too few fields", "00-" + testTraceID + "-" + testSpanID, false, false},
+		{"empty", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tt.value)
+			if (err == nil) != tt.valid {
+				t.Fatalf("ParseTraceparent(%q) error = %v, want valid %v", tt.value, err, tt.valid)
+			}
+			if !tt.valid {
+				return
+			}
+			if sc.TraceID.String() != testTraceID || sc.SpanID.String() != testSpanID {
+				t.Errorf("parsed %s/%s", sc.TraceID, sc.SpanID)
+			}
+			if sc.Sampled() != tt.sampled {
+				t.Errorf("Sampled() = %v, want %v", sc.Sampled(), tt.sampled)
+			}
+		})
+	}
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	_, span := (&Tracer{}).Start(context.Background(), "op", KindInternal)
+	sc, err := ParseTraceparent(span.SpanContext().Traceparent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc != span.SpanContext() {
+		t.Errorf("round trip = %+v, want %+v", sc, span.SpanContext())
+	}
+}
+
+// recorder collects exported spans.
+type recorder struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (r *recorder) Export(span SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, span)
+}
+
+func (r *recorder) exported() []SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]SpanData(nil), r.spans...)
+}
+
+func TestStartChildSpan(t *testing.T) {
+	rec := &recorder{}
+	tracer := &Tracer{Service: "Business", Exporter: rec}
+
+	ctx, root := tracer.Start(context.Background(), "root", KindInternal)
+	_, child := tracer.Start(ctx, "child", KindInternal)
+	child.End()
+	root.End()
+	root.End()
+
+	spans := rec.exported()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	if spans[0].TraceID != spans[1].TraceID || spans[0].ParentSpanID != spans[1].SpanID {
+		t.Errorf("child %+v is not a child of %+v", spans[0], spans[1])
+	}
+	if spans[1].ParentSpanID != "" {
+		t.Errorf("root has parent %s", spans[1].ParentSpanID)
+	}
+}